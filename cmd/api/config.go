@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mehmetsafabenli/cbomdekont/pkg/api/http"
+	"github.com/mehmetsafabenli/cbomdekont/pkg/logging"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const envPrefix = "EVENT"
+
+// envKeyReplacer maps config keys to environment variables, access-log.enabled is
+// EVENT_ACCESS_LOG_ENABLED
+var envKeyReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// configKey is a leaf of the config, a value that is not a struct
+type configKey struct {
+	key string
+	typ reflect.Type
+}
+
+// configSections are the structs the config is decoded into, by key prefix
+var configSections = []struct {
+	prefix string
+	value  any
+}{
+	{"", http.Config{}},
+	{"log-sampling", logging.SamplingConfig{}},
+	{"log-file", LogFileConfig{}},
+	{"aws.vault", http.VaultConfig{}},
+	{"aws.client", http.AWSClientConfig{}},
+	{"aws.assume_role", http.AssumeRoleConfig{}},
+	{"textract-simulator", http.SimulatorConfig{}},
+}
+
+// otherKeys are read with viper.Get instead of being decoded into a struct
+var otherKeys = []configKey{
+	{"config", reflect.TypeOf("")},
+	{"level", reflect.TypeOf("")},
+	{"log-levels", reflect.TypeOf(map[string]string{})},
+	{"schema-file", reflect.TypeOf("")},
+	{"aws.access_key_id_file", reflect.TypeOf("")},
+	{"aws.secret_access_key_file", reflect.TypeOf("")},
+}
+
+// configUsage describes the keys without a command line flag, flags carry their own usage
+var configUsage = map[string]string{
+	"access-log.enabled":        "log every request, sampled by status class",
+	"access-log.sample-rates":   "fraction of requests logged per status class, e.g. 2xx: 0.1; unlisted classes are always logged",
+	"access-log.slow-threshold": "requests slower than this are always logged",
+
+	"accuracy.enabled":    "re-run the parser over the golden fixtures on an interval and report regressions",
+	"accuracy.dir":        "fixtures in the layout of testdata, <docType>/<name>.textract.json",
+	"accuracy.interval":   "time between accuracy runs, the first one is at startup",
+	"accuracy.report-url": "URL every accuracy report is posted to as JSON",
+
+	"admin-host":       "address the admin listener binds to",
+	"admin-token":      "bearer token of the admin API, which is disabled without a token",
+	"admin-token-file": "file holding the admin token, re-read when it changes",
+
+	"admission.max-heap-mb":   "live heap in megabytes above which analyses are rejected, 0 disables the check",
+	"admission.max-in-flight": "analyses processed at once including waiting ones, 0 is unlimited",
+	"admission.max-queued":    "analyses allowed to wait for a Textract slot, 0 is unlimited",
+	"admission.retry-after":   "Retry-After sent with admission rejections",
+
+	"aws.access_key_id_file":     "file holding the AWS access key id, re-read when it changes",
+	"aws.secret_access_key_file": "file holding the AWS secret access key, re-read when it changes",
+
+	"aws.assume_role.role_arn":     "role assumed with the configured credentials for the AWS calls",
+	"aws.assume_role.external_id":  "sts:ExternalId the trust policy of the role requires",
+	"aws.assume_role.session_name": "session name of the assumed role",
+	"aws.assume_role.duration":     "lifetime of the role credentials, 15m to 12h; the STS default when unset",
+	"aws.assume_role.tags":         "session tags; the trust policy must allow sts:TagSession",
+
+	"aws.client.ca_bundle":               "PEM file of roots trusted besides the system roots, e.g. of a TLS-inspecting proxy",
+	"aws.client.connect_timeout":         "TCP connect timeout of the AWS calls; the SDK default when unset",
+	"aws.client.max_attempts":            "attempts per AWS call including the first, 1 disables retries; the SDK default is 3",
+	"aws.client.response_header_timeout": "time to wait for the response headers of an AWS call, no limit when unset",
+	"aws.client.retry_mode":              "standard or adaptive; adaptive also slows down the client while Textract throttles",
+	"aws.client.timeout":                 "bound of one HTTP attempt of an AWS call including the response, no limit when unset",
+	"aws.client.tls_handshake_timeout":   "TLS handshake timeout of the AWS calls; the SDK default when unset",
+
+	"aws.vault.address":         "Vault address; with a role the AWS credentials come from its AWS secrets engine",
+	"aws.vault.token":           "Vault token",
+	"aws.vault.token_file":      "file holding the Vault token, re-read when it changes",
+	"aws.vault.mount":           "mount path of the AWS secrets engine",
+	"aws.vault.role":            "role of the AWS secrets engine issuing the credentials",
+	"aws.vault.credential_type": "sts or creds",
+
+	"body-limit":              "request body limit in bytes of routes without a route-limits entry",
+	"cache-batch-interval":    "a batch of cache writes is sent this long after its first write at the latest",
+	"cache-batch-size":        "result cache writes sent to redis in one pipeline, above 1 enables batching",
+	"cache-db":                "redis database number",
+	"cache-dial-timeout":      "redis connect timeout",
+	"cache-read-timeout":      "redis read timeout",
+	"cache-write-timeout":     "redis write timeout",
+	"cache-sentinel-addrs":    "redis sentinel addresses; the master is looked up through them instead of cache-server",
+	"cache-sentinel-master":   "name of the master monitored by the sentinels",
+	"cache-sentinel-password": "password of the sentinels",
+	"cache-server":            "redis address, redis:// or rediss:// URL; result cache and replay protection are off without one",
+	"cache-tls-skip-verify":   "skip verifying the certificate of a rediss:// server",
+
+	"configmap.enabled":            "read the schemas, admin token and signing keys from a ConfigMap through the Kubernetes API",
+	"configmap.name":               "name of the ConfigMap",
+	"configmap.namespace":          "namespace of the ConfigMap, the namespace of the pod when unset",
+	"configmap.schema-key":         "key holding a schema file, merged over the embedded schemas like schema-file",
+	"configmap.admin-token-key":    "key holding the admin token",
+	"configmap.signing-key-prefix": "prefix of the keys holding signing secrets, signing-key.billing holds key id billing",
+
+	"cors.allow-origins": "browser origins allowed to call the API with credentials",
+	"cors.origins-file":  "file with one origin per line replacing allow-origins, re-read when it changes",
+
+	"egress.proxy":         "http:// or https:// proxy of the outbound HTTP calls; HTTPS_PROXY and NO_PROXY apply when unset",
+	"egress.no-proxy":      "hosts reached without the proxy, a leading dot matches the subdomains",
+	"egress.allowed-hosts": "hosts outbound calls may reach, all when empty; *.example.com allows the subdomains",
+
+	"fx.enabled":  "convert foreign currency amounts to TRY for schemas with a currency section",
+	"fx.base-url": "TCMB exchange rate archive",
+	"fx.rate":     "forex-buying, forex-selling, banknote-buying or banknote-selling",
+	"fx.timeout":  "timeout of an exchange rate request",
+
+	"h2c":                 "not used",
+	"header-limit":        "request header limit in bytes of routes without a route-limits entry",
+	"heif-convert-path":   "heif-convert binary converting HEIC images to JPEG",
+	"histograms":          "buckets per histogram metric name, merged over the built-in buckets",
+	"host":                "not used",
+	"http-client-timeout": "timeout of a Textract call when textract-timeouts.sync is unset",
+	"http-server-timeout": "keep-alive connections are closed after twice this idle time",
+	"image-max-dimension": "images are downscaled to this width and height in pixels before Textract",
+
+	"log-file.path":        "file the logs are also written to, rotated by size",
+	"log-file.max-size":    "size in megabytes at which the log file is rotated, 100 when unset",
+	"log-file.max-age":     "days rotated log files are kept, forever when unset",
+	"log-file.max-backups": "rotated log files kept, all when unset",
+	"log-file.compress":    "gzip rotated log files",
+	"log-levels":           "log level per logger (http, aws, parser), overriding level",
+
+	"log-sampling.initial":    "entries with the same level and message logged per second before sampling starts",
+	"log-sampling.thereafter": "after initial, every nth entry with the same message is logged",
+
+	"maintenance.windows": "planned windows with start, end and reason during which new analyses are rejected",
+	"maintenance.unready": "also fail the readiness probe during a maintenance window",
+
+	"min-confidence": "Textract confidence, 0 to 100, a value needs to be returned; schema fields may override it",
+
+	"mtls.enabled":          "require client certificates signed by client-ca-file",
+	"mtls.port":             "dedicated mTLS listener port; without it the main listener is served over mTLS",
+	"mtls.cert-file":        "server certificate",
+	"mtls.key-file":         "server certificate key",
+	"mtls.client-ca-file":   "CA bundle verifying client certificates",
+	"mtls.allowed-subjects": "accepted client certificate common names or DNS/URI SANs, all when empty",
+
+	"notifications": "rules posting the results of new analyses matching a filter to a URL",
+	"parse-mode":    "lenient or strict, the parseMode of requests without one",
+	"pdf-passwords": "passwords tried on encrypted PDFs after the one in the request",
+
+	"pii.mask":      "mask personal data in every field; schema fields override it with pii: mask or keep",
+	"pii.detectors": "kinds of personal data detected",
+
+	"port-admin":   "port of a separate admin listener; without it the admin API is served on port",
+	"port-metrics": "port of a separate metrics listener, off when unset",
+	"priorities":   "concurrency, rate and burst of the interactive and bulk Textract pools, merged over the built-in pools",
+	"qpdf-path":    "qpdf binary decrypting password protected PDFs",
+
+	"result-cache-ttl": "lifetime of cached results, 0 disables the result cache",
+	"reuse-port":       "set SO_REUSEPORT so a new process can bind the port next to the old one",
+	"route-limits":     "body-limit and header-limit per route pattern, merged over the built-in 20 MiB limit of the analyze routes; the most specific matching pattern applies",
+
+	"samples.enabled":   "keep anonymized Textract output of failed extractions for schema developers",
+	"samples.dir":       "directory receiving <docType>/<time>-<reason>.textract.json samples",
+	"samples.max-age":   "samples older than this are deleted",
+	"samples.max-count": "samples kept at most, the oldest are deleted first",
+
+	"security-headers.disabled":                         "do not set the security headers, e.g. when a proxy sets them",
+	"security-headers.frame-options":                    "X-Frame-Options",
+	"security-headers.referrer-policy":                  "Referrer-Policy",
+	"security-headers.hsts-max-age":                     "max-age of Strict-Transport-Security, sent on TLS requests only",
+	"security-headers.hsts-include-subdomains":          "add includeSubDomains to Strict-Transport-Security",
+	"security-headers.content-security-policy":          "Content-Security-Policy of the API",
+	"security-headers.swagger-content-security-policy":  "Content-Security-Policy of the Swagger UI",
+	"security-headers.admin-ui-content-security-policy": "Content-Security-Policy of the admin UI",
+
+	"sentry-dsn":              "Sentry DSN errors are reported to, off when unset",
+	"sentry-environment":      "Sentry environment",
+	"server-pre-stop-delay":   "time the server keeps serving after SIGTERM with the readiness probe failing",
+	"server-shutdown-timeout": "time in-flight requests get to finish on shutdown",
+
+	"signing.required":  "reject unsigned requests on the document routes",
+	"signing.keys":      "signing secret per key id",
+	"signing.key-files": "file holding the signing secret per key id",
+	"signing.keys-dir":  "directory with one secret file per key id, re-read when it changes",
+	"signing.window":    "how far a signature timestamp may be from now; nonces are kept twice as long",
+
+	"textract-simulator.enabled":    "answer Textract calls from fixtures, for load tests",
+	"textract-simulator.fixtures":   "fixtures in the layout of testdata, returned in turn per docType",
+	"textract-simulator.latency":    "mean latency of a simulated call",
+	"textract-simulator.jitter":     "most a simulated call's latency differs from latency",
+	"textract-simulator.error-rate": "fraction of simulated calls failing with throttling, 0 to 1",
+
+	"textract-timeouts.sync":      "bound of a synchronous Textract call including retries; http-client-timeout applies first when unset",
+	"textract-timeouts.doc-types": "sync timeout per docType",
+
+	"unhealthy":       "fail the liveness probe",
+	"unready":         "fail the readiness probe",
+	"upload-dir":      "directory keeping resumable uploads",
+	"upload-expiry":   "time an unfinished or unfinalized upload is kept",
+	"upload-max-size": "largest resumable upload in bytes",
+	"verbosity":       "minimal, standard or debug, the verbosity of requests without one",
+
+	"warm-up.enabled":  "open the AWS and redis connections before reporting ready",
+	"warm-up.textract": "also send a one page sample to DetectDocumentText, which is billed",
+	"warm-up.timeout":  "bound of the whole warm-up",
+}
+
+// keyUsage returns the description of key, taken from its flag if it has one
+func keyUsage(fs *pflag.FlagSet, key string) string {
+	if flag := fs.Lookup(key); flag != nil {
+		return flag.Usage
+	}
+	return configUsage[key]
+}
+
+// configKeys lists every key of the config, sorted
+func configKeys() []configKey {
+	keys := append([]configKey(nil), otherKeys...)
+	for _, section := range configSections {
+		keys = appendKeys(keys, section.prefix, reflect.TypeOf(section.value))
+	}
+	// hostname is always taken from the OS
+	keys = slices.DeleteFunc(keys, func(key configKey) bool { return key.key == "hostname" })
+	sort.Slice(keys, func(i, j int) bool { return keys[i].key < keys[j].key })
+	return keys
+}
+
+func appendKeys(keys []configKey, prefix string, t reflect.Type) []configKey {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		typ := field.Type
+		for typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+		if typ.Kind() == reflect.Struct && typ != reflect.TypeOf(time.Time{}) {
+			keys = appendKeys(keys, key, typ)
+			continue
+		}
+		keys = append(keys, configKey{key: key, typ: typ})
+	}
+	return keys
+}
+
+// fileOnly reports whether values of t cannot be written as an environment variable
+func fileOnly(t reflect.Type) bool {
+	return t.Kind() == reflect.Map || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct)
+}
+
+// envName returns the environment variable setting key
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
+
+// bindEnv makes every key settable from the environment alone; viper only looks up the
+// environment for keys it knows of from the config file, defaults or bindings
+func bindEnv() {
+	for _, key := range configKeys() {
+		if !fileOnly(key.typ) {
+			_ = viper.BindEnv(key.key)
+		}
+	}
+}
+
+// printDefaultConfig writes a config.yaml holding every key with its description, the
+// value the server uses when it is unset and, in a comment, the environment variable
+// setting it
+func printDefaultConfig(w io.Writer, fs *pflag.FlagSet) {
+	for key, value := range http.ConfigDefaults() {
+		viper.SetDefault(key, value)
+	}
+
+	fmt.Fprintln(w, "# generated by --print-default-config")
+	fmt.Fprintln(w, "# each key can also be set with the environment variable in its comment; lists take")
+	fmt.Fprintln(w, "# comma separated values, maps and lists of objects can only be set in this file.")
+	fmt.Fprintln(w, "# AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_REGION are read from the environment.")
+
+	var section []string
+	for _, key := range configKeys() {
+		path := strings.Split(key.key, ".")
+		parents := path[:len(path)-1]
+		common := 0
+		for common < len(section) && common < len(parents) && section[common] == parents[common] {
+			common++
+		}
+		for depth := common; depth < len(parents); depth++ {
+			fmt.Fprintf(w, "%s%s:\n", strings.Repeat("  ", depth), parents[depth])
+		}
+		section = parents
+
+		comment := envName(key.key)
+		if fileOnly(key.typ) {
+			comment = "config file only"
+		}
+		indent := strings.Repeat("  ", len(parents))
+		fmt.Fprintf(w, "%s# %s\n", indent, keyUsage(fs, key.key))
+		fmt.Fprintf(w, "%s%s: %s   # %s\n", indent, path[len(path)-1], yamlValue(key), comment)
+	}
+}
+
+// yamlValue formats the default of key, or its zero value
+func yamlValue(key configKey) string {
+	value := viper.Get(key.key)
+	switch key.typ.Kind() {
+	case reflect.Map:
+		return "{}"
+	case reflect.Slice:
+		if key.typ.Elem().Kind() == reflect.Struct {
+			return "[]"
+		}
+		items := viper.GetStringSlice(key.key)
+		for i, item := range items {
+			items[i] = strconv.Quote(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.String:
+		return strconv.Quote(viper.GetString(key.key))
+	case reflect.Bool:
+		return strconv.FormatBool(viper.GetBool(key.key))
+	}
+	if key.typ == reflect.TypeOf(time.Duration(0)) {
+		return viper.GetDuration(key.key).String()
+	}
+	if value == nil {
+		return "0"
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mehmetsafabenli/cbomdekont/pkg/api/http"
+)
+
+// TestConfigUsage keeps the descriptions and defaults of --print-default-config in step
+// with the config structs
+func TestConfigUsage(t *testing.T) {
+	fs := newFlagSet()
+	keys := make(map[string]bool)
+	for _, key := range configKeys() {
+		keys[key.key] = true
+		if keyUsage(fs, key.key) == "" {
+			t.Errorf("%s has no description", key.key)
+		}
+	}
+	for key := range configUsage {
+		if !keys[key] {
+			t.Errorf("description of unknown key %s", key)
+		}
+	}
+	for key := range http.ConfigDefaults() {
+		if !keys[key] {
+			t.Errorf("default of unknown key %s", key)
+		}
+	}
+}
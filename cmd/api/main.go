@@ -6,17 +6,32 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/mehmetsafabenli/cbomdekont/pkg/api/http"
+	"github.com/mehmetsafabenli/cbomdekont/pkg/logging"
 	"github.com/mehmetsafabenli/cbomdekont/pkg/signals"
-	"github.com/prometheus/common/version"
+	"github.com/mehmetsafabenli/cbomdekont/pkg/version"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+// LogFileConfig additionally writes the logs to a rotating file, for hosts without a log collector
+type LogFileConfig struct {
+	Path string `mapstructure:"path"`
+	// MaxSize is the size in megabytes at which the file is rotated
+	MaxSize int `mapstructure:"max-size"`
+	// MaxAge is the number of days rotated files are kept
+	MaxAge     int  `mapstructure:"max-age"`
+	MaxBackups int  `mapstructure:"max-backups"`
+	Compress   bool `mapstructure:"compress"`
+}
+
 // BaseResponse, tüm API yanıtları için temel yapıyı tanımlar
 type BaseResponse struct {
 	Success bool        `json:"success"`
@@ -24,16 +39,27 @@ type BaseResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-func main() {
+// newFlagSet defines the command line flags; flags named like a config key set it and
+// describe it in --print-default-config
+func newFlagSet() *pflag.FlagSet {
 	fs := pflag.NewFlagSet("default", pflag.ContinueOnError)
 	fs.String("config", "config.yaml", "path to config file")
 	fs.String("config-path", ".", "config file directory")
 	fs.String("port", "80", "port to bind HTTP listener")
 	fs.String("level", "info", "log level debug, info, warn, error, fatal or panic")
+	fs.String("schema-file", "/root/schema.json", "schema file overriding the embedded default schemas")
+	fs.Bool("read-only", false, "reject analyze and upload requests, retrieval endpoints keep working")
+	fs.Bool("print-default-config", false, "print a config.yaml with every key, its description, default and environment variable, then exit")
 
-	versionFlag := fs.BoolP("version", "v", false, "version number")
+	fs.BoolP("version", "v", false, "version number")
+	return fs
+}
 
+func main() {
+	fs := newFlagSet()
 	err := fs.Parse(os.Args[1:])
+	versionFlag, _ := fs.GetBool("version")
+	printConfig, _ := fs.GetBool("print-default-config")
 	switch {
 	case errors.Is(err, pflag.ErrHelp):
 		os.Exit(0)
@@ -44,8 +70,8 @@ func main() {
 		}
 		fs.PrintDefaults()
 		os.Exit(2)
-	case *versionFlag:
-		fmt.Println(version.Version)
+	case versionFlag:
+		fmt.Printf("%s (revision %s, built %s, %s)\n", version.VERSION, version.REVISION, version.BUILDDATE, version.GoVersion())
 		os.Exit(0)
 	}
 
@@ -55,25 +81,48 @@ func main() {
 	}
 	hostname, _ := os.Hostname()
 	viper.Set("hostname", hostname)
-	viper.SetEnvPrefix("EVENT")
-	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(envKeyReplacer)
 	viper.AutomaticEnv()
+	bindEnv()
+
+	viper.SetDefault("server-shutdown-timeout", 30*time.Second)
+	viper.SetDefault("server-pre-stop-delay", 3*time.Second)
+	viper.SetDefault("log-sampling.initial", 100)
+	viper.SetDefault("log-sampling.thereafter", 100)
+
+	if printConfig {
+		printDefaultConfig(os.Stdout, fs)
+		os.Exit(0)
+	}
 
 	configPath := viper.GetString("config-path")
 	configFile := viper.GetString("config")
 
+	configLoaded := false
 	if _, err := os.Stat(filepath.Join(configPath, configFile)); err == nil {
 		viper.SetConfigName(strings.TrimSuffix(configFile, filepath.Ext(configFile)))
 		viper.AddConfigPath(configPath)
 		err = viper.ReadInConfig()
 		if err != nil {
 			fmt.Println("Config file not found, using default values")
+		} else {
+			configLoaded = true
 		}
 	} else {
 		fmt.Println("Config file not found, using default values")
 	}
 
-	logger, err := configureLogging("info")
+	var logFile LogFileConfig
+	if err := viper.UnmarshalKey("log-file", &logFile); err != nil {
+		panic(err)
+	}
+
+	logController, err := logging.NewController(loggingConfig())
+	if err != nil {
+		panic(err)
+	}
+	logger, err := configureLogging(logController, logFile)
 	defer logger.Sync()
 	if err != nil {
 		logger.Fatal("failed to sync logger", zap.Error(err))
@@ -82,7 +131,23 @@ func main() {
 	stdLog := zap.RedirectStdLog(logger)
 	defer stdLog()
 
-	logger.Info("Starting application", zap.String("version", viper.GetString("version")))
+	// level, log-levels and log-sampling are applied without a restart
+	if configLoaded {
+		viper.OnConfigChange(func(e fsnotify.Event) {
+			if err := logController.Update(loggingConfig()); err != nil {
+				logger.Error("Invalid logging config, keeping the previous one", zap.Error(err))
+				return
+			}
+			logger.Info("Logging config reloaded", zap.String("file", e.Name))
+		})
+		viper.WatchConfig()
+	}
+
+	logger.Info("Starting application",
+		zap.String("version", version.VERSION),
+		zap.String("revision", version.REVISION),
+		zap.String("buildDate", version.BUILDDATE),
+	)
 
 	var srvCfg http.Config
 	if err := viper.Unmarshal(&srvCfg); err != nil {
@@ -93,15 +158,42 @@ func main() {
 	awsCfg.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
 	awsCfg.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
 	awsCfg.Region = os.Getenv("AWS_REGION")
+	awsCfg.AccessKeyIDFile = viper.GetString("aws.access_key_id_file")
+	awsCfg.SecretAccessKeyFile = viper.GetString("aws.secret_access_key_file")
 
-	if awsCfg.AccessKeyID == "" || awsCfg.SecretAccessKey == "" || awsCfg.Region == "" {
+	if err := viper.UnmarshalKey("aws.vault", &awsCfg.Vault); err != nil {
+		logger.Panic("vault config unmarshal failed", zap.Error(err))
+	}
+	if err := viper.UnmarshalKey("aws.client", &awsCfg.Client); err != nil {
+		logger.Panic("aws client config unmarshal failed", zap.Error(err))
+	}
+	if err := viper.UnmarshalKey("aws.assume_role", &awsCfg.AssumeRole); err != nil {
+		logger.Panic("aws assume role config unmarshal failed", zap.Error(err))
+	}
+	awsCfg.Egress = srvCfg.Egress
+	if err := viper.UnmarshalKey("textract-simulator", &awsCfg.Simulator); err != nil {
+		logger.Panic("textract simulator config unmarshal failed", zap.Error(err))
+	}
+
+	schemaPath := viper.GetString("schema-file")
+
+	// "doctor" checks config and dependencies, prints a report and exits
+	if fs.Arg(0) == "doctor" {
+		if !http.RunDoctor(&srvCfg, &awsCfg, schemaPath, logger, os.Stdout) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	hasKeys := awsCfg.AccessKeyID != "" && awsCfg.SecretAccessKey != ""
+	hasKeyFiles := awsCfg.AccessKeyIDFile != "" && awsCfg.SecretAccessKeyFile != ""
+	hasVault := awsCfg.Vault.Address != ""
+	if ((!hasKeys && !hasKeyFiles && !hasVault) || awsCfg.Region == "") && !awsCfg.Simulator.Enabled {
 		logger.Panic("AWS credentials are not set properly")
 	}
 
-	// schema.json dosyasının yolunu doğru şekilde belirtin
-	schemaPath := "/root/schema.json"
 	if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
-		logger.Panic("schema.json file not found", zap.String("path", schemaPath), zap.Error(err))
+		logger.Info("schema file not found, using embedded schemas", zap.String("path", schemaPath))
 	}
 
 	awsServer, err := http.NewAWSService(logger, &awsCfg, schemaPath)
@@ -112,33 +204,37 @@ func main() {
 	logger.Info("Starting HTTP server", zap.String("port", srvCfg.Port))
 
 	//start http server
-	srv, _ := http.NewServer(&srvCfg, logger, awsServer)
+	srv, err := http.NewServer(&srvCfg, logger, awsServer)
+	if err != nil {
+		logger.Panic("Failed to initialize HTTP server", zap.Error(err))
+	}
 
 	httpServer, healthy, ready := srv.ListenAndServe()
 
 	//graceful shutdown
 	stopCh := signals.SetupSignalHandler()
-	sd, _ := signals.NewShutdown(srvCfg.ServerShutdownTimeout, logger)
+	sd, _ := signals.NewShutdown(srvCfg.ServerShutdownTimeout, srvCfg.ServerPreStopDelay, logger)
 	sd.Graceful(stopCh, httpServer, healthy, ready)
+	srv.FlushCacheWrites(5 * time.Second)
+	srv.FlushErrorReports(5 * time.Second)
 
 }
 
-func configureLogging(logLevel string) (*zap.Logger, error) {
-	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	switch logLevel {
-	case "debug":
-		level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
-	case "info":
-		level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	case "warn":
-		level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
-	case "error":
-		level = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
-	case "fatal":
-		level = zap.NewAtomicLevelAt(zapcore.FatalLevel)
-	case "panic":
-		level = zap.NewAtomicLevelAt(zapcore.PanicLevel)
+// loggingConfig reads the hot-reloadable logging settings
+func loggingConfig() logging.Config {
+	var sampling logging.SamplingConfig
+	_ = viper.UnmarshalKey("log-sampling", &sampling)
+	return logging.Config{
+		Level:    viper.GetString("level"),
+		Levels:   viper.GetStringMapString("log-levels"),
+		Sampling: sampling,
 	}
+}
+
+// configureLogging builds a logger whose levels and sampling are decided by controller
+func configureLogging(controller *logging.Controller, logFile LogFileConfig) (*zap.Logger, error) {
+	// the controller filters entries, the cores below pass every level
+	level := zap.NewAtomicLevelAt(zapcore.DebugLevel)
 
 	zapEncoderConfig := zapcore.EncoderConfig{
 		TimeKey:        "ts",
@@ -155,17 +251,30 @@ func configureLogging(logLevel string) (*zap.Logger, error) {
 	}
 
 	zapConfig := zap.Config{
-		Level:       level,
-		Development: false,
-		Sampling: &zap.SamplingConfig{
-			Initial:    100,
-			Thereafter: 100,
-		},
+		Level:            level,
+		Development:      false,
 		Encoding:         "json",
 		EncoderConfig:    zapEncoderConfig,
 		OutputPaths:      []string{"stderr"},
 		ErrorOutputPaths: []string{"stderr"},
 	}
 
-	return zapConfig.Build()
+	var options []zap.Option
+	if logFile.Path != "" {
+		rotator := &lumberjack.Logger{
+			Filename:   logFile.Path,
+			MaxSize:    logFile.MaxSize,
+			MaxAge:     logFile.MaxAge,
+			MaxBackups: logFile.MaxBackups,
+			Compress:   logFile.Compress,
+		}
+		fileCore := zapcore.NewCore(zapcore.NewJSONEncoder(zapEncoderConfig), zapcore.AddSync(rotator), level)
+		options = append(options, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, fileCore)
+		}))
+	}
+
+	options = append(options, zap.WrapCore(controller.Wrap))
+
+	return zapConfig.Build(options...)
 }
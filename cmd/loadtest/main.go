@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// loadtest sends concurrent analyses of one document to a running server and samples its
+// resident memory from the metrics endpoint, to check that RSS stays bounded under load,
+// and reports throughput and latency for capacity planning. Run the server without
+// cache-server, otherwise every request after the first is served from the result cache.
+// With textract-simulator enabled the server answers with the fixtures of doc-type after
+// a configurable latency, so the pipeline can be loaded without AWS calls.
+func main() {
+	fs := pflag.NewFlagSet("loadtest", pflag.ExitOnError)
+	url := fs.String("url", "http://localhost:80/api/v1/test", "analyze endpoint")
+	metricsURL := fs.String("metrics-url", "http://localhost:80/api/v1/metrics", "prometheus endpoint of the server")
+	file := fs.String("file", "", "document to upload")
+	docType := fs.String("doc-type", "papara", "docType form field")
+	concurrency := fs.Int("concurrency", 50, "requests in flight")
+	requests := fs.Int("requests", 500, "total requests")
+	interval := fs.Duration("interval", 500*time.Millisecond, "memory sampling interval")
+	maxRSS := fs.Int64("max-rss", 0, "fail if the peak resident memory exceeds this many MB")
+	_ = fs.Parse(os.Args[1:])
+
+	document, err := os.ReadFile(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(2)
+	}
+	body, contentType, err := multipartBody(document, filepath.Base(*file), *docType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(2)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+
+	startRSS, err := residentMemory(client, *metricsURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reading metrics: %s\n", err)
+		os.Exit(2)
+	}
+	peakRSS := startRSS
+	stopSampling := make(chan struct{})
+	samplingDone := make(chan struct{})
+	go func() {
+		defer close(samplingDone)
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopSampling:
+				return
+			case <-ticker.C:
+				if rss, err := residentMemory(client, *metricsURL); err == nil {
+					peakRSS = max(peakRSS, rss)
+				}
+			}
+		}
+	}()
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		statuses  = make(map[int]int)
+		failures  int
+		jobs      = make(chan struct{})
+		wg        sync.WaitGroup
+	)
+	begin := time.Now()
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				start := time.Now()
+				resp, err := client.Post(*url, contentType, bytes.NewReader(body))
+				elapsed := time.Since(start)
+
+				mu.Lock()
+				if err != nil {
+					failures++
+				} else {
+					_, _ = io.Copy(io.Discard, resp.Body)
+					_ = resp.Body.Close()
+					statuses[resp.StatusCode]++
+					latencies = append(latencies, elapsed)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < *requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+	total := time.Since(begin)
+
+	close(stopSampling)
+	<-samplingDone
+	endRSS, _ := residentMemory(client, *metricsURL)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	fmt.Printf("requests   %d in %s (%d failed to connect)\n", *requests, total.Round(time.Millisecond), failures)
+	fmt.Printf("throughput %.1f req/s\n", float64(len(latencies))/total.Seconds())
+	for status, count := range statuses {
+		fmt.Printf("status %d  %d\n", status, count)
+	}
+	if len(latencies) > 0 {
+		fmt.Printf("latency    p50 %s  p95 %s  p99 %s  max %s\n",
+			percentile(latencies, 0.50), percentile(latencies, 0.95), percentile(latencies, 0.99), latencies[len(latencies)-1])
+	}
+	fmt.Printf("rss        start %d MB  peak %d MB  end %d MB\n", startRSS>>20, peakRSS>>20, endRSS>>20)
+
+	if *maxRSS > 0 && peakRSS>>20 > *maxRSS {
+		fmt.Printf("peak rss exceeds %d MB\n", *maxRSS)
+		os.Exit(1)
+	}
+}
+
+func multipartBody(document []byte, name, docType string) ([]byte, string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("docType", docType); err != nil {
+		return nil, "", err
+	}
+	part, err := w.CreateFormFile("document", name)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(document); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), w.FormDataContentType(), nil
+}
+
+// residentMemory reads process_resident_memory_bytes from the prometheus text output
+func residentMemory(client *http.Client, url string) (int64, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "process_resident_memory_bytes ")
+		if !ok {
+			continue
+		}
+		rss, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, err
+		}
+		return int64(rss), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("process_resident_memory_bytes not found at %s", url)
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(float64(len(sorted)-1)*p)].Round(time.Millisecond)
+}
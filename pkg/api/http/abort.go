@@ -0,0 +1,75 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var errClientAborted = errors.New("client aborted the upload")
+
+var abortedUploadsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "aborted_uploads_total",
+	Help: "The total number of uploads the client disconnected from before the body was complete.",
+}, []string{"route"})
+
+func init() {
+	prometheus.MustRegister(abortedUploadsCounter)
+}
+
+// completeReader fails with errClientAborted when the stream ends before the declared
+// Content-Length arrived. fasthttp reports a closed connection as a plain io.EOF, which
+// would otherwise pass a truncated body on as if it were complete.
+type completeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *completeReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	switch {
+	case err == io.EOF && r.remaining > 0:
+		return n, fmt.Errorf("%w: %d bytes missing", errClientAborted, r.remaining)
+	case err != nil && err != io.EOF:
+		return n, fmt.Errorf("%w: %w", errClientAborted, err)
+	}
+	return n, err
+}
+
+// bodyReader returns the request body as a stream that detects truncated uploads
+func bodyReader(c fiber.Ctx) io.Reader {
+	stream := c.Request().BodyStream()
+	if stream == nil {
+		return bytes.NewReader(c.Body())
+	}
+	return &completeReader{r: stream, remaining: int64(c.Request().Header.ContentLength())}
+}
+
+// readBody reads the whole request body and makes it available to c.Body and c.FormFile
+func readBody(c fiber.Ctx) error {
+	if c.Request().BodyStream() == nil {
+		return nil
+	}
+	// fasthttp keeps the body until the request is released, so it can't come from the
+	// buffer pool; sizing it up front still saves the intermediate copies
+	body := bytes.NewBuffer(make([]byte, 0, max(c.Request().Header.ContentLength(), 0)+bytes.MinRead))
+	if _, err := body.ReadFrom(bodyReader(c)); err != nil {
+		return err
+	}
+	c.Request().SetBodyRaw(body.Bytes())
+	return nil
+}
+
+// abortedUpload records a client disconnect. Nothing downstream runs for the request,
+// the response only matters if the client is somehow still listening.
+func (s *Server) abortedUpload(c fiber.Ctx, err error) error {
+	abortedUploadsCounter.WithLabelValues(c.Route().Path).Inc()
+	s.requestLogger(c).Warn("Client aborted upload", zap.Error(err))
+	return fiber.NewError(fiber.StatusBadRequest, "Upload aborted before the body was complete")
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+)
+
+// AccessLogConfig samples the access log by status class to keep the volume manageable;
+// requests slower than SlowThreshold are always logged
+type AccessLogConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// SampleRates is the fraction of requests logged per status class ("2xx", "4xx"...),
+	// classes not listed are always logged
+	SampleRates   map[string]float64 `mapstructure:"sample-rates"`
+	SlowThreshold time.Duration      `mapstructure:"slow-threshold"`
+}
+
+func validateAccessLog(cfg AccessLogConfig) error {
+	for class, rate := range cfg.SampleRates {
+		switch class {
+		case "1xx", "2xx", "3xx", "4xx", "5xx":
+		default:
+			return fmt.Errorf("access log: unknown status class %q", class)
+		}
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("access log: sample rate of %s must be between 0 and 1", class)
+		}
+	}
+	return nil
+}
+
+// accessLog logs finished requests, sampled by status class
+func (s *Server) accessLog(c fiber.Ctx) error {
+	begin := time.Now()
+	err := c.Next()
+	elapsed := time.Since(begin)
+
+	// the error handler writes the response after the middlewares returned
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = errorStatus(err)
+	}
+
+	threshold := time.Duration(s.slowThreshold.Load())
+	slow := threshold > 0 && elapsed >= threshold
+	if !slow && !s.sampleAccessLog(status) {
+		return err
+	}
+
+	fields := []zap.Field{
+		zap.Int("status", status),
+		zap.Duration("duration", elapsed),
+		zap.String("remote", c.IP()),
+		zap.String("user-agent", c.Get(fiber.HeaderUserAgent)),
+		zap.Int("bytesIn", c.Request().Header.ContentLength()),
+		zap.Int("bytesOut", len(c.Response().Body())),
+	}
+	if slow {
+		s.requestLogger(c).Warn("slow request", fields...)
+	} else {
+		s.requestLogger(c).Info("request", fields...)
+	}
+	return err
+}
+
+func (s *Server) sampleAccessLog(status int) bool {
+	rate, ok := s.config.AccessLog.SampleRates[strconv.Itoa(status/100)+"xx"]
+	if !ok {
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// SetSlowThreshold godoc
+// @Summary Change the slow request threshold
+// @Description requests slower than the threshold are always logged, 0 disables it
+// @Tags Admin
+// @Produce json
+// @Param threshold query string true "duration such as 2s or 500ms"
+// @Router /api/v1/admin/access-log [put]
+// @Success 200 {object} BaseResponse
+func (s *Server) setSlowThresholdHandler(c fiber.Ctx) error {
+	threshold, err := time.ParseDuration(c.Query("threshold"))
+	if err != nil || threshold < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "threshold must be a duration such as 2s")
+	}
+	s.slowThreshold.Store(int64(threshold))
+	s.requestLogger(c).Info("Slow request threshold changed", zap.Duration("threshold", threshold))
+
+	return c.Status(fiber.StatusOK).JSON(BaseResponse{
+		Success: true,
+		Message: "Slow request threshold changed",
+		Data:    fiber.Map{"slowThreshold": threshold.String()},
+	})
+}
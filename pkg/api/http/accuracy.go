@@ -0,0 +1,225 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const defaultAccuracyInterval = 24 * time.Hour
+
+var (
+	accuracyRegressedFields = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "accuracy",
+		Name:      "regressed_fields",
+		Help:      "The number of golden fixture fields the current schemas parse differently, by docType.",
+	}, []string{"docType"})
+	accuracyRegressedFixtures = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "accuracy",
+		Name:      "regressed_fixtures",
+		Help:      "The number of golden fixtures that regressed or failed to parse in the last run.",
+	})
+	accuracyLastRun = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "accuracy",
+		Name:      "last_run_timestamp_seconds",
+		Help:      "The time of the last accuracy run as unix timestamp.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(accuracyRegressedFields)
+	prometheus.MustRegister(accuracyRegressedFixtures)
+	prometheus.MustRegister(accuracyLastRun)
+}
+
+// AccuracyConfig re-runs the parser over the golden fixtures with the loaded schemas on an
+// interval, so a schema edit that breaks the documents of an older bank shows up without a
+// deploy. The first run is at startup.
+type AccuracyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Dir holds the fixtures in the layout of testdata, <docType>/<name>.textract.json
+	Dir      string        `mapstructure:"dir"`
+	Interval time.Duration `mapstructure:"interval"`
+	// ReportURL receives every report as a JSON POST
+	ReportURL string `mapstructure:"report-url"`
+}
+
+// AccuracyReport lists the golden fixtures the parser no longer reproduces
+type AccuracyReport struct {
+	RanAt     time.Time       `json:"ranAt"`
+	Fixtures  int             `json:"fixtures"`
+	Regressed int             `json:"regressed"`
+	Results   []FixtureResult `json:"results"`
+}
+
+// FixtureResult is a regressed fixture with the differing fields, or the error that kept
+// it from being parsed
+type FixtureResult struct {
+	DocType string      `json:"docType"`
+	Name    string      `json:"name"`
+	Error   string      `json:"error,omitempty"`
+	Fields  []FieldDiff `json:"fields,omitempty"`
+}
+
+// BuildAccuracyReport parses every fixture below dir with schemas and compares the result
+// with its golden file. Unlike runGoldenFixtures a broken fixture does not stop the run,
+// it is reported with its error.
+func BuildAccuracyReport(dir string, schemas map[string]DocumentSchema) (*AccuracyReport, error) {
+	fixtures, err := findGoldenFixtures(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AccuracyReport{RanAt: time.Now(), Fixtures: len(fixtures), Results: []FixtureResult{}}
+	for _, fixture := range fixtures {
+		result := FixtureResult{DocType: fixture.docType, Name: fixture.name}
+		if diffs, err := compareFixture(fixture, schemas); err != nil {
+			result.Error = err.Error()
+		} else if len(diffs) > 0 {
+			result.Fields = diffs
+		} else {
+			continue
+		}
+		report.Regressed++
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func compareFixture(fixture goldenFixture, schemas map[string]DocumentSchema) ([]FieldDiff, error) {
+	schema, ok := schemas[fixture.docType]
+	if !ok {
+		return nil, fmt.Errorf("no schema for document type %s", fixture.docType)
+	}
+	got, err := parseFixture(fixture.path, schema)
+	if err != nil {
+		return nil, err
+	}
+	want, err := os.ReadFile(fixture.goldenFile)
+	if err != nil {
+		return nil, err
+	}
+	return fieldDiffs(want, got)
+}
+
+// accuracyJob runs the accuracy report and keeps the last one for the admin API
+type accuracyJob struct {
+	cfg     AccuracyConfig
+	client  *http.Client
+	schemas func() map[string]DocumentSchema
+	logger  *zap.Logger
+	last    atomic.Pointer[AccuracyReport]
+}
+
+func newAccuracyJob(cfg AccuracyConfig, transport http.RoundTripper, schemas func() map[string]DocumentSchema, logger *zap.Logger) (*accuracyJob, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.Dir == "" {
+		return nil, errors.New("accuracy.dir is required")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultAccuracyInterval
+	}
+	return &accuracyJob{
+		cfg:     cfg,
+		client:  &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		schemas: schemas,
+		logger:  logger,
+	}, nil
+}
+
+func (s *Server) startAccuracyJob() {
+	if s.accuracy == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.accuracy.cfg.Interval)
+		defer ticker.Stop()
+		for ; true; <-ticker.C {
+			s.accuracy.run()
+		}
+	}()
+}
+
+func (j *accuracyJob) run() {
+	report, err := BuildAccuracyReport(j.cfg.Dir, j.schemas())
+	if err != nil {
+		j.logger.Error("Accuracy run failed", zap.Error(err))
+		return
+	}
+	j.last.Store(report)
+
+	accuracyRegressedFields.Reset()
+	for _, result := range report.Results {
+		accuracyRegressedFields.WithLabelValues(result.DocType).Add(float64(len(result.Fields)))
+	}
+	accuracyRegressedFixtures.Set(float64(report.Regressed))
+	accuracyLastRun.Set(float64(report.RanAt.Unix()))
+
+	if report.Regressed > 0 {
+		j.logger.Warn("Golden fixtures regressed", zap.Int("regressed", report.Regressed), zap.Int("fixtures", report.Fixtures))
+	} else {
+		j.logger.Info("Golden fixtures passed", zap.Int("fixtures", report.Fixtures))
+	}
+
+	if j.cfg.ReportURL != "" {
+		if err := j.post(report); err != nil {
+			j.logger.Warn("Failed to post accuracy report", zap.Error(err))
+		}
+	}
+}
+
+func (j *accuracyJob) post(report *AccuracyReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, j.cfg.ReportURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("report-url answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Accuracy godoc
+// @Summary Last accuracy report
+// @Description returns the golden fixtures the loaded schemas no longer reproduce, as of the last accuracy run
+// @Tags Admin
+// @Produce json
+// @Router /api/v1/admin/accuracy [get]
+// @Success 200 {object} BaseResponse
+// @Failure 404 {object} BaseResponse
+func (s *Server) accuracyHandler(c fiber.Ctx) error {
+	if s.accuracy == nil {
+		return fiber.NewError(fiber.StatusNotFound, "Accuracy runs are disabled")
+	}
+	report := s.accuracy.last.Load()
+	if report == nil {
+		return fiber.NewError(fiber.StatusNotFound, "No accuracy run finished yet")
+	}
+	return c.Status(fiber.StatusOK).JSON(BaseResponse{
+		Success: true,
+		Message: "Accuracy report",
+		Data:    report,
+	})
+}
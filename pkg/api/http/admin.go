@@ -0,0 +1,148 @@
+package http
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/pprof"
+	"go.uber.org/zap"
+)
+
+const (
+	CacheScopeResults = "results"
+	CacheScopeSchemas = "schemas"
+	CacheScopeAll     = "all"
+
+	defaultAdminHost = "127.0.0.1"
+	adminPrefix      = "/api/v1/admin"
+)
+
+// registerAdminHandlers mounts the admin API under /api/v1/admin of router and the admin
+// UI under /admin
+func (s *Server) registerAdminHandlers(router fiber.Router) fiber.Router {
+	s.registerAdminUI(router)
+	router.Post("/api/v1/debug/explain", s.explainHandler, s.adminAuth, s.writable, s.maintenanceGate, s.attribution, s.admission)
+	admin := router.Group(adminPrefix, s.adminAuth)
+	admin.Delete("/cache", s.clearCacheHandler)
+	admin.Get("/read-only", s.readOnlyHandler)
+	admin.Put("/read-only", s.setReadOnlyHandler)
+	admin.Put("/access-log", s.setSlowThresholdHandler)
+	admin.Get("/schemas", s.schemasHandler)
+	admin.Put("/schemas/:docType", s.saveSchemaHandler)
+	admin.Get("/accuracy", s.accuracyHandler)
+	return admin
+}
+
+// startAdminServer serves the admin API on port-admin, bound to admin-host (localhost by
+// default) so it is never reachable through the public ingress. Profiling endpoints are
+// only exposed here.
+func (s *Server) startAdminServer() {
+	if s.config.PortAdmin == "" {
+		return
+	}
+	host := s.config.AdminHost
+	if host == "" {
+		host = defaultAdminHost
+	}
+
+	app := s.newApp()
+	s.useBaseMiddlewares(app)
+	admin := s.registerAdminHandlers(app)
+	// the admin UI tries documents against the analyze endpoint of its own listener
+	app.Post("/api/v1/test", s.testTextractorHandler, s.writable, s.maintenanceGate, s.requestSigning, s.attribution, s.admission)
+	admin.Use(pprof.New(pprof.Config{Prefix: adminPrefix}))
+
+	addr := fmt.Sprintf("%s:%s", host, s.config.PortAdmin)
+	s.logger.Info("Starting admin server", zap.String("addr", addr))
+	ln, err := s.listen(fiber.NetworkTCP4, addr)
+	if err != nil {
+		s.logger.Error("Admin server stopped", zap.Error(err))
+		return
+	}
+	if err := app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}); err != nil {
+		s.logger.Error("Admin server stopped", zap.Error(err))
+	}
+}
+
+// adminAuth only lets requests through that carry the configured admin token as a bearer token.
+// Admin routes are disabled entirely while no token is configured.
+func (s *Server) adminAuth(c fiber.Ctx) error {
+	if s.currentAdminToken() == "" {
+		return fiber.NewError(fiber.StatusForbidden, "Admin API is disabled")
+	}
+	if !s.isAdmin(c) {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid admin token")
+	}
+	return c.Next()
+}
+
+func (s *Server) currentAdminToken() string {
+	if token := s.configMapAdminToken.Load(); token != nil {
+		return *token
+	}
+	if s.adminToken != nil {
+		return s.adminToken.Value()
+	}
+	return s.config.AdminToken
+}
+
+// isAdmin reports whether the request carries the admin token, for handlers that show
+// admins more detail
+func (s *Server) isAdmin(c fiber.Ctx) bool {
+	adminToken := s.currentAdminToken()
+	if adminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// ClearCache godoc
+// @Summary Invalidate caches
+// @Description clears the result cache, reloads the schemas from disk, or both
+// @Tags Admin
+// @Produce json
+// @Param scope query string false "results, schemas or all" default(all)
+// @Router /api/v1/admin/cache [delete]
+// @Success 200 {object} BaseResponse
+func (s *Server) clearCacheHandler(c fiber.Ctx) error {
+	scope := c.Query("scope", CacheScopeAll)
+	if scope != CacheScopeResults && scope != CacheScopeSchemas && scope != CacheScopeAll {
+		return fiber.NewError(fiber.StatusBadRequest, "scope must be one of results, schemas or all")
+	}
+
+	data := fiber.Map{"scope": scope}
+
+	if scope == CacheScopeSchemas || scope == CacheScopeAll {
+		if err := s.awsService.reloadSchemas(); err != nil {
+			s.requestLogger(c).Error("Failed to reload schemas", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(BaseResponse{
+				Success: false,
+				Message: "Failed to reload schemas",
+			})
+		}
+		data["schemasReloaded"] = true
+	}
+
+	if scope == CacheScopeResults || scope == CacheScopeAll {
+		deleted, err := s.clearResultCache()
+		if err != nil {
+			s.requestLogger(c).Error("Failed to clear result cache", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(BaseResponse{
+				Success: false,
+				Message: "Failed to clear result cache",
+			})
+		}
+		data["resultsDeleted"] = deleted
+	}
+
+	s.requestLogger(c).Info("Cache invalidated", zap.String("scope", scope))
+
+	return c.Status(fiber.StatusOK).JSON(BaseResponse{
+		Success: true,
+		Message: "Cache invalidated",
+		Data:    data,
+	})
+}
@@ -0,0 +1,172 @@
+package http
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/static"
+	"go.uber.org/zap"
+)
+
+const adminUIPrefix = "/admin"
+
+// adminUI is a small ops UI for trying documents against the schemas and editing them,
+// served under /admin next to the admin API it calls
+//
+//go:embed adminui
+var adminUI embed.FS
+
+var (
+	errNoSchemaFile   = errors.New("no schema-file configured")
+	errSchemasManaged = errors.New("schemas are managed by the ConfigMap")
+)
+
+// registerAdminUI serves the embedded UI. The files are public, every API call it makes
+// carries the admin token entered in the UI.
+func (s *Server) registerAdminUI(router fiber.Router) {
+	files, err := fs.Sub(adminUI, "adminui")
+	if err != nil {
+		panic(err)
+	}
+	serve := static.New("", static.Config{FS: files})
+	router.Get(adminUIPrefix+"*", func(c fiber.Ctx) error {
+		// the page loads its assets relative to /admin/
+		if c.Path() == adminUIPrefix {
+			return c.Redirect().To(adminUIPrefix + "/")
+		}
+		return serve(c)
+	})
+}
+
+// Schemas godoc
+// @Summary Loaded schemas
+// @Description returns every loaded schema in full, keyed by docType
+// @Tags Admin
+// @Produce json
+// @Router /api/v1/admin/schemas [get]
+// @Success 200 {object} BaseResponse
+func (s *Server) schemasHandler(c fiber.Ctx) error {
+	set := s.awsService.schemas.Load()
+	return c.Status(fiber.StatusOK).JSON(BaseResponse{
+		Success: true,
+		Message: "Schemas loaded",
+		Data: fiber.Map{
+			"loadedAt":   set.loadedAt,
+			"schemas":    set.schemas,
+			"schemaFile": s.awsService.schemaFile,
+		},
+	})
+}
+
+// SaveSchema godoc
+// @Summary Save a schema
+// @Description validates the schema, writes it to the schema file and loads it
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param docType path string true "document type"
+// @Router /api/v1/admin/schemas/{docType} [put]
+// @Success 200 {object} BaseResponse
+func (s *Server) saveSchemaHandler(c fiber.Ctx) error {
+	docType := c.Params("docType")
+	var schema DocumentSchema
+	if err := json.Unmarshal(c.Body(), &schema); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid schema: %s", err))
+	}
+
+	err := s.awsService.saveSchema(docType, schema)
+	if errors.Is(err, errNoSchemaFile) {
+		return fiber.NewError(fiber.StatusConflict, "Schemas can only be edited with a schema-file configured")
+	}
+	if errors.Is(err, errSchemasManaged) {
+		return fiber.NewError(fiber.StatusConflict, "Schemas are managed by the ConfigMap, edit it instead")
+	}
+	var invalid *schemaError
+	if errors.As(err, &invalid) {
+		return fiber.NewError(fiber.StatusBadRequest, invalid.Error())
+	}
+	if err != nil {
+		s.requestLogger(c).Error("Failed to save schema", zap.Error(err), zap.String("docType", docType))
+		return c.Status(fiber.StatusInternalServerError).JSON(BaseResponse{
+			Success: false,
+			Message: "Failed to save schema",
+		})
+	}
+
+	s.requestLogger(c).Info("Schema saved", zap.String("docType", docType))
+	return c.Status(fiber.StatusOK).JSON(BaseResponse{
+		Success: true,
+		Message: "Schema saved",
+		Data:    fiber.Map{"docType": docType},
+	})
+}
+
+// schemaError is a schema rejected by validation
+type schemaError struct{ err error }
+
+func (e *schemaError) Error() string { return e.err.Error() }
+
+// saveSchema stores schema under docType in the schema file and swaps in the new set. The
+// file is only written when the whole set still validates.
+func (s *AWSService) saveSchema(docType string, schema DocumentSchema) error {
+	if s.schemaFile == "" {
+		return errNoSchemaFile
+	}
+	if s.schemaData.Load() != nil {
+		return errSchemasManaged
+	}
+	s.schemaWrite.Lock()
+	defer s.schemaWrite.Unlock()
+
+	external := make(map[string]DocumentSchema)
+	data, err := os.ReadFile(s.schemaFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if external, err = parseSchemaFile(data); err != nil {
+			return fmt.Errorf("%s: %w", s.schemaFile, err)
+		}
+	}
+	external[docType] = schema
+
+	schemas := make(map[string]DocumentSchema, len(s.schemas.Load().schemas)+1)
+	for name, current := range s.schemas.Load().schemas {
+		schemas[name] = current
+	}
+	schemas[docType] = schema
+	if err := validateSchemas(schemas); err != nil {
+		return &schemaError{err}
+	}
+
+	data, err = json.MarshalIndent(external, "", "  ")
+	if err != nil {
+		return err
+	}
+	// rename is atomic, a crash never leaves a half-written schema file behind
+	tmp, err := os.CreateTemp(filepath.Dir(s.schemaFile), ".schema-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.schemaFile); err != nil {
+		return err
+	}
+
+	s.setSchemas(schemas)
+	return nil
+}
@@ -0,0 +1,174 @@
+'use strict';
+
+// The token stays in this tab only, it is never written to localStorage.
+const tokenInput = document.getElementById('token');
+tokenInput.value = sessionStorage.getItem('adminToken') || '';
+tokenInput.addEventListener('change', () => {
+  sessionStorage.setItem('adminToken', tokenInput.value);
+  loadSchemas();
+});
+
+let schemas = {};
+
+function authHeaders() {
+  return tokenInput.value ? { Authorization: 'Bearer ' + tokenInput.value } : {};
+}
+
+async function api(method, path, body, headers) {
+  const response = await fetch(path, {
+    method,
+    body,
+    headers: Object.assign(authHeaders(), headers || {}),
+  });
+  let payload = {};
+  try {
+    payload = await response.json();
+  } catch (e) {
+    payload = { message: response.statusText };
+  }
+  return { status: response.status, payload };
+}
+
+function setMessage(id, text, isError) {
+  const element = document.getElementById(id);
+  element.textContent = text;
+  element.className = isError ? 'error' : '';
+}
+
+function fillSelect(select, values) {
+  const current = select.value;
+  select.replaceChildren(...values.map((value) => new Option(value, value)));
+  if (values.includes(current)) {
+    select.value = current;
+  }
+}
+
+async function loadSchemas() {
+  const { status, payload } = await api('GET', '/api/v1/admin/schemas');
+  if (status !== 200) {
+    setMessage('status', payload.message || 'Admin API unavailable', true);
+    return;
+  }
+  setMessage('status', '');
+  schemas = payload.data.schemas || {};
+  const docTypes = Object.keys(schemas).sort();
+  fillSelect(document.getElementById('doc-type'), docTypes);
+  fillSelect(document.getElementById('schema-doc-type'), docTypes);
+  document.getElementById('schema-file').textContent = payload.data.schemaFile
+    ? 'Saved to ' + payload.data.schemaFile
+    : 'No schema-file configured, schemas are read-only';
+  showSchema();
+}
+
+function showSchema() {
+  const docType = document.getElementById('schema-doc-type').value;
+  document.getElementById('schema-editor').value = docType ? JSON.stringify(schemas[docType], null, 2) : '';
+}
+
+document.getElementById('schema-doc-type').addEventListener('change', showSchema);
+
+document.getElementById('save-schema').addEventListener('click', async () => {
+  const docType = document.getElementById('new-doc-type').value.trim() ||
+    document.getElementById('schema-doc-type').value;
+  const text = document.getElementById('schema-editor').value;
+  try {
+    JSON.parse(text);
+  } catch (e) {
+    setMessage('schema-message', 'Invalid JSON: ' + e.message, true);
+    return;
+  }
+  const { status, payload } = await api('PUT', '/api/v1/admin/schemas/' + encodeURIComponent(docType), text, {
+    'Content-Type': 'application/json',
+  });
+  setMessage('schema-message', payload.message, status !== 200);
+  if (status === 200) {
+    document.getElementById('new-doc-type').value = '';
+    await loadSchemas();
+    document.getElementById('schema-doc-type').value = docType;
+    showSchema();
+  }
+});
+
+// Bounding boxes are fractions of the page, so they scale with the preview image.
+// Only the first page is previewed; PDFs are shown without a preview.
+function drawBoxes(fields) {
+  const overlay = document.getElementById('overlay');
+  overlay.replaceChildren();
+  for (const [field, provenance] of Object.entries(fields || {})) {
+    const box = provenance.boundingBox;
+    if (!box || provenance.page > 1) {
+      continue;
+    }
+    const element = document.createElement('div');
+    element.className = 'box';
+    element.dataset.field = field;
+    element.style.left = box.Left * 100 + '%';
+    element.style.top = box.Top * 100 + '%';
+    element.style.width = box.Width * 100 + '%';
+    element.style.height = box.Height * 100 + '%';
+    const label = document.createElement('span');
+    label.textContent = field;
+    element.appendChild(label);
+    overlay.appendChild(element);
+  }
+}
+
+function highlight(field, on) {
+  for (const element of document.querySelectorAll('.box')) {
+    element.classList.toggle('highlight', on && element.dataset.field === field);
+  }
+}
+
+function showFields(docType, data) {
+  const tbody = document.querySelector('#fields tbody');
+  tbody.replaceChildren();
+  const extracted = data.extractedInfo || {};
+  const provenance = data.fields || {};
+  const schema = schemas[docType] || {};
+  const names = new Set([
+    ...Object.keys(schema.fields || {}),
+    ...Object.keys(schema.computed || {}),
+    ...Object.keys(extracted),
+  ]);
+  for (const field of [...names].sort()) {
+    const row = tbody.insertRow();
+    const found = field in extracted;
+    row.className = found ? '' : 'missing';
+    const source = provenance[field] || {};
+    const lowConfidence = (data.lowConfidence || {})[field];
+    const value = found ? extracted[field] : lowConfidence ? lowConfidence.value + ' (low confidence)' : 'not found';
+    for (const text of [field, value, source.confidence ? source.confidence.toFixed(1) : '', source.strategy || '']) {
+      row.insertCell().textContent = text;
+    }
+    row.addEventListener('mouseenter', () => highlight(field, true));
+    row.addEventListener('mouseleave', () => highlight(field, false));
+  }
+}
+
+document.getElementById('analyze-form').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  const form = new FormData(event.target);
+  form.set('verbosity', 'debug');
+  const docType = form.get('docType');
+  const file = document.getElementById('document').files[0];
+
+  const image = document.getElementById('preview-image');
+  if (image.src) {
+    URL.revokeObjectURL(image.src);
+  }
+  image.removeAttribute('src');
+  if (file && file.type.startsWith('image/')) {
+    image.src = URL.createObjectURL(file);
+  }
+
+  setMessage('analyze-message', 'Analyzing...');
+  const { status, payload } = await api('POST', '/api/v1/test', form);
+  setMessage('analyze-message', status + ' ' + (payload.code ? payload.code + ': ' : '') + payload.message, status >= 300);
+  document.getElementById('response').textContent = JSON.stringify(payload, null, 2);
+
+  const data = payload.data || {};
+  drawBoxes(data.fields);
+  showFields(docType, data);
+});
+
+loadSchemas();
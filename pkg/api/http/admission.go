@@ -0,0 +1,108 @@
+package http
+
+import (
+	"runtime/metrics"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// ErrCodeOverloaded is returned for analyses rejected by admission control
+	ErrCodeOverloaded = "OVERLOADED"
+
+	AdmissionAdmitted         = "admitted"
+	AdmissionRejectedQueue    = "rejected_queue"
+	AdmissionRejectedInFlight = "rejected_in_flight"
+	AdmissionRejectedMemory   = "rejected_memory"
+
+	defaultAdmissionRetryAfter = 10 * time.Second
+	heapObjectsMetric          = "/memory/classes/heap/objects:bytes"
+)
+
+// AdmissionConfig rejects new analyses with 503 and Retry-After instead of accepting
+// everything and running out of memory. Zero limits are disabled.
+type AdmissionConfig struct {
+	// MaxQueued is the number of analyses allowed to wait for a Textract slot
+	MaxQueued int `mapstructure:"max-queued"`
+	// MaxInFlight is the number of analyses processed at once, including waiting ones
+	MaxInFlight int `mapstructure:"max-in-flight"`
+	// MaxHeapMB is the live heap size in megabytes above which analyses are rejected
+	MaxHeapMB  int64         `mapstructure:"max-heap-mb"`
+	RetryAfter time.Duration `mapstructure:"retry-after"`
+}
+
+var admissionCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "admission",
+	Name:      "decisions_total",
+	Help:      "The number of analyze requests admitted or rejected by admission control.",
+}, []string{"decision"})
+
+var inFlightGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Subsystem: "admission",
+	Name:      "in_flight_analyses",
+	Help:      "The number of analyses currently being processed.",
+})
+
+func init() {
+	prometheus.MustRegister(admissionCounter)
+	prometheus.MustRegister(inFlightGauge)
+}
+
+// admission decides whether an analyze request is started, based on the analyses in
+// flight, the Textract queue depth and the heap size
+func (s *Server) admission(c fiber.Ctx) error {
+	cfg := s.config.Admission
+	decision := AdmissionAdmitted
+	switch {
+	case cfg.MaxInFlight > 0 && s.inFlight.Load() >= int64(cfg.MaxInFlight):
+		decision = AdmissionRejectedInFlight
+	case cfg.MaxQueued > 0 && s.queuedAnalyses() >= int64(cfg.MaxQueued):
+		decision = AdmissionRejectedQueue
+	case cfg.MaxHeapMB > 0 && heapBytes()>>20 >= uint64(cfg.MaxHeapMB):
+		decision = AdmissionRejectedMemory
+	}
+	admissionCounter.WithLabelValues(decision).Inc()
+
+	if decision != AdmissionAdmitted {
+		retryAfter := cfg.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = defaultAdmissionRetryAfter
+		}
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(retryAfter.Seconds())))
+		return c.Status(fiber.StatusServiceUnavailable).JSON(BaseResponse{
+			Success: false,
+			Message: "Server is overloaded, retry later",
+			Code:    ErrCodeOverloaded,
+		})
+	}
+
+	s.inFlight.Add(1)
+	inFlightGauge.Inc()
+	defer func() {
+		s.inFlight.Add(-1)
+		inFlightGauge.Dec()
+	}()
+	return c.Next()
+}
+
+// queuedAnalyses returns the number of analyses waiting for a Textract slot in any pool
+func (s *Server) queuedAnalyses() int64 {
+	var queued int64
+	for _, pool := range s.priorities {
+		queued += pool.waiting.Load()
+	}
+	return queued
+}
+
+// heapBytes reads the live heap size without stopping the world like runtime.ReadMemStats
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// SeverityWarning reports a failed assertion next to the extracted fields
+	SeverityWarning = "warning"
+	// SeverityError fails the extraction
+	SeverityError = "error"
+)
+
+// ErrCodeValidationFailed is returned when an assertion with error severity fails
+const ErrCodeValidationFailed = "VALIDATION_FAILED"
+
+// Assertion is a consistency check over the extracted and computed fields, e.g.
+// "date(tarih) <= now()" or "gonderenIban != aliciIban"
+type Assertion struct {
+	Name  string `json:"name"`
+	Check string `json:"check"`
+	// Severity is warning or error, empty means warning
+	Severity string `json:"severity,omitempty"`
+	// Message describes the violation, the check itself is used when empty
+	Message string `json:"message,omitempty"`
+}
+
+// Violation is a failed assertion
+type Violation struct {
+	Name     string `json:"name"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// ValidationError lists the failed assertions when at least one has error severity
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		names[i] = violation.Name
+	}
+	return fmt.Sprintf("validation failed: %s", strings.Join(names, ", "))
+}
+
+// validateAssertions checks that the assertions of a schema are named, parse and have a
+// known severity
+func validateAssertions(docType string, schema DocumentSchema) []string {
+	var problems []string
+	names := make(map[string]bool, len(schema.Assertions))
+	for i, assertion := range schema.Assertions {
+		name := assertion.Name
+		if name == "" {
+			name = fmt.Sprintf("assertions[%d]", i)
+			problems = append(problems, fmt.Sprintf("%s.%s: name is required", docType, name))
+		} else if names[name] {
+			problems = append(problems, fmt.Sprintf("%s.%s: duplicate assertion name", docType, name))
+		}
+		names[name] = true
+
+		if _, err := parseExpr(assertion.Check); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.%s: invalid check: %s", docType, name, err))
+		}
+		switch assertion.Severity {
+		case "", SeverityWarning, SeverityError:
+		default:
+			problems = append(problems, fmt.Sprintf("%s.%s: severity must be warning or error", docType, name))
+		}
+	}
+	return problems
+}
+
+// checkAssertions evaluates the assertions of the schema. An assertion over a field that
+// was not extracted is skipped; one that does not evaluate to a boolean is a violation.
+func (p *ReceiptParser) checkAssertions(extractedInfo ExtractedInfo) error {
+	env := &parserEnv{parser: p, extractedInfo: extractedInfo}
+	failed := false
+	for _, assertion := range p.schema.Assertions {
+		e, err := parseExpr(assertion.Check)
+		if err != nil {
+			p.tracef("Invalid check for assertion %s: %s", assertion.Name, err)
+			continue
+		}
+
+		severity := assertion.Severity
+		if severity == "" {
+			severity = SeverityWarning
+		}
+		message := assertion.Message
+		if message == "" {
+			message = assertion.Check
+		}
+
+		value, err := e.eval(env)
+		if errors.Is(err, errMissingField) {
+			p.tracef("Skipped assertion %s: %s", assertion.Name, err)
+			continue
+		}
+		var ok bool
+		if err == nil {
+			ok, err = value.boolean()
+		}
+		if err != nil {
+			message = fmt.Sprintf("%s: %s", message, err)
+		}
+		if err == nil && ok {
+			p.tracef("Assertion %s passed", assertion.Name)
+			continue
+		}
+
+		p.violations = append(p.violations, Violation{Name: assertion.Name, Message: message, Severity: severity})
+		p.tracef("Assertion %s failed: %s", assertion.Name, message)
+		failed = failed || severity == SeverityError
+	}
+
+	if failed {
+		return &ValidationError{Violations: p.violations}
+	}
+	return nil
+}
+
+// parserEnv evaluates expressions against the fields and tables of a parse
+type parserEnv struct {
+	parser        *ReceiptParser
+	extractedInfo ExtractedInfo
+}
+
+func (e *parserEnv) field(name string) (string, bool) {
+	value, ok := e.extractedInfo[name]
+	return value, ok
+}
+
+func (e *parserEnv) column(header, title string) []string {
+	var cells []string
+	for _, t := range e.parser.documentTables() {
+		if title != "" && !strings.Contains(t.title, title) {
+			continue
+		}
+		column, ok := t.headerColumn(header)
+		if !ok {
+			continue
+		}
+		for _, pos := range t.positions() {
+			if cell := t.cells[pos]; pos.column == column && !cell.header && cell.text != "" {
+				cells = append(cells, cell.text)
+			}
+		}
+	}
+	return cells
+}
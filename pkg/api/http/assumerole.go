@@ -0,0 +1,69 @@
+package http
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+const defaultRoleSessionName = "cbomdekont"
+
+// AssumeRoleConfig makes the AWS calls with a role assumed through the configured
+// credentials, e.g. a role in a customer account trusting ours
+type AssumeRoleConfig struct {
+	RoleARN string `mapstructure:"role_arn"`
+	// ExternalID is the sts:ExternalId the trust policy of the role requires
+	ExternalID  string        `mapstructure:"external_id"`
+	SessionName string        `mapstructure:"session_name"`
+	Duration    time.Duration `mapstructure:"duration"`
+	// Tags are session tags, e.g. tenant: acme; the trust policy must allow sts:TagSession.
+	// Keys are lowercase since config keys are case-insensitive.
+	Tags map[string]string `mapstructure:"tags"`
+}
+
+func (cfg AssumeRoleConfig) validate() error {
+	if !strings.HasPrefix(cfg.RoleARN, "arn:") || !strings.Contains(cfg.RoleARN, ":role/") {
+		return fmt.Errorf("aws.assume_role.role_arn must be a role ARN, got %q", cfg.RoleARN)
+	}
+	if cfg.Duration != 0 && (cfg.Duration < 15*time.Minute || cfg.Duration > 12*time.Hour) {
+		return fmt.Errorf("aws.assume_role.duration must be between 15m and 12h")
+	}
+	return nil
+}
+
+// assumeRoleCredentials assumes the role with the credentials of base; the temporary
+// credentials are renewed shortly before they expire
+func assumeRoleCredentials(cfg AssumeRoleConfig, base aws.Config) (aws.CredentialsProvider, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	tags := make([]types.Tag, 0, len(cfg.Tags))
+	for key, value := range cfg.Tags {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	sort.Slice(tags, func(i, j int) bool { return *tags[i].Key < *tags[j].Key })
+
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(base), cfg.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = cfg.SessionName
+		if o.RoleSessionName == "" {
+			o.RoleSessionName = defaultRoleSessionName
+		}
+		if cfg.ExternalID != "" {
+			o.ExternalID = aws.String(cfg.ExternalID)
+		}
+		if cfg.Duration > 0 {
+			o.Duration = cfg.Duration
+		}
+		o.Tags = tags
+	})
+	return aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = time.Minute
+		o.ExpiryWindowJitterFrac = 0.5
+	}), nil
+}
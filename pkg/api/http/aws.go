@@ -3,16 +3,22 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"mime/multipart"
+	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/textract"
 	"github.com/aws/aws-sdk-go-v2/service/textract/types"
 	"github.com/gofiber/fiber/v3"
+	"github.com/mehmetsafabenli/cbomdekont/pkg/logging"
 	"go.uber.org/zap"
 )
 
@@ -77,95 +83,342 @@ type Relationship struct {
 type ExtractedInfo map[string]string
 
 type AWSConfig struct {
-	AccessKeyID     string `mapstructure:"access_key_id"`
-	SecretAccessKey string `mapstructure:"secret_access_key"`
-	Region          string `mapstructure:"region"`
+	AccessKeyID         string      `mapstructure:"access_key_id"`
+	SecretAccessKey     string      `mapstructure:"secret_access_key"`
+	AccessKeyIDFile     string      `mapstructure:"access_key_id_file"`
+	SecretAccessKeyFile string      `mapstructure:"secret_access_key_file"`
+	Vault               VaultConfig `mapstructure:"vault"`
+	Region              string      `mapstructure:"region"`
+	// AssumeRole is assumed with the credentials above for every AWS call
+	AssumeRole AssumeRoleConfig `mapstructure:"assume_role"`
+	// Client tunes retries, timeouts and trusted roots of the SDK clients
+	Client AWSClientConfig `mapstructure:"client"`
+	// Egress is shared with the server config
+	Egress EgressConfig `mapstructure:"egress"`
+	// Simulator replaces Textract, read from the textract-simulator key
+	Simulator SimulatorConfig `mapstructure:"textract-simulator"`
 }
 
 type AWSService struct {
 	textractClient *textract.Client
-	logger         *zap.Logger
-	schemas        map[string]DocumentSchema
+	// simulator answers instead of textractClient in load tests
+	simulator    *textractSimulator
+	logger       *zap.Logger
+	parserLogger *zap.Logger
+	schemaFile   string
+	schemas      atomic.Pointer[schemaSet]
+	// schemaData is the schema file of the ConfigMap, used instead of schemaFile once set
+	schemaData atomic.Pointer[[]byte]
+	// schemaWrite serializes schema edits from the admin UI
+	schemaWrite sync.Mutex
 }
 
 func NewAWSService(logger *zap.Logger, cfg *AWSConfig, schemaFile string) (*AWSService, error) {
-	ctx := context.Background()
-	awsCfg, err := config.LoadDefaultConfig(
-		ctx,
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")),
-		config.WithRegion(cfg.Region),
-	)
+	schemas, err := loadSchemas(schemaFile)
 	if err != nil {
 		return nil, err
 	}
 
-	textractClient := textract.NewFromConfig(awsCfg)
+	service := &AWSService{
+		logger:       logger.Named("aws"),
+		parserLogger: logger.Named("parser"),
+		schemaFile:   schemaFile,
+	}
+	service.setSchemas(schemas)
 
-	schemas, err := loadSchemas(schemaFile)
+	if cfg.Simulator.Enabled {
+		simulator, err := newTextractSimulator(cfg.Simulator)
+		if err != nil {
+			return nil, err
+		}
+		service.simulator = simulator
+		service.logger.Warn("Textract simulator enabled, documents are answered with fixtures",
+			zap.String("fixtures", cfg.Simulator.Fixtures),
+			zap.Duration("latency", cfg.Simulator.Latency),
+			zap.Float64("errorRate", cfg.Simulator.ErrorRate))
+		return service, nil
+	}
+
+	awsCfg, err := loadAWSConfig(context.Background(), cfg)
 	if err != nil {
 		return nil, err
 	}
+	service.textractClient = textract.NewFromConfig(awsCfg)
+
+	return service, nil
+}
+
+func loadAWSConfig(ctx context.Context, cfg *AWSConfig) (aws.Config, error) {
+	transport, err := cfg.Egress.transport()
+	if err != nil {
+		return aws.Config{}, err
+	}
+	credentialsProvider, err := newCredentialsProvider(cfg, transport)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	// SDK istemcisi kendi zaman aşımları ve CA'larıyla egress ayarlarından geçer
+	httpClient, err := cfg.Client.httpClient(cfg.Egress)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	retryOptions, err := cfg.Client.loadOptions()
+	if err != nil {
+		return aws.Config{}, err
+	}
+	awsCfg, err := config.LoadDefaultConfig(
+		ctx,
+		append([]func(*config.LoadOptions) error{
+			config.WithCredentialsProvider(credentialsProvider),
+			config.WithRegion(cfg.Region),
+			config.WithHTTPClient(httpClient),
+		}, retryOptions...)...,
+	)
+	if err != nil || cfg.AssumeRole.RoleARN == "" {
+		return awsCfg, err
+	}
+	// Müşteri hesabındaki rol bizim kimlik bilgilerimizle üstlenilir
+	awsCfg.Credentials, err = assumeRoleCredentials(cfg.AssumeRole, awsCfg)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	return awsCfg, nil
+}
+
+// newCredentialsProvider prefers short-lived Vault credentials, then mounted secret files,
+// which are re-read on rotation, and finally static keys
+func newCredentialsProvider(cfg *AWSConfig, transport http.RoundTripper) (aws.CredentialsProvider, error) {
+	if cfg.Vault.Address != "" {
+		return newVaultCredentials(cfg.Vault, transport)
+	}
+	if cfg.AccessKeyIDFile == "" && cfg.SecretAccessKeyFile == "" {
+		return credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""), nil
+	}
 
-	return &AWSService{
-		textractClient: textractClient,
-		logger:         logger,
-		schemas:        schemas,
-	}, nil
+	accessKeyID, err := NewSecretFile(cfg.AccessKeyIDFile)
+	if err != nil {
+		return nil, fmt.Errorf("aws access key id file: %w", err)
+	}
+	secretAccessKey, err := NewSecretFile(cfg.SecretAccessKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("aws secret access key file: %w", err)
+	}
+	return &secretFileCredentials{accessKeyID: accessKeyID, secretAccessKey: secretAccessKey}, nil
 }
+
+// loadSchemas merges the schemas embedded in the binary with the external schema file,
+// where docTypes from the file override the embedded ones. A missing file is not an error.
 func loadSchemas(schemaFile string) (map[string]DocumentSchema, error) {
-	f, err := os.Open(schemaFile)
+	schemas, err := loadEmbeddedSchemas()
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	data, err := io.ReadAll(f)
-	if err != nil {
+	if schemaFile != "" {
+		data, err := os.ReadFile(schemaFile)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			if err := mergeSchemaFile(schemas, data); err != nil {
+				return nil, fmt.Errorf("%s: %w", schemaFile, err)
+			}
+		}
+	}
+
+	if err := validateSchemas(schemas); err != nil {
 		return nil, err
 	}
-	var schemas map[string]DocumentSchema
-	err = json.Unmarshal(data, &schemas)
+
+	return schemas, nil
+}
+
+// mergeSchemaFile adds the schemas of a schema file to schemas, overriding its docTypes
+func mergeSchemaFile(schemas map[string]DocumentSchema, data []byte) error {
+	external, err := parseSchemaFile(data)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	for docType, schema := range external {
+		schemas[docType] = schema
 	}
+	return nil
+}
 
+// parseSchemaFile decodes a schema file holding one schema per docType
+func parseSchemaFile(data []byte) (map[string]DocumentSchema, error) {
+	var schemas map[string]DocumentSchema
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		return nil, err
+	}
 	return schemas, nil
 }
 
 func (s *Server) testTextractorHandler(c fiber.Ctx) error {
+	timings := newPipelineTimings(s.stageDurations)
+
+	// Yarım kalan yüklemeleri Textract'a göndermeyelim
+	if err := readBody(c); err != nil {
+		return s.abortedUpload(c, err)
+	}
+
 	// Get the file from form data
 	file, err := c.FormFile(Document)
 	if err != nil {
-		s.logger.Error("Failed to get file from form data", zap.Error(err))
+		s.requestLogger(c).Error("Failed to get file from form data", zap.Error(err))
 		return fiber.NewError(fiber.StatusBadRequest, "Failed to get file from form data")
 	}
 
 	// Get the document type from form data
 	docType := c.FormValue("docType")
 	if docType == "" {
-		s.logger.Error("Document type not provided")
+		s.requestLogger(c).Error("Document type not provided")
 		return fiber.NewError(fiber.StatusBadRequest, "Document type not provided")
 	}
 
 	// Open the file
 	fileContent, err := file.Open()
 	if err != nil {
-		s.logger.Error("Failed to open file", zap.Error(err))
+		s.requestLogger(c).Error("Failed to open file", zap.Error(err))
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to open file"})
 	}
 	defer func(fileContent multipart.File) {
 		err := fileContent.Close()
 		if err != nil {
-			s.logger.Error("Failed to close file", zap.Error(err))
+			s.requestLogger(c).Error("Failed to close file", zap.Error(err))
 		}
 	}(fileContent)
 
-	// Read the file content
-	fileBytes, err := io.ReadAll(fileContent)
+	// Read the file content; the response is written before analyzeDocument returns, so
+	// the buffer can go back to the pool afterwards
+	fileBytes, release, err := readPooled(fileContent, file.Size)
 	if err != nil {
-		s.logger.Error("Failed to read file content", zap.Error(err))
+		s.requestLogger(c).Error("Failed to read file content", zap.Error(err))
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read file content"})
 	}
+	defer release()
+	timings.track(StageUploadRead, timings.start)
+
+	return s.analyzeDocument(c, fileBytes, docType, timings)
+}
+
+// analyzeDocument runs the document through preprocessing, Textract and the schema parser
+// and writes the response. It is shared by the direct and the resumable upload endpoints,
+// which pass in the timings started when the request arrived.
+func (s *Server) analyzeDocument(c fiber.Ctx, fileBytes []byte, docType string, timings *pipelineTimings) error {
+	var err error
+	// takma adlar asıl docType'a çevrilsin, bilinmeyen tipler Textract'a gitmeden reddedilsin
+	canonical, ok := s.awsService.resolveDocType(docType)
+	if !ok {
+		return s.unknownDocType(c, docType)
+	}
+	if canonical != docType {
+		s.addLogFields(c, zap.String("docTypeAlias", docType))
+		docType = canonical
+	}
+	s.setDocType(c, docType)
+	// boyut ön işlemeden önce, istemcinin gönderdiği haliyle ölçülsün
+	s.documentSizes.WithLabelValues(s.docTypeLabel(docType)).Observe(float64(len(fileBytes)))
+
+	parseMode := c.FormValue(ParseMode, s.config.ParseMode)
+	if parseMode == "" {
+		parseMode = ParseModeLenient
+	}
+	if parseMode != ParseModeLenient && parseMode != ParseModeStrict {
+		return fiber.NewError(fiber.StatusBadRequest, "parseMode must be lenient or strict")
+	}
+	verbosity, err := s.requestVerbosity(c)
+	if err != nil {
+		return err
+	}
+	priority, err := s.requestPriority(c)
+	if err != nil {
+		return err
+	}
+	// explain istekleri her zaman Textract'tan geçer ve tüm ayrıntıyı döner
+	explain, _ := c.Locals("explain").(bool)
+	if explain {
+		verbosity = VerbosityDebug
+	}
+
+	// qpdf, heif-convert and Textract calls end when the client disconnects
+	ctx, stop := s.disconnectContext(c)
+	defer stop()
+
+	preprocessStart := time.Now()
+
+	// Şifreli PDF'leri Textract'a göndermeden önce çözelim
+	if isEncryptedPDF(fileBytes) {
+		passwords := s.config.PDFPasswords
+		if password := c.FormValue(PDFPassword); password != "" {
+			passwords = append([]string{password}, passwords...)
+		}
+
+		fileBytes, err = decryptPDF(ctx, s.config.QpdfPath, fileBytes, passwords)
+		switch {
+		case errors.Is(err, errPDFPasswordRequired):
+			return s.respond(c, docType, fiber.StatusUnprocessableEntity, BaseResponse{
+				Success: false,
+				Message: "Document is password protected, pdfPassword is required",
+				Code:    ErrCodePDFPasswordRequired,
+			})
+		case errors.Is(err, errPDFPasswordInvalid):
+			return s.respond(c, docType, fiber.StatusUnprocessableEntity, BaseResponse{
+				Success: false,
+				Message: "Invalid PDF password",
+				Code:    ErrCodePDFPasswordInvalid,
+			})
+		case errors.Is(err, errPDFUnreadable):
+			settleDocument(c)
+			s.requestLogger(c).Warn("Failed to open PDF", zap.Error(err))
+			return s.respond(c, docType, fiber.StatusUnprocessableEntity, BaseResponse{
+				Success: false,
+				Message: "Document is a corrupt or unreadable PDF",
+				Code:    ErrCodePDFUnreadable,
+			})
+		case err != nil && ctx.Err() != nil:
+			return s.requestCancelled(c, StagePreprocess, err)
+		case err != nil:
+			s.requestLogger(c).Error("Failed to decrypt PDF", zap.Error(err))
+			return s.respond(c, docType, fiber.StatusInternalServerError, BaseResponse{
+				Success: false,
+				Message: "Failed to decrypt document",
+			})
+		}
+	}
+
+	// HEIC/WebP gibi Textract'ın desteklemediği formatları JPEG'e çevirelim
+	fileBytes, err = s.preprocessDocument(ctx, fileBytes)
+	if err != nil && ctx.Err() != nil {
+		return s.requestCancelled(c, StagePreprocess, err)
+	}
+	if err != nil {
+		s.requestLogger(c).Error("Failed to preprocess document", zap.Error(err))
+		return s.respond(c, docType, fiber.StatusUnprocessableEntity, BaseResponse{
+			Success: false,
+			Message: "Unsupported or corrupt image",
+		})
+	}
+	timings.track(StagePreprocess, preprocessStart)
+
+	// Derlemeye eklenen hook'lar dokümanı önbellekten ve Textract'tan önce görsün
+	analysis := &AnalysisRequest{DocType: docType, Document: fileBytes, FormValue: func(key string) string { return c.FormValue(key) }}
+	if err := s.runPreAnalysisHooks(c.UserContext(), analysis); err != nil {
+		return s.hookFailed(c, docType, err)
+	}
+	fileBytes = analysis.Document
+
+	// Aynı doküman daha önce işlendiyse önbellekten dönelim
+	cacheKey := resultCacheKey(docType, fileBytes)
+	if extractedInfo, ok := s.getCachedResult(cacheKey); ok && !explain {
+		settleDocument(c)
+		return s.respond(c, docType, fiber.StatusOK, BaseResponse{
+			Success: true,
+			Message: "Information extracted successfully",
+			Data:    extractionData(docType, verbosity, extractedInfo, nil, timings),
+		})
+	}
 
 	// Create Textract input
 	input := &textract.AnalyzeDocumentInput{
@@ -178,73 +431,224 @@ func (s *Server) testTextractorHandler(c fiber.Ctx) error {
 		},
 	}
 
+	// Bulk importlar dashboard isteklerini aç bırakmasın diye önceliğe göre sıraya girelim
+	queueStart := time.Now()
+	release, err := priority.acquire(ctx)
+	timings.track(StageQueue, queueStart)
+	if err != nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Request cancelled while waiting for a Textract slot")
+	}
+	defer release()
+
 	// Call Textract service
-	rawResult, err := s.awsService.textractClient.AnalyzeDocument(c.Context(), input)
+	timeout := s.config.TextractTimeouts.forDocType(docType).Sync
+	textractCtx, cancelTextract := context.WithTimeout(ctx, timeout)
+	textractStart := time.Now()
+	rawResult, err := s.awsService.analyze(textractCtx, docType, input)
+	timings.track(StageTextract, textractStart)
+	cancelTextract()
+	// istek iptal edilmeden süre dolduysa Textract'ı bekleyemedik demektir
+	if err != nil && errors.Is(textractCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		textractTimeoutsCounter.WithLabelValues(s.docTypeLabel(docType)).Inc()
+		s.requestLogger(c).Error("Textract timed out", zap.Duration("timeout", timeout), zap.Error(err))
+		return s.respond(c, docType, fiber.StatusGatewayTimeout, BaseResponse{
+			Success: false,
+			Message: fmt.Sprintf("Textract did not answer within %s", timeout),
+		})
+	}
+	if err != nil && ctx.Err() != nil {
+		return s.requestCancelled(c, StageTextract, err)
+	}
 	if err != nil {
-		s.logger.Error("Failed to analyze document with Textract", zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).JSON(BaseResponse{
+		s.requestLogger(c).Error("Failed to analyze document with Textract", zap.Error(err))
+		s.captureError(c, "textract", err)
+		return s.respond(c, docType, fiber.StatusInternalServerError, BaseResponse{
 			Success: false,
 			Message: "Failed to analyze document",
 		})
 	}
 
-	// Ham Textract sonucunu loglayalım
-	s.logger.Debug("Raw Textract result", zap.Any("result", rawResult))
+	// Ham Textract sonucu megabaytlarca olabilir, yalnızca özetini loglayalım
+	var pages int32
+	if rawResult.DocumentMetadata != nil {
+		pages = aws.ToInt32(rawResult.DocumentMetadata.Pages)
+	}
+	s.requestLogger(c).Debug("Textract result", zap.Int("blocks", len(rawResult.Blocks)), zap.Int32("pages", pages))
+	if pages > 0 {
+		s.documentPages.WithLabelValues(s.docTypeLabel(docType)).Observe(float64(pages))
+	}
+	countTextractPages(c, pages)
 
 	// Extract information based on the document type
-	extractedInfo, err := s.awsService.extractInfo(rawResult.Blocks, docType)
+	options := ParseOptions{Mode: parseMode, MinConfidence: s.config.MinConfidence, Explain: explain}
+	parseStart := time.Now()
+	extractedInfo, parser, err := s.awsService.extractInfo(c.UserContext(), rawResult.Blocks, docType, options)
+	timings.track(StageParse, parseStart)
+	// Kişisel veriler önbelleğe ya da yanıta yazılmadan önce maskelensin
+	if extractedInfo != nil {
+		s.convertCurrency(c.UserContext(), extractedInfo, parser)
+		if err == nil {
+			err = s.runPostExtractionHooks(c.UserContext(), docType, extractedInfo, parser)
+		}
+		s.maskPII(extractedInfo, parser)
+	}
+	var malformed *MalformedBlocksError
+	var invalid *ValidationError
+	if err == nil || errors.As(err, &malformed) || errors.As(err, &invalid) || errors.Is(err, errNothingExtracted) {
+		settleDocument(c)
+	}
+	if errors.As(err, &malformed) {
+		s.requestLogger(c).Warn("Rejected malformed Textract output", zap.Strings("problems", malformed.Problems))
+		s.captureSample(docType, SampleReasonMalformed, rawResult.Blocks)
+		return s.respond(c, docType, fiber.StatusUnprocessableEntity, BaseResponse{
+			Success: false,
+			Message: "Textract output contains malformed blocks",
+			Code:    ErrCodeMalformedBlocks,
+			Data:    fiber.Map{"problems": malformed.Problems},
+		})
+	}
+	if errors.As(err, &invalid) {
+		s.requestLogger(c).Warn("Extracted fields failed validation", zap.Any("violations", invalid.Violations))
+		s.captureSample(docType, SampleReasonValidation, rawResult.Blocks)
+		data := fiber.Map{"violations": invalid.Violations, "extractedInfo": extractedInfo}
+		if breakdown := parser.TaxBreakdown(); breakdown != nil {
+			data["taxBreakdown"] = breakdown
+		}
+		if explanation := parser.Explanation(); explanation != nil {
+			data["explain"] = explanation
+		}
+		return s.respond(c, docType, fiber.StatusUnprocessableEntity, BaseResponse{
+			Success: false,
+			Message: "Extracted fields failed validation",
+			Code:    ErrCodeValidationFailed,
+			Data:    data,
+		})
+	}
+	if errors.Is(err, errSchemaNotFound) {
+		// şema istek sürerken kaldırılmış
+		return s.unknownDocType(c, docType)
+	}
+	if errors.Is(err, errNothingExtracted) {
+		report := s.awsService.failureReport(docType, parser)
+		s.requestLogger(c).Warn("Nothing extracted from document", zap.Any("report", report))
+		s.captureSample(docType, SampleReasonNothingExtracted, rawResult.Blocks)
+		data := fiber.Map{"report": report}
+		if explanation := parser.Explanation(); explanation != nil {
+			data["explain"] = explanation
+		}
+		// Ham Textract çıktısı büyük ve hassas, yalnızca admin debug isteklerinde dönelim
+		if verbosity == VerbosityDebug && s.isAdmin(c) {
+			data["raw"] = rawResult
+		}
+		return s.respond(c, docType, fiber.StatusUnprocessableEntity, BaseResponse{
+			Success: false,
+			Message: "No information could be extracted from the document",
+			Code:    ErrCodeNothingExtracted,
+			Data:    data,
+		})
+	}
+	var rejected *HookError
+	if errors.As(err, &rejected) {
+		return s.hookFailed(c, docType, err)
+	}
 	if err != nil {
-		s.logger.Error("Failed to extract information", zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).JSON(BaseResponse{
+		s.requestLogger(c).Error("Failed to extract information", zap.Error(err))
+		s.captureError(c, "extract", err)
+		return s.respond(c, docType, fiber.StatusInternalServerError, BaseResponse{
 			Success: false,
 			Message: "Failed to extract information",
-			Data:    rawResult, // Ham veriyi de dönelim
 		})
 	}
 
-	// Hem extract edilmiş bilgiyi hem de ham veriyi döndürelim
-	return c.Status(fiber.StatusOK).JSON(BaseResponse{
+	// Yeni işlenen doküman bildirim kurallarına uyuyorsa haber verelim
+	s.notify(c, docType, extractedInfo, parser)
+
+	// Zorunlu alanların bir kısmı bulunamadıysa istemci kullanıcıdan isteyebilsin diye 206 dönelim
+	if missing := parser.Missing(); len(missing) > 0 {
+		s.requestLogger(c).Info("Required fields missing", zap.Strings("missingFields", missing))
+		data := extractionData(docType, verbosity, extractedInfo, parser, timings)
+		data["missingFields"] = missing
+		return s.respond(c, docType, fiber.StatusPartialContent, BaseResponse{
+			Success: true,
+			Message: "Some required fields could not be extracted",
+			Code:    CodePartialResult,
+			Data:    data,
+		})
+	}
+
+	// Atlanan blok, düşük güvenli alan ya da tutarsızlık varsa sonucu önbelleğe almayalım
+	if len(parser.Warnings()) == 0 && len(parser.LowConfidence()) == 0 && len(parser.Violations()) == 0 {
+		persistStart := time.Now()
+		s.setCachedResult(cacheKey, extractedInfo)
+		timings.track(StagePersist, persistStart)
+	}
+
+	return s.respond(c, docType, fiber.StatusOK, BaseResponse{
 		Success: true,
 		Message: "Information extracted successfully",
-		Data: fiber.Map{
-			"extractedInfo": extractedInfo,
-		},
+		Data:    extractionData(docType, verbosity, extractedInfo, parser, timings),
 	})
 }
 
-func (s *AWSService) extractInfo(blocks []types.Block, docType string) (ExtractedInfo, error) {
-	schema, ok := s.schemas[docType]
+// analyze calls Textract, or the simulator when one is configured
+func (s *AWSService) analyze(ctx context.Context, docType string, input *textract.AnalyzeDocumentInput) (*textract.AnalyzeDocumentOutput, error) {
+	if s.simulator != nil {
+		return s.simulator.analyze(ctx, docType)
+	}
+	return s.textractClient.AnalyzeDocument(ctx, input)
+}
+
+// extractInfo parses the blocks with the schema of docType. The returned parser reports
+// the skipped malformed blocks and the low-confidence values. When an assertion with
+// error severity fails the fields are returned along with a *ValidationError.
+func (s *AWSService) extractInfo(ctx context.Context, blocks []types.Block, docType string, options ParseOptions) (ExtractedInfo, *ReceiptParser, error) {
+	schema, ok := s.schema(docType)
 	if !ok {
-		return nil, fmt.Errorf("schema not found for document type %s", docType)
+		return nil, nil, fmt.Errorf("%w for document type %s", errSchemaNotFound, docType)
 	}
 
-	parser := NewReceiptParser(blocks, schema)
-	extractedInfo := parser.Parse()
+	parser := NewReceiptParser(blocks, schema, options)
+	extractedInfo, err := parser.Parse()
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		return extractedInfo, parser, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	observeFieldStrategies(docType, parser)
+	logger := logging.FromContext(ctx, s.parserLogger)
+	if warnings := parser.Warnings(); len(warnings) > 0 {
+		logger.Warn("Extraction warnings", zap.Any("warnings", warnings))
+	}
+	if lowConfidence := parser.LowConfidence(); len(lowConfidence) > 0 {
+		logger.Info("Held back low-confidence values", zap.Any("fields", lowConfidence))
+	}
+	logger.Debug("Parse trace", zap.Strings("trace", parser.Trace()))
 
 	// Hata ayıklama için log ekleyelim
-	s.logger.Debug("Extracted info", zap.Any("info", extractedInfo))
+	logger.Debug("Extracted info", zap.Any("info", extractedInfo))
 
-	// Eğer hiçbir bilgi çıkarılamadıysa, hata döndür
-	if len(extractedInfo) == 0 {
-		// Ham veriyi loglamak için
-		s.logger.Debug("Raw Textract blocks", zap.Any("blocks", blocks))
-		return nil, fmt.Errorf("no information could be extracted from the document")
+	// Eğer hiçbir bilgi çıkarılamadıysa, hata döndür; yalnızca opsiyonel alanları olmayan belge başarısız sayılmaz
+	if len(extractedInfo) == 0 && len(parser.LowConfidence()) == 0 && len(parser.Missing()) > 0 {
+		logger.Debug("Nothing extracted", zap.Int("blocks", len(blocks)), zap.Int("unmatchedLines", len(parser.UnmatchedLines())))
+		return nil, parser, errNothingExtracted
 	}
 
-	return extractedInfo, nil
+	return extractedInfo, parser, nil
 }
 
 func (s *AWSService) findFieldValue(blocks []types.Block, key string) string {
 	for i, block := range blocks {
 		if block.BlockType == types.BlockTypeKeyValueSet && block.EntityTypes != nil && len(block.EntityTypes) > 0 && block.EntityTypes[0] == types.EntityTypeKey {
-			if block.Text != nil && *block.Text == key {
+			if block.Text != nil && blockText(block) == key {
 				// Try to find the value using relationships first
 				for _, relationship := range block.Relationships {
 					if relationship.Type == types.RelationshipTypeValue {
 						for _, valueId := range relationship.Ids {
 							valueBlock := s.findBlockById(blocks, valueId)
 							if valueBlock != nil && valueBlock.Text != nil {
-								return *valueBlock.Text
+								return blockText(*valueBlock)
 							}
 						}
 					}
@@ -254,17 +658,17 @@ func (s *AWSService) findFieldValue(blocks []types.Block, key string) string {
 				if i+1 < len(blocks) {
 					nextBlock := blocks[i+1]
 					if nextBlock.BlockType == types.BlockTypeLine && nextBlock.Text != nil {
-						return *nextBlock.Text
+						return blockText(nextBlock)
 					}
 				}
 			}
 		} else if block.BlockType == types.BlockTypeLine && block.Text != nil {
 			// This is the approach from the previous implementation
-			if *block.Text == key {
+			if blockText(block) == key {
 				if i+1 < len(blocks) {
 					nextBlock := blocks[i+1]
 					if nextBlock.BlockType == types.BlockTypeLine && nextBlock.Text != nil {
-						return *nextBlock.Text
+						return blockText(nextBlock)
 					}
 				}
 				break
@@ -276,7 +680,7 @@ func (s *AWSService) findFieldValue(blocks []types.Block, key string) string {
 
 func (s *AWSService) findBlockById(blocks []types.Block, id string) *types.Block {
 	for _, block := range blocks {
-		if block.Id != nil && *block.Id == id {
+		if block.Id != nil && blockID(block) == id {
 			return &block
 		}
 	}
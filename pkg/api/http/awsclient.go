@@ -0,0 +1,103 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// AWSClientConfig tunes the AWS SDK clients; zero values keep the SDK defaults
+type AWSClientConfig struct {
+	// MaxAttempts counts the first call too, 1 disables retries; the SDK default is 3
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// RetryMode is standard or adaptive; adaptive also slows down the client while
+	// Textract throttles
+	RetryMode string `mapstructure:"retry_mode"`
+	// Timeout bounds one HTTP attempt including reading the response
+	Timeout               time.Duration `mapstructure:"timeout"`
+	ConnectTimeout        time.Duration `mapstructure:"connect_timeout"`
+	TLSHandshakeTimeout   time.Duration `mapstructure:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `mapstructure:"response_header_timeout"`
+	// CABundle is a PEM file of roots trusted in addition to the system roots, e.g. the CA
+	// of a TLS-inspecting proxy
+	CABundle string `mapstructure:"ca_bundle"`
+}
+
+// loadOptions returns the SDK options of the retry settings
+func (cfg AWSClientConfig) loadOptions() ([]func(*config.LoadOptions) error, error) {
+	var options []func(*config.LoadOptions) error
+	if cfg.MaxAttempts < 0 {
+		return nil, errors.New("aws.client.max_attempts must not be negative")
+	}
+	if cfg.MaxAttempts > 0 {
+		options = append(options, config.WithRetryMaxAttempts(cfg.MaxAttempts))
+	}
+	if cfg.RetryMode != "" {
+		mode, err := aws.ParseRetryMode(cfg.RetryMode)
+		if err != nil {
+			return nil, fmt.Errorf("aws.client.retry_mode must be standard or adaptive")
+		}
+		options = append(options, config.WithRetryMode(mode))
+	}
+	return options, nil
+}
+
+// httpClient returns the HTTP client of the SDK, going through the egress settings
+func (cfg AWSClientConfig) httpClient(egress EgressConfig) (*http.Client, error) {
+	for name, timeout := range map[string]time.Duration{
+		"timeout":                 cfg.Timeout,
+		"connect_timeout":         cfg.ConnectTimeout,
+		"tls_handshake_timeout":   cfg.TLSHandshakeTimeout,
+		"response_header_timeout": cfg.ResponseHeaderTimeout,
+	} {
+		if timeout < 0 {
+			return nil, fmt.Errorf("aws.client.%s must not be negative", name)
+		}
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ConnectTimeout > 0 {
+		base.DialContext = (&net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if cfg.TLSHandshakeTimeout > 0 {
+		base.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	base.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	if cfg.CABundle != "" {
+		roots, err := caBundlePool(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("aws.client.ca_bundle: %w", err)
+		}
+		base.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+
+	transport, err := egress.transportFrom(base)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport, Timeout: cfg.Timeout}, nil
+}
+
+// caBundlePool adds the certificates of a PEM file to the system roots
+func caBundlePool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found")
+	}
+	return roots, nil
+}
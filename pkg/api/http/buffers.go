@@ -0,0 +1,35 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer keeps a single huge document from pinning its buffer in the pool
+const maxPooledBuffer = 32 << 20
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// readPooled reads r into a pooled buffer grown to size up front, so a document is not
+// copied through the doubling steps of io.ReadAll. Call release once nothing refers to
+// the returned bytes anymore.
+func readPooled(r io.Reader, size int64) ([]byte, func(), error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if size > 0 {
+		buf.Grow(int(size) + bytes.MinRead)
+	}
+	release := func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}
+	if _, err := buf.ReadFrom(r); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return buf.Bytes(), release, nil
+}
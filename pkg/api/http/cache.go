@@ -1,11 +1,19 @@
 package http
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"github.com/mehmetsafabenli/cbomdekont/pkg/version"
 	"go.uber.org/zap"
+	"net"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,7 +23,7 @@ func (s *Server) getCacheConn() (redis.Conn, error) {
 		return nil, fmt.Errorf("failed to parse redis url: %v", err)
 	}
 
-	var opts []redis.DialOption
+	opts := s.cacheDialOptions(redisUrl.Scheme == "rediss", redisUrl.Hostname())
 	if user := redisUrl.User; user != nil {
 		opts = append(opts, redis.DialUsername(user.Username()))
 		if password, ok := user.Password(); ok {
@@ -23,7 +31,89 @@ func (s *Server) getCacheConn() (redis.Conn, error) {
 		}
 	}
 
-	return redis.Dial("tcp", redisUrl.Host, opts...)
+	db := s.config.CacheDB
+	if path := strings.TrimPrefix(redisUrl.Path, "/"); path != "" {
+		db, err = strconv.Atoi(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database %q: %v", path, err)
+		}
+	}
+	opts = append(opts, redis.DialDatabase(db))
+
+	addr := redisUrl.Host
+	if s.config.CacheSentinelMaster != "" {
+		addr, err = s.sentinelMasterAddr(redisUrl.Scheme == "rediss")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := redis.Dial("tcp", addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// after a failover the old master may still accept connections as a replica
+	if s.config.CacheSentinelMaster != "" {
+		role, err := redis.Values(conn.Do("ROLE"))
+		if err != nil || len(role) == 0 {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to check redis role at %s: %v", addr, err)
+		}
+		if r, _ := redis.String(role[0], nil); r != "master" {
+			_ = conn.Close()
+			return nil, fmt.Errorf("redis at %s is %s, not master", addr, r)
+		}
+	}
+
+	return conn, nil
+}
+
+// cacheDialOptions returns the timeout and TLS options shared by redis and sentinel connections
+func (s *Server) cacheDialOptions(useTLS bool, serverName string) []redis.DialOption {
+	opts := []redis.DialOption{
+		redis.DialConnectTimeout(s.config.CacheDialTimeout),
+		redis.DialReadTimeout(s.config.CacheReadTimeout),
+		redis.DialWriteTimeout(s.config.CacheWriteTimeout),
+	}
+	if useTLS {
+		opts = append(opts,
+			redis.DialUseTLS(true),
+			redis.DialTLSConfig(&tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}),
+			redis.DialTLSSkipVerify(s.config.CacheTLSSkipVerify),
+		)
+	}
+	return opts
+}
+
+// sentinelMasterAddr asks the configured sentinels, in order, for the current master address
+func (s *Server) sentinelMasterAddr(useTLS bool) (string, error) {
+	var lastErr error
+	for _, sentinel := range s.config.CacheSentinelAddrs {
+		host, _, _ := net.SplitHostPort(sentinel)
+		opts := s.cacheDialOptions(useTLS, host)
+		if s.config.CacheSentinelPassword != "" {
+			opts = append(opts, redis.DialPassword(s.config.CacheSentinelPassword))
+		}
+
+		conn, err := redis.Dial("tcp", sentinel, opts...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		addr, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", s.config.CacheSentinelMaster))
+		_ = conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(addr) != 2 {
+			lastErr = fmt.Errorf("sentinel %s returned no address for %s", sentinel, s.config.CacheSentinelMaster)
+			continue
+		}
+		return net.JoinHostPort(addr[0], addr[1]), nil
+	}
+	return "", fmt.Errorf("failed to discover redis master %s: %v", s.config.CacheSentinelMaster, lastErr)
 }
 
 func (s *Server) startCachePool(ticker *time.Ticker) {
@@ -39,6 +129,9 @@ func (s *Server) startCachePool(ticker *time.Ticker) {
 			return err
 		},
 	}
+	if s.config.CacheBatchSize > 1 {
+		s.cacheWrites = newCacheBatcher(s.pool, s.logger, s.config.CacheBatchSize, s.config.CacheBatchInterval)
+	}
 
 	// set <hostname>=<version> with an expiry time of one minute
 	setVersion := func() {
@@ -60,3 +153,85 @@ func (s *Server) startCachePool(ticker *time.Ticker) {
 		}
 	}()
 }
+
+const resultCachePrefix = "result:"
+
+// resultCacheKey identifies an extraction by document type and content hash
+func resultCacheKey(docType string, fileBytes []byte) string {
+	sum := sha256.Sum256(fileBytes)
+	return resultCachePrefix + docType + ":" + hex.EncodeToString(sum[:])
+}
+
+func (s *Server) getCachedResult(key string) (ExtractedInfo, bool) {
+	if s.pool == nil || s.config.ResultCacheTTL <= 0 {
+		return nil, false
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("GET", key))
+	if err != nil {
+		if !errors.Is(err, redis.ErrNil) {
+			s.logger.Warn("result cache read failed", zap.Error(err))
+		}
+		return nil, false
+	}
+
+	var info ExtractedInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, false
+	}
+	return info, true
+}
+
+func (s *Server) setCachedResult(key string, info ExtractedInfo) {
+	if s.pool == nil || s.config.ResultCacheTTL <= 0 {
+		return
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	if s.cacheWrites != nil {
+		s.cacheWrites.set(key, data, int(s.config.ResultCacheTTL.Seconds()))
+		return
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", key, data, "EX", int(s.config.ResultCacheTTL.Seconds())); err != nil {
+		s.logger.Warn("result cache write failed", zap.Error(err))
+	}
+}
+
+// clearResultCache deletes every cached extraction and returns the number of removed keys
+func (s *Server) clearResultCache() (int, error) {
+	if s.pool == nil {
+		return 0, nil
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	deleted := 0
+	cursor := 0
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", resultCachePrefix+"*", "COUNT", 500))
+		if err != nil {
+			return deleted, err
+		}
+		var keys []string
+		if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+			return deleted, err
+		}
+		if len(keys) > 0 {
+			n, err := redis.Int(conn.Do("DEL", redis.Args{}.AddFlat(keys)...))
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
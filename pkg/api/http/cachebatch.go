@@ -0,0 +1,147 @@
+package http
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var (
+	cachePipelineSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Subsystem: "cache",
+		Name:      "pipeline_size",
+		Help:      "The number of cache writes sent in one pipelined round trip.",
+		Buckets:   []float64{1, 2, 4, 8, 16, 32, 64, 128, 256},
+	})
+	cacheWritesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: "cache",
+		Name:      "writes_dropped_total",
+		Help:      "The number of cache writes dropped because the batch queue was full or closed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(cachePipelineSize)
+	prometheus.MustRegister(cacheWritesDropped)
+}
+
+type cacheWrite struct {
+	key   string
+	value []byte
+	ttl   int
+}
+
+// cacheBatcher collects the cache writes of concurrent requests and sends them pipelined,
+// one round trip per batch instead of one per write. A batch is sent when it holds size
+// writes or interval after its first write.
+type cacheBatcher struct {
+	pool     *redis.Pool
+	logger   *zap.Logger
+	size     int
+	interval time.Duration
+	queue    chan cacheWrite
+	done     chan struct{}
+	// mu guards queue against writes of requests outliving the shutdown
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newCacheBatcher(pool *redis.Pool, logger *zap.Logger, size int, interval time.Duration) *cacheBatcher {
+	b := &cacheBatcher{
+		pool:     pool,
+		logger:   logger,
+		size:     size,
+		interval: interval,
+		// a few batches may queue up while one is being sent
+		queue: make(chan cacheWrite, 4*size),
+		done:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// set queues a SET with expiry; cache writes are best effort, so a write that finds the
+// queue full is dropped rather than holding up the request
+func (b *cacheBatcher) set(key string, value []byte, ttl int) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		cacheWritesDropped.Inc()
+		return
+	}
+	select {
+	case b.queue <- cacheWrite{key: key, value: value, ttl: ttl}:
+	default:
+		cacheWritesDropped.Inc()
+	}
+}
+
+func (b *cacheBatcher) run() {
+	defer close(b.done)
+	batch := make([]cacheWrite, 0, b.size)
+	timer := time.NewTimer(b.interval)
+	timer.Stop()
+	for {
+		select {
+		case write, ok := <-b.queue:
+			if !ok {
+				b.send(batch)
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(b.interval)
+			}
+			batch = append(batch, write)
+			if len(batch) < b.size {
+				continue
+			}
+			timer.Stop()
+		case <-timer.C:
+		}
+		b.send(batch)
+		batch = batch[:0]
+	}
+}
+
+func (b *cacheBatcher) send(batch []cacheWrite) {
+	if len(batch) == 0 {
+		return
+	}
+	cachePipelineSize.Observe(float64(len(batch)))
+	conn := b.pool.Get()
+	defer conn.Close()
+
+	for _, write := range batch {
+		if err := conn.Send("SET", write.key, write.value, "EX", write.ttl); err != nil {
+			b.logger.Warn("result cache write failed", zap.Error(err), zap.Int("batch", len(batch)))
+			return
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		b.logger.Warn("result cache write failed", zap.Error(err), zap.Int("batch", len(batch)))
+		return
+	}
+	for range batch {
+		if _, err := conn.Receive(); err != nil {
+			b.logger.Warn("result cache write failed", zap.Error(err))
+		}
+	}
+}
+
+// close sends the queued writes, waiting at most timeout
+func (b *cacheBatcher) close(timeout time.Duration) {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+	select {
+	case <-b.done:
+	case <-time.After(timeout):
+		b.logger.Warn("Timed out sending queued cache writes")
+	}
+}
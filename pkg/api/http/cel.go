@@ -0,0 +1,179 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+)
+
+// celCostLimit bounds the work of one expression, a few thousand list operations; it
+// keeps a schema from stalling requests with a runaway comprehension
+const celCostLimit = 100000
+
+// The cel strategy evaluates a CEL expression over a simplified model of the document:
+//
+//	lines      list(string)        the LINE texts in reading order
+//	keyValues  map(string, string) the form keys and their values
+//	tables     list(map)           {"title": string, "rows": list(list(string))}
+//	blocks     list(map)           every block in reading order: {"id", "type", "text":
+//	                               string, "page": int, "confidence": double} and, when
+//	                               Textract gave a geometry, "left", "top", "width" and
+//	                               "height" as fractions of the page
+//
+// e.g. lines.filter(l, l.startsWith("Alıcı IBAN"))[0].split(":")[1].trim(), or for a
+// layout without labels, the words in the top right corner of the first page:
+// blocks.filter(b, b.type == "WORD" && b.page == 1 && has(b.left) && b.left > 0.7 &&
+// b.top < 0.1).map(b, b.text).join(" "). The
+// expression returns the value as a string; an empty string or an error means the field
+// was not found. The value must appear in a line, cell or form value of the document,
+// which gives it its confidence and position.
+var celEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("lines", cel.ListType(cel.StringType)),
+		cel.Variable("keyValues", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("tables", cel.ListType(cel.MapType(cel.StringType, cel.DynType))),
+		cel.Variable("blocks", cel.ListType(cel.MapType(cel.StringType, cel.DynType))),
+		ext.Strings(),
+	)
+})
+
+// celPrograms caches the compiled expressions by source, schemas are parsed per request
+var celPrograms sync.Map
+
+func compileCEL(src string) (cel.Program, error) {
+	if program, ok := celPrograms.Load(src); ok {
+		return program.(cel.Program), nil
+	}
+	env, err := celEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(src)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if output := ast.OutputType(); !output.IsExactType(cel.StringType) && !output.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("expression returns %s, not string", output)
+	}
+	program, err := env.Program(ast, cel.CostLimit(celCostLimit))
+	if err != nil {
+		return nil, err
+	}
+	celPrograms.Store(src, program)
+	return program, nil
+}
+
+// findCEL evaluates the expression of a cel field
+func (p *ReceiptParser) findCEL(src string) (string, *types.Block) {
+	program, err := compileCEL(src)
+	if err != nil {
+		p.tracef("Invalid CEL expression: %s", err)
+		return "", nil
+	}
+	out, _, err := program.Eval(p.celModel())
+	if err != nil {
+		p.tracef("CEL expression failed: %s", err)
+		p.reject(nil, "", "expression failed: %s", err)
+		return "", nil
+	}
+	value, ok := out.Value().(string)
+	if !ok {
+		p.tracef("CEL expression returned %s, not string", out.Type())
+		return "", nil
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	source := p.sourceOf(value)
+	if source == nil {
+		p.tracef("CEL result %q does not appear in the document", value)
+		p.reject(nil, value, "the result does not appear in the document")
+		return "", nil
+	}
+	return value, source
+}
+
+// celModel builds the variables of the cel strategy
+func (p *ReceiptParser) celModel() map[string]any {
+	lines := []string{}
+	keyValues := map[string]string{}
+	blocks := make([]map[string]any, 0, len(p.blocks))
+	for _, block := range p.blocks {
+		blocks = append(blocks, p.celBlock(block))
+		switch {
+		case block.BlockType == types.BlockTypeLine && block.Text != nil:
+			lines = append(lines, blockText(block))
+		case block.BlockType == types.BlockTypeKeyValueSet && len(block.EntityTypes) > 0 && block.EntityTypes[0] == types.EntityTypeKey:
+			key := strings.TrimSpace(p.text(block))
+			if _, ok := keyValues[key]; ok || key == "" {
+				continue
+			}
+			if value, source := p.getValueFromKeyValueSet(block); source != nil {
+				keyValues[key] = value
+			}
+		}
+	}
+
+	tables := []map[string]any{}
+	for _, t := range p.documentTables() {
+		var rows [][]string
+		for _, pos := range t.positions() {
+			if pos.row < 1 || pos.row > maxTableIndex || pos.column < 1 || pos.column > maxTableIndex {
+				continue
+			}
+			for int(pos.row) > len(rows) {
+				rows = append(rows, nil)
+			}
+			row := rows[pos.row-1]
+			for int(pos.column) > len(row) {
+				row = append(row, "")
+			}
+			row[pos.column-1] = t.cells[pos].text
+			rows[pos.row-1] = row
+		}
+		tables = append(tables, map[string]any{"title": t.title, "rows": rows})
+	}
+
+	return map[string]any{"lines": lines, "keyValues": keyValues, "tables": tables, "blocks": blocks}
+}
+
+// celBlock is a block as the cel strategy sees it; the text of KEY, VALUE and CELL blocks
+// is that of their words
+func (p *ReceiptParser) celBlock(block types.Block) map[string]any {
+	b := map[string]any{
+		"id":         blockID(block),
+		"type":       string(block.BlockType),
+		"text":       p.text(block),
+		"page":       int64(blockPage(block)),
+		"confidence": float64(blockConfidence(block)),
+	}
+	if block.Geometry != nil && block.Geometry.BoundingBox != nil {
+		box := block.Geometry.BoundingBox
+		b["left"], b["top"] = float64(box.Left), float64(box.Top)
+		b["width"], b["height"] = float64(box.Width), float64(box.Height)
+	}
+	return b
+}
+
+// sourceOf returns the line, or else the cell or form value, containing value
+func (p *ReceiptParser) sourceOf(value string) *types.Block {
+	var fallback *types.Block
+	for i, block := range p.blocks {
+		switch block.BlockType {
+		case types.BlockTypeLine:
+			if block.Text != nil && strings.Contains(blockText(block), value) {
+				return &p.blocks[i]
+			}
+		case types.BlockTypeCell, types.BlockTypeKeyValueSet:
+			if fallback == nil && strings.Contains(p.text(block), value) {
+				fallback = &p.blocks[i]
+			}
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,42 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+func TestParseCELBlocks(t *testing.T) {
+	secondPage := at(textBlock(types.BlockTypeWord, "w4", "Sayfa"), 0.8, 0.05)
+	secondPage.Page = aws.Int32(2)
+	lowConfidence := at(textBlock(types.BlockTypeWord, "w5", "??"), 0.1, 0.5)
+	lowConfidence.Confidence = aws.Float32(20)
+	blocks := []types.Block{
+		at(textBlock(types.BlockTypeLine, "l1", "Dekont No: 42"), 0.1, 0.05),
+		at(textBlock(types.BlockTypeLine, "l2", "TR12 0001"), 0.75, 0.05),
+		at(textBlock(types.BlockTypeWord, "w1", "TR12"), 0.75, 0.05),
+		at(textBlock(types.BlockTypeWord, "w2", "0001"), 0.86, 0.05),
+		textBlock(types.BlockTypeWord, "w3", "konumsuz"),
+		secondPage,
+		lowConfidence,
+	}
+
+	tests := []struct {
+		name, expression, want string
+	}{
+		{"top right words", `blocks.filter(b, b.type == "WORD" && b.page == 1 && has(b.left) && b.left > 0.7 && b.top < 0.1).map(b, b.text).join(" ")`, "TR12 0001"},
+		{"block without geometry", `blocks.filter(b, !has(b.left))[0].id == "w3" ? "42" : ""`, "42"},
+		{"page", `blocks.exists(b, b.page == 2 && b.text == "Sayfa") ? "42" : ""`, "42"},
+		{"confidence", `blocks.filter(b, b.confidence < 50).map(b, b.id).join("") == "w5" ? "42" : ""`, "42"},
+		{"result not in the document", `blocks.map(b, b.id).join("")`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, _ := parseField(t, blocks, FieldStrategy{Strategy: StrategyCEL, Expression: tt.expression}, ParseOptions{Mode: ParseModeStrict})
+			if value != tt.want {
+				t.Errorf("got %q, want %q", value, tt.want)
+			}
+		})
+	}
+}
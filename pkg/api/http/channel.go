@@ -0,0 +1,106 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderChannel names the ingestion channel of an analysis, the channel form field
+	// works as well
+	HeaderChannel = "X-Upload-Channel"
+
+	ChannelWeb      = "web"
+	ChannelAPI      = "api"
+	ChannelEmail    = "email"
+	ChannelBackfill = "backfill"
+
+	// clientAnonymous is the client of requests that are neither signed nor sent with a
+	// client certificate
+	clientAnonymous = "anonymous"
+)
+
+var channels = []string{ChannelWeb, ChannelAPI, ChannelEmail, ChannelBackfill}
+
+var (
+	channelDocumentsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "channel",
+		Name:      "documents_total",
+		Help:      "The number of analysis requests by ingestion channel, client and outcome: success, client_error or error.",
+	}, []string{"channel", "client", "outcome"})
+	channelPagesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "channel",
+		Name:      "textract_pages_total",
+		Help:      "The number of pages sent to Textract by ingestion channel and client, for cost attribution.",
+	}, []string{"channel", "client"})
+)
+
+func init() {
+	prometheus.MustRegister(channelDocumentsCounter)
+	prometheus.MustRegister(channelPagesCounter)
+}
+
+// attribution records the channel and client of an analysis request for the logs and
+// the channel_* metrics. It runs after requestSigning, which names the client of signed
+// requests.
+func (s *Server) attribution(c fiber.Ctx) error {
+	channel := c.Get(HeaderChannel, c.FormValue("channel"))
+	if channel == "" {
+		channel = ChannelAPI
+	}
+	channel = strings.ToLower(channel)
+	if !slices.Contains(channels, channel) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("channel must be one of %s", strings.Join(channels, ", ")))
+	}
+	client := requestClient(c)
+	c.Locals("channel", channel)
+	c.Locals("client", client)
+	s.addLogFields(c, zap.String("channel", channel), zap.String("client", client))
+
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+	outcome := "success"
+	switch {
+	case status >= 500:
+		outcome = "error"
+	case status >= 400:
+		outcome = "client_error"
+	}
+	channelDocumentsCounter.WithLabelValues(channel, client, outcome).Inc()
+	return err
+}
+
+// requestClient names the caller by its signing key id or client certificate; both are
+// configured, which keeps the label values bounded
+func requestClient(c fiber.Ctx) string {
+	if keyID, ok := c.Locals("signingKeyID").(string); ok && keyID != "" {
+		return "key:" + strings.ToLower(keyID)
+	}
+	if state := c.Context().TLSConnectionState(); state != nil && len(state.PeerCertificates) > 0 {
+		return "cert:" + state.PeerCertificates[0].Subject.CommonName
+	}
+	return clientAnonymous
+}
+
+// countTextractPages attributes the pages of a Textract call to the request's channel
+func countTextractPages(c fiber.Ctx, pages int32) {
+	channel, _ := c.Locals("channel").(string)
+	client, _ := c.Locals("client").(string)
+	if channel == "" || pages <= 0 {
+		return
+	}
+	channelPagesCounter.WithLabelValues(channel, client).Add(float64(pages))
+}
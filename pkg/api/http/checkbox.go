@@ -0,0 +1,93 @@
+package http
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+// findCheckbox returns "true" or "false" for the checkbox labeled key, with the
+// selection element it was read from. The form graph is tried first (KEY → VALUE →
+// SELECTION_ELEMENT); otherwise the nearest selection element on the line containing
+// key is used.
+func (p *ReceiptParser) findCheckbox(key string) (string, *types.Block) {
+	for i, block := range p.blocks {
+		if !p.isKeyValueSet(block, key) {
+			continue
+		}
+		for _, relationship := range block.Relationships {
+			if relationship.Type != types.RelationshipTypeValue {
+				continue
+			}
+			for _, valueId := range relationship.Ids {
+				if valueBlock := p.findBlockById(valueId); valueBlock != nil {
+					if selection := p.childSelection(*valueBlock); selection != nil {
+						return selectionValue(selection)
+					}
+				}
+			}
+		}
+		p.reject(&p.blocks[i], p.text(block), "key has no selection element as value")
+	}
+
+	for i, block := range p.blocks {
+		if block.BlockType == types.BlockTypeLine && p.keyIn(p.text(block), key) {
+			if selection := p.nearestSelection(block); selection != nil {
+				return selectionValue(selection)
+			}
+			p.reject(&p.blocks[i], p.text(block), "no selection element lies on the line")
+		}
+	}
+	return "", nil
+}
+
+func (p *ReceiptParser) childSelection(block types.Block) *types.Block {
+	for _, relationship := range block.Relationships {
+		if relationship.Type != types.RelationshipTypeChild {
+			continue
+		}
+		for _, childId := range relationship.Ids {
+			if child := p.findBlockById(childId); child != nil && child.BlockType == types.BlockTypeSelectionElement {
+				return child
+			}
+		}
+	}
+	return nil
+}
+
+// nearestSelection finds the selection element whose vertical center lies within the
+// line and that is horizontally closest to it
+func (p *ReceiptParser) nearestSelection(line types.Block) *types.Block {
+	if line.Geometry == nil || line.Geometry.BoundingBox == nil {
+		return nil
+	}
+	lineBox := line.Geometry.BoundingBox
+
+	var nearest *types.Block
+	nearestDistance := float32(math.MaxFloat32)
+	for i := range p.blocks {
+		block := &p.blocks[i]
+		if block.BlockType != types.BlockTypeSelectionElement || block.Geometry == nil || block.Geometry.BoundingBox == nil {
+			continue
+		}
+		if blockPage(*block) != blockPage(line) {
+			continue
+		}
+		box := block.Geometry.BoundingBox
+		center := box.Top + box.Height/2
+		if center < lineBox.Top || center > lineBox.Top+lineBox.Height {
+			continue
+		}
+
+		distance := max(lineBox.Left-(box.Left+box.Width), box.Left-(lineBox.Left+lineBox.Width), 0)
+		if distance < nearestDistance {
+			nearest, nearestDistance = block, distance
+		}
+	}
+	return nearest
+}
+
+func selectionValue(selection *types.Block) (string, *types.Block) {
+	return strconv.FormatBool(selection.SelectionStatus == types.SelectionStatusSelected), selection
+}
@@ -0,0 +1,60 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+func selectionBlock(id string, status types.SelectionStatus, left, top float32) types.Block {
+	return at(types.Block{
+		BlockType: types.BlockTypeSelectionElement, Id: aws.String(id), SelectionStatus: status, Confidence: aws.Float32(88),
+	}, left, top)
+}
+
+func TestParseCheckboxForm(t *testing.T) {
+	for _, status := range []types.SelectionStatus{types.SelectionStatusSelected, types.SelectionStatusNotSelected} {
+		t.Run(string(status), func(t *testing.T) {
+			blocks := keyValueBlocks("a", "Onaylıyorum", "x y")
+			blocks[1].Relationships[0].Ids = []string{"s"}
+			blocks = append(blocks, selectionBlock("s", status, 0.5, 0.1))
+
+			value, parser := parseField(t, blocks, FieldStrategy{Key: "Onaylıyorum", Strategy: StrategyCheckbox}, ParseOptions{Mode: ParseModeStrict})
+			if want := map[types.SelectionStatus]string{types.SelectionStatusSelected: "true", types.SelectionStatusNotSelected: "false"}[status]; value != want {
+				t.Errorf("got %q, want %q", value, want)
+			}
+			if provenance := parser.Provenance()["alan"]; provenance.BlockID != "s" || provenance.Confidence != 88 {
+				t.Errorf("provenance %+v, want the selection element", provenance)
+			}
+		})
+	}
+}
+
+func TestParseCheckboxLine(t *testing.T) {
+	line := at(textBlock(types.BlockTypeLine, "l", "Sözleşmeyi okudum"), 0.2, 0.3)
+	otherPage := selectionBlock("s4", types.SelectionStatusNotSelected, 0.3, 0.3)
+	otherPage.Page = aws.Int32(2)
+
+	tests := []struct {
+		name       string
+		selections []types.Block
+		want       string
+	}{
+		{"nearest on the line", []types.Block{
+			selectionBlock("s1", types.SelectionStatusNotSelected, 0.8, 0.3),
+			selectionBlock("s2", types.SelectionStatusSelected, 0.05, 0.3),
+		}, "true"},
+		{"other row", []types.Block{selectionBlock("s3", types.SelectionStatusSelected, 0.05, 0.5)}, ""},
+		{"other page", []types.Block{otherPage}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := append([]types.Block{line}, tt.selections...)
+			value, _ := parseField(t, blocks, FieldStrategy{Key: "Sözleşmeyi okudum", Strategy: StrategyCheckbox}, ParseOptions{Mode: ParseModeStrict})
+			if value != tt.want {
+				t.Errorf("got %q, want %q", value, tt.want)
+			}
+		})
+	}
+}
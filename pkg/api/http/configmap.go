@@ -0,0 +1,392 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into every pod
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+const (
+	configMapWatchTimeout = 5 * time.Minute
+	configMapMaxBackoff   = 30 * time.Second
+)
+
+var (
+	configMapUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "configmap",
+		Name:      "updates_total",
+		Help:      "The number of ConfigMap versions received, by whether they were applied.",
+	}, []string{"result"})
+	configMapWatchErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: "configmap",
+		Name:      "watch_errors_total",
+		Help:      "The number of failed ConfigMap reads and dropped watches.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(configMapUpdates)
+	prometheus.MustRegister(configMapWatchErrors)
+}
+
+// ConfigMapConfig reads the schemas, the admin token and the signing keys from a ConfigMap
+// through the Kubernetes API. Changes apply within seconds, where a mounted ConfigMap takes
+// up to the kubelet sync period and is missed by subPath mounts. The service account needs
+// get, list and watch on the ConfigMap; values from it take precedence over the files.
+type ConfigMapConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Namespace defaults to the namespace of the pod
+	Namespace string `mapstructure:"namespace"`
+	Name      string `mapstructure:"name"`
+	// SchemaKey holds a schema file, merged over the embedded schemas like schema-file
+	SchemaKey     string `mapstructure:"schema-key"`
+	AdminTokenKey string `mapstructure:"admin-token-key"`
+	// SigningKeyPrefix marks signing keys, signing-key.billing holds the secret of key id billing
+	SigningKeyPrefix string `mapstructure:"signing-key-prefix"`
+}
+
+const (
+	defaultConfigMapSchemaKey        = "schema.json"
+	defaultConfigMapAdminTokenKey    = "admin-token"
+	defaultConfigMapSigningKeyPrefix = "signing-key."
+)
+
+func (c ConfigMapConfig) withDefaults() ConfigMapConfig {
+	if c.SchemaKey == "" {
+		c.SchemaKey = defaultConfigMapSchemaKey
+	}
+	if c.AdminTokenKey == "" {
+		c.AdminTokenKey = defaultConfigMapAdminTokenKey
+	}
+	if c.SigningKeyPrefix == "" {
+		c.SigningKeyPrefix = defaultConfigMapSigningKeyPrefix
+	}
+	return c
+}
+
+// kubeClient talks to the API server with the in-cluster service account
+type kubeClient struct {
+	host   string
+	client *http.Client
+}
+
+func newInClusterClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST is not set")
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates in the service account ca.crt")
+	}
+	// the API server is reached directly, egress proxies do not apply
+	transport := &http.Transport{
+		TLSClientConfig:     &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &kubeClient{
+		host:   "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{Transport: transport},
+	}, nil
+}
+
+// kubeStatusError is a request the API server answered with a failure Status
+type kubeStatusError struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *kubeStatusError) Error() string {
+	return fmt.Sprintf("kubernetes API: %d %s: %s", e.Code, e.Reason, e.Message)
+}
+
+// gone reports whether the resource version is too old to watch from and the ConfigMap
+// has to be read again
+func (e *kubeStatusError) gone() bool {
+	return e.Code == http.StatusGone
+}
+
+// get sends an authenticated GET; the token is read on every request because Kubernetes
+// rotates bound service account tokens
+func (k *kubeClient) get(ctx context.Context, path string) (*http.Response, error) {
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		status := &kubeStatusError{Code: resp.StatusCode}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(body, status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(body))
+		}
+		return nil, status
+	}
+	return resp, nil
+}
+
+type configMap struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// configMapWatcher keeps the settings in sync with the ConfigMap: it reads the ConfigMap,
+// watches it from that version and reads it again whenever the watch cannot be resumed
+type configMapWatcher struct {
+	server    *Server
+	client    *kubeClient
+	config    ConfigMapConfig
+	namespace string
+	logger    *zap.Logger
+	// schema is the last schema file applied, unchanged schemas are not parsed again
+	schema string
+}
+
+func newConfigMapWatcher(s *Server, cfg ConfigMapConfig) (*configMapWatcher, error) {
+	cfg = cfg.withDefaults()
+	if cfg.Name == "" {
+		return nil, errors.New("configmap.name is not set")
+	}
+	client, err := newInClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	namespace := cfg.Namespace
+	if namespace == "" {
+		data, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("configmap.namespace is not set: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	return &configMapWatcher{
+		server:    s,
+		client:    client,
+		config:    cfg,
+		namespace: namespace,
+		logger:    s.logger.Named("configmap").With(zap.String("namespace", namespace), zap.String("name", cfg.Name)),
+	}, nil
+}
+
+// startConfigMapWatcher applies the ConfigMap before the server becomes ready and keeps
+// watching it in the background. A failed first read is retried by the watch loop.
+func (s *Server) startConfigMapWatcher(ctx context.Context) {
+	if !s.config.ConfigMap.Enabled {
+		return
+	}
+	w, err := newConfigMapWatcher(s, s.config.ConfigMap)
+	if err != nil {
+		s.logger.Error("ConfigMap watch disabled", zap.Error(err))
+		return
+	}
+
+	syncCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	resourceVersion, err := w.sync(syncCtx)
+	cancel()
+	if err != nil {
+		configMapWatchErrors.Inc()
+		w.logger.Error("Failed to read ConfigMap, starting with the local settings", zap.Error(err))
+	}
+	go w.run(ctx, resourceVersion)
+}
+
+func (w *configMapWatcher) run(ctx context.Context, resourceVersion string) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		if resourceVersion == "" {
+			syncCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			rv, err := w.sync(syncCtx)
+			cancel()
+			if err != nil {
+				configMapWatchErrors.Inc()
+				w.logger.Warn("Failed to read ConfigMap", zap.Error(err), zap.Duration("retry", backoff))
+				w.sleep(ctx, backoff)
+				backoff = min(2*backoff, configMapMaxBackoff)
+				continue
+			}
+			resourceVersion = rv
+			backoff = time.Second
+		}
+
+		start := time.Now()
+		rv, err := w.watch(ctx, resourceVersion)
+		if err == nil {
+			// the server ended the watch after its timeout, resume where it stopped; a
+			// proxy closing watches at once must not turn this into a busy loop
+			resourceVersion = rv
+			if time.Since(start) < time.Second {
+				w.sleep(ctx, time.Second)
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		resourceVersion = ""
+		var status *kubeStatusError
+		if errors.As(err, &status) && status.gone() {
+			w.logger.Debug("ConfigMap watch expired, reading it again")
+			continue
+		}
+		configMapWatchErrors.Inc()
+		w.logger.Warn("ConfigMap watch dropped", zap.Error(err), zap.Duration("retry", backoff))
+		w.sleep(ctx, backoff)
+		backoff = min(2*backoff, configMapMaxBackoff)
+	}
+}
+
+func (w *configMapWatcher) sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// sync reads and applies the ConfigMap, returning its resource version
+func (w *configMapWatcher) sync(ctx context.Context) (string, error) {
+	resp, err := w.client.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s",
+		url.PathEscape(w.namespace), url.PathEscape(w.config.Name)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var cm configMap
+	if err := json.NewDecoder(resp.Body).Decode(&cm); err != nil {
+		return "", err
+	}
+	w.apply(&cm)
+	return cm.Metadata.ResourceVersion, nil
+}
+
+// watch applies the changes after resourceVersion until the watch ends. The field
+// selector lets a Role limited to the ConfigMap by resourceNames list and watch it.
+func (w *configMapWatcher) watch(ctx context.Context, resourceVersion string) (string, error) {
+	query := url.Values{
+		"watch":               {"true"},
+		"allowWatchBookmarks": {"true"},
+		"resourceVersion":     {resourceVersion},
+		"fieldSelector":       {"metadata.name=" + w.config.Name},
+		"timeoutSeconds":      {fmt.Sprint(int(configMapWatchTimeout.Seconds()))},
+	}
+	// a connection that silently died is dropped shortly after the server would have
+	// ended the watch
+	ctx, cancel := context.WithTimeout(ctx, configMapWatchTimeout+30*time.Second)
+	defer cancel()
+	resp, err := w.client.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/configmaps?%s",
+		url.PathEscape(w.namespace), query.Encode()))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event watchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return resourceVersion, nil
+			}
+			return "", err
+		}
+		if event.Type == "ERROR" {
+			status := &kubeStatusError{}
+			if err := json.Unmarshal(event.Object, status); err != nil {
+				return "", err
+			}
+			return "", status
+		}
+
+		var cm configMap
+		if err := json.Unmarshal(event.Object, &cm); err != nil {
+			return "", err
+		}
+		resourceVersion = cm.Metadata.ResourceVersion
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			w.apply(&cm)
+		case "DELETED":
+			w.logger.Warn("ConfigMap deleted, keeping the current settings")
+		}
+	}
+}
+
+// apply swaps in the settings of cm. Invalid schemas are rejected as a whole and the
+// current ones kept; keys missing from cm fall back to the local settings.
+func (w *configMapWatcher) apply(cm *configMap) {
+	result := "applied"
+	if schema, ok := cm.Data[w.config.SchemaKey]; ok && schema != w.schema {
+		if err := w.server.awsService.setSchemaData([]byte(schema)); err != nil {
+			result = "invalid"
+			w.logger.Error("Invalid schemas in ConfigMap, keeping the current ones",
+				zap.Error(err), zap.String("resourceVersion", cm.Metadata.ResourceVersion))
+		} else {
+			w.schema = schema
+		}
+	}
+
+	if token := strings.TrimSpace(cm.Data[w.config.AdminTokenKey]); token != "" {
+		w.server.configMapAdminToken.Store(&token)
+	} else {
+		w.server.configMapAdminToken.Store(nil)
+	}
+
+	keys := make(map[string]string)
+	for key, value := range cm.Data {
+		if id, ok := strings.CutPrefix(key, w.config.SigningKeyPrefix); ok && id != "" {
+			keys[strings.ToLower(id)] = strings.TrimSpace(value)
+		}
+	}
+	if len(keys) > 0 && w.server.config.CacheServer == "" {
+		w.logger.Warn("Ignoring signing keys in ConfigMap, request signing needs cache-server for replay protection")
+		keys = nil
+	}
+	w.server.signingKeys.setPushed(keys)
+
+	configMapUpdates.WithLabelValues(result).Inc()
+	w.logger.Info("ConfigMap received", zap.String("resourceVersion", cm.Metadata.ResourceVersion),
+		zap.Int("signingKeys", len(keys)), zap.String("result", result))
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// defaultCORSOrigins are allowed when neither allow-origins nor origins-file is set
+var defaultCORSOrigins = []string{"http://57.129.41.91:9091", "https://backend.pixelpickle.net", "https://pixelpickle.net", "http://localhost:5173"}
+
+// CORSConfig lists the browser origins allowed to call the API with credentials
+type CORSConfig struct {
+	AllowOrigins []string `mapstructure:"allow-origins"`
+	// OriginsFile holds one origin per line, # starts a comment. It replaces AllowOrigins
+	// and changes apply without a restart.
+	OriginsFile string `mapstructure:"origins-file"`
+}
+
+// corsOrigins is the current set of allowed origins, swapped as a whole on reloads
+type corsOrigins struct {
+	allowed atomic.Pointer[map[string]bool]
+}
+
+func newCORSOrigins(cfg CORSConfig, logger *zap.Logger) (*corsOrigins, error) {
+	o := &corsOrigins{}
+	if cfg.OriginsFile == "" {
+		origins := cfg.AllowOrigins
+		if len(origins) == 0 {
+			origins = defaultCORSOrigins
+		}
+		allowed, err := parseOrigins(origins)
+		if err != nil {
+			return nil, fmt.Errorf("cors: %w", err)
+		}
+		o.allowed.Store(&allowed)
+		return o, nil
+	}
+
+	file, err := NewSecretFile(cfg.OriginsFile)
+	if err != nil {
+		return nil, fmt.Errorf("cors origins file: %w", err)
+	}
+	if _, err := o.load(file); err != nil {
+		return nil, fmt.Errorf("cors origins file: %w", err)
+	}
+	watchReloads(file.watcher, "cors", logger, func() (bool, error) {
+		return o.load(file)
+	})
+	return o, nil
+}
+
+// load reads the origins file and swaps the allowed origins if they changed
+func (o *corsOrigins) load(file *SecretFile) (bool, error) {
+	var origins []string
+	for _, line := range strings.Split(file.Value(), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			origins = append(origins, line)
+		}
+	}
+	// an empty file is more likely a half-written one than a wish to lock out the UI
+	if len(origins) == 0 {
+		return false, errors.New("no origins")
+	}
+	allowed, err := parseOrigins(origins)
+	if err != nil {
+		return false, err
+	}
+	if current := o.allowed.Load(); current != nil && maps.Equal(*current, allowed) {
+		return false, nil
+	}
+	o.allowed.Store(&allowed)
+	return true, nil
+}
+
+// parseOrigins normalizes the origins the way the CORS middleware compares them;
+// wildcards are not allowed since credentials are
+func parseOrigins(origins []string) (map[string]bool, error) {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		u, err := url.Parse(strings.TrimSpace(origin))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Contains(u.Host, "*") ||
+			(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("invalid origin %q", origin)
+		}
+		allowed[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+	}
+	return allowed, nil
+}
+
+func (o *corsOrigins) allow(origin string) bool {
+	return (*o.allowed.Load())[strings.ToLower(origin)]
+}
@@ -0,0 +1,49 @@
+package http
+
+// ConfigDefaults returns the values the server uses for config keys left unset, by key.
+// Keys not listed are off or empty when unset. The maps route-limits, priorities and
+// histograms have built-in entries as well, which configured entries are merged over.
+func ConfigDefaults() map[string]any {
+	detectors := make([]string, 0, len(piiDetectors))
+	for _, detector := range piiDetectors {
+		detectors = append(detectors, detector.kind)
+	}
+
+	return map[string]any{
+		"accuracy.interval":            defaultAccuracyInterval,
+		"admin-host":                   defaultAdminHost,
+		"admission.retry-after":        defaultAdmissionRetryAfter,
+		"aws.assume_role.session_name": defaultRoleSessionName,
+		"aws.vault.credential_type":    VaultCredentialTypeSTS,
+		"aws.vault.mount":              defaultVaultMount,
+		"body-limit":                   defaultBodyLimit,
+		"configmap.admin-token-key":    defaultConfigMapAdminTokenKey,
+		"configmap.schema-key":         defaultConfigMapSchemaKey,
+		"configmap.signing-key-prefix": defaultConfigMapSigningKeyPrefix,
+		"cors.allow-origins":           defaultCORSOrigins,
+		"fx.base-url":                  defaultFXBaseURL,
+		"fx.rate":                      defaultFXRate,
+		"fx.timeout":                   defaultFXTimeout,
+		"header-limit":                 defaultHeaderLimit,
+		"heif-convert-path":            defaultHeifConvertPath,
+		"image-max-dimension":          defaultImageMaxDimension,
+		"parse-mode":                   ParseModeLenient,
+		"pii.detectors":                detectors,
+		"qpdf-path":                    defaultQpdfPath,
+		"samples.max-age":              defaultSamplesMaxAge,
+		"samples.max-count":            defaultSamplesMaxCount,
+		"security-headers.admin-ui-content-security-policy": defaultAdminUICSP,
+		"security-headers.content-security-policy":          defaultAPICSP,
+		"security-headers.frame-options":                    defaultFrameOptions,
+		"security-headers.hsts-max-age":                     defaultHSTSMaxAge,
+		"security-headers.referrer-policy":                  defaultReferrerPolicy,
+		"security-headers.swagger-content-security-policy":  defaultSwaggerCSP,
+		"signing.window":                                    defaultSigningWindow,
+		"textract-timeouts.sync":                            defaultTextractSyncTimeout,
+		"upload-dir":                                        defaultUploadDir(),
+		"upload-expiry":                                     defaultUploadExpiry,
+		"upload-max-size":                                   defaultUploadMaxSize,
+		"verbosity":                                         VerbosityStandard,
+		"warm-up.timeout":                                   defaultWarmUpTimeout,
+	}
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var clientDisconnectsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "client_disconnects_total",
+	Help: "The total number of requests the client disconnected from while the document was being analyzed.",
+}, []string{"route"})
+
+func init() {
+	prometheus.MustRegister(clientDisconnectsCounter)
+}
+
+// disconnectContext returns the user context of the request, cancelled when the server
+// shuts down or the client closes the connection. fasthttp only cancels its request context
+// on shutdown and doesn't read from the connection while the handler runs, so the socket is
+// watched here. It has to be called after the body was read: from then on the client has
+// nothing to send until the response arrives, and the socket only turns readable when it is
+// closed. The watch peeks, so a pipelined request stays in the socket for fasthttp and ends
+// the watch. The returned func stops the watch and has to be called before the handler
+// returns.
+func (s *Server) disconnectContext(c fiber.Ctx) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.UserContext())
+
+	// the request context can't be the parent, fasthttp resets its Done channel without a
+	// lock once shut down, so the channel is read here while the request holds the server
+	shutdown := c.Context().Done()
+	go func() {
+		select {
+		case <-shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	conn := c.Context().Conn()
+	tlsConn, isTLS := conn.(*tls.Conn)
+	if isTLS {
+		conn = tlsConn.NetConn()
+	}
+	// app.Test connections and other wrappers have no socket to watch
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return ctx, cancel
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return ctx, cancel
+	}
+
+	route := c.Route().Path
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if peerClosed(raw, isTLS) {
+			clientDisconnectsCounter.WithLabelValues(route).Inc()
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		// a deadline in the past wakes the watch up, fasthttp sets its own before reading
+		// the next request
+		if err := conn.SetReadDeadline(time.Unix(1, 0)); err != nil {
+			s.requestLogger(c).Warn("Failed to stop the disconnect watch", zap.Error(err))
+		}
+		<-done
+		_ = conn.SetReadDeadline(time.Time{})
+		cancel()
+	}
+}
+
+// requestCancelled answers a request whose context ended while qpdf, heif-convert or
+// Textract ran, because the client disconnected or the server is shutting down
+func (s *Server) requestCancelled(c fiber.Ctx, stage string, err error) error {
+	s.requestLogger(c).Warn("Request cancelled", zap.String("stage", stage), zap.Error(err))
+	return fiber.NewError(fiber.StatusServiceUnavailable, "Request cancelled")
+}
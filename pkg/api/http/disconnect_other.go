@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package http
+
+import "syscall"
+
+// peerClosed needs MSG_PEEK, without it disconnects are only noticed on shutdown
+func peerClosed(conn syscall.RawConn, isTLS bool) bool {
+	return false
+}
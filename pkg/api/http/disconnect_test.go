@@ -0,0 +1,89 @@
+package http
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+)
+
+// serveDisconnectTest serves a handler that waits for the disconnect context on a real
+// listener and reports whether it was cancelled
+func serveDisconnectTest(t *testing.T, wait time.Duration) (string, <-chan bool) {
+	t.Helper()
+	s := &Server{logger: zap.NewNop()}
+	cancelled := make(chan bool, 1)
+	app := fiber.New()
+	app.Post("/analyze", func(c fiber.Ctx) error {
+		ctx, stop := s.disconnectContext(c)
+		defer stop()
+		select {
+		case <-ctx.Done():
+			cancelled <- true
+		case <-time.After(wait):
+			cancelled <- false
+		}
+		return c.SendString("ok")
+	})
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+	return ln.Addr().String(), cancelled
+}
+
+const disconnectTestRequest = "POST /analyze HTTP/1.1\r\nHost: test\r\nContent-Length: 6\r\n\r\ndekont"
+
+func TestDisconnectContextCancelled(t *testing.T) {
+	addr, cancelled := serveDisconnectTest(t, 5*time.Second)
+	conn, err := net.Dial("tcp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte(disconnectTestRequest)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	conn.Close()
+
+	if !<-cancelled {
+		t.Error("context was not cancelled when the client disconnected")
+	}
+}
+
+func TestDisconnectContextKeepAlive(t *testing.T) {
+	addr, cancelled := serveDisconnectTest(t, 100*time.Millisecond)
+	conn, err := net.Dial("tcp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the stopped watch must leave the connection usable for the next request
+	r := bufio.NewReader(conn)
+	for i := 1; i <= 2; i++ {
+		if _, err := conn.Write([]byte(disconnectTestRequest)); err != nil {
+			t.Fatal(err)
+		}
+		if <-cancelled {
+			t.Fatalf("request %d: context cancelled while the client waits", i)
+		}
+		resp, err := http.ReadResponse(r, nil)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != fiber.StatusOK || string(body) != "ok" {
+			t.Fatalf("request %d: got %d %q", i, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package http
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// tlsRecordAlert is the content type of TLS alert records; a client sends close_notify,
+// an alert, before it closes the connection
+const tlsRecordAlert = 21
+
+// peerClosed waits until the connection turns readable and reports whether the client
+// closed it. Data that arrives first is left in the socket.
+func peerClosed(conn syscall.RawConn, isTLS bool) bool {
+	var closed bool
+	buf := make([]byte, 1)
+	err := conn.Read(func(fd uintptr) bool {
+		for {
+			n, _, err := unix.Recvfrom(int(fd), buf, unix.MSG_PEEK|unix.MSG_DONTWAIT)
+			switch {
+			case err == unix.EINTR:
+				continue
+			case err == unix.EAGAIN:
+				return false
+			case err != nil, n == 0:
+				// reset or end of stream
+				closed = true
+			case isTLS && buf[0] == tlsRecordAlert:
+				closed = true
+			}
+			return true
+		}
+	})
+	return err == nil && closed
+}
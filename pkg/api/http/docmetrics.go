@@ -0,0 +1,30 @@
+package http
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// newDocumentHistograms registers the histograms of the analyzed documents' size and page
+// count, buckets come from histograms.document_size_bytes and histograms.document_pages
+func (s *Server) newDocumentHistograms() (sizes, pages *prometheus.HistogramVec) {
+	sizes = prometheus.NewHistogramVec(s.histogramOpts(prometheus.HistogramOpts{
+		Subsystem: "document",
+		Name:      "size_bytes",
+		Help:      "The size of the uploaded documents in bytes, before preprocessing.",
+	}), []string{"docType"})
+	pages = prometheus.NewHistogramVec(s.histogramOpts(prometheus.HistogramOpts{
+		Subsystem: "document",
+		Name:      "pages",
+		Help:      "The number of pages Textract found in the analyzed documents.",
+	}), []string{"docType"})
+	prometheus.MustRegister(sizes)
+	prometheus.MustRegister(pages)
+	return sizes, pages
+}
+
+// docTypeLabel keeps the label values to the configured docTypes, a client sending
+// arbitrary docTypes must not create a series for each
+func (s *Server) docTypeLabel(docType string) string {
+	if _, ok := s.awsService.schema(docType); ok {
+		return docType
+	}
+	return "unknown"
+}
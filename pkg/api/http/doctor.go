@@ -0,0 +1,128 @@
+package http
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/textract"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+	"go.uber.org/zap"
+)
+
+// doctorSample is a tiny receipt-like image used to exercise Textract permissions
+//
+//go:embed assets/doctor-sample.png
+var doctorSample []byte
+
+var errDoctorSkip = errors.New("skipped")
+
+type doctor struct {
+	out    io.Writer
+	failed bool
+}
+
+func (d *doctor) check(name string, run func() (string, error)) {
+	detail, err := run()
+	switch {
+	case errors.Is(err, errDoctorSkip):
+		fmt.Fprintf(d.out, "[SKIP] %-18s %s\n", name, detail)
+	case err != nil:
+		d.failed = true
+		fmt.Fprintf(d.out, "[FAIL] %-18s %v\n", name, err)
+	default:
+		fmt.Fprintf(d.out, "[ OK ] %-18s %s\n", name, detail)
+	}
+}
+
+// RunDoctor validates the configuration and every external dependency and prints
+// a readiness report. It returns false if any check failed.
+func RunDoctor(cfg *Config, awsCfg *AWSConfig, schemaFile string, logger *zap.Logger, out io.Writer) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	d := &doctor{out: out}
+
+	d.check("config", func() (string, error) {
+		if cfg.Port == "" {
+			return "", errors.New("port is not set")
+		}
+		return fmt.Sprintf("port %s, config path %s", cfg.Port, cfg.ConfigPath), nil
+	})
+
+	d.check("schemas", func() (string, error) {
+		schemas, err := loadSchemas(schemaFile)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", schemaFile, err)
+		}
+		return fmt.Sprintf("%d docTypes from %s", len(schemas), schemaFile), nil
+	})
+
+	var awsConfig aws.Config
+	d.check("aws credentials", func() (string, error) {
+		if awsCfg.Region == "" {
+			return "", errors.New("AWS_REGION is not set")
+		}
+		var err error
+		awsConfig, err = loadAWSConfig(ctx, awsCfg)
+		if err != nil {
+			return "", err
+		}
+		identity, err := sts.NewFromConfig(awsConfig).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return "", err
+		}
+		return aws.ToString(identity.Arn), nil
+	})
+
+	d.check("textract", func() (string, error) {
+		if awsConfig.Credentials == nil {
+			return "no usable aws credentials", errDoctorSkip
+		}
+		result, err := textract.NewFromConfig(awsConfig).DetectDocumentText(ctx, &textract.DetectDocumentTextInput{
+			Document: &types.Document{Bytes: doctorSample},
+		})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("DetectDocumentText returned %d blocks", len(result.Blocks)), nil
+	})
+
+	srv := &Server{config: cfg, logger: logger}
+	d.check("redis", func() (string, error) {
+		if cfg.CacheServer == "" {
+			return "cache-server is not set", errDoctorSkip
+		}
+		conn, err := srv.getCacheConn()
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		if _, err := conn.Do("PING"); err != nil {
+			return "", err
+		}
+		return "PING ok", nil
+	})
+
+	d.check("upload storage", func() (string, error) {
+		uploads, err := newUploadStore(cfg.UploadDir, cfg.UploadExpiry)
+		if err != nil {
+			return "", err
+		}
+		probe := filepath.Join(uploads.dir, ".doctor")
+		if err := os.WriteFile(probe, []byte("ok"), 0600); err != nil {
+			return "", err
+		}
+		_ = os.Remove(probe)
+		return uploads.dir + " is writable", nil
+	})
+
+	return !d.failed
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// EgressConfig routes the outbound HTTP calls of the service (Textract, Vault, TCMB,
+// Sentry) through a proxy and restricts the hosts they may reach. The OTLP exporter and
+// the cache server connection are not HTTP; the exporter follows HTTPS_PROXY.
+type EgressConfig struct {
+	// Proxy is the http:// or https:// proxy URL, credentials may be given as userinfo.
+	// Empty falls back to the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+	Proxy string `mapstructure:"proxy"`
+	// NoProxy lists hosts reached directly when Proxy is set, e.g. vault.internal or
+	// .svc.cluster.local for a domain and its subdomains
+	NoProxy []string `mapstructure:"no-proxy"`
+	// AllowedHosts lists the hosts outbound calls may reach, all when empty; a leading
+	// dot or *. allows the subdomains, e.g. *.amazonaws.com
+	AllowedHosts []string `mapstructure:"allowed-hosts"`
+}
+
+var egressDeniedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Subsystem: "egress",
+	Name:      "denied_total",
+	Help:      "The number of outbound requests rejected by the egress allow-list.",
+})
+
+func init() {
+	prometheus.MustRegister(egressDeniedCounter)
+}
+
+// EgressDeniedError is returned for outbound requests to hosts outside the allow-list
+type EgressDeniedError struct {
+	Host string
+}
+
+func (e *EgressDeniedError) Error() string {
+	return fmt.Sprintf("egress to %s is not allowed", e.Host)
+}
+
+// hostMatches reports whether host equals one of patterns or, for patterns starting with
+// a dot or *., is a subdomain of it
+func hostMatches(host string, patterns []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(pattern), "*"))
+		if strings.HasPrefix(pattern, ".") {
+			if strings.HasSuffix(host, pattern) || host == pattern[1:] {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// egressTransport rejects requests to hosts outside the allow-list before they are sent
+type egressTransport struct {
+	next    http.RoundTripper
+	allowed []string
+}
+
+func (t *egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.allowed) > 0 && !hostMatches(req.URL.Hostname(), t.allowed) {
+		egressDeniedCounter.Inc()
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, &EgressDeniedError{Host: req.URL.Hostname()}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// transport returns the round tripper every outbound HTTP client of the service uses
+func (cfg EgressConfig) transport() (http.RoundTripper, error) {
+	return cfg.transportFrom(http.DefaultTransport.(*http.Transport).Clone())
+}
+
+// transportFrom applies the proxy and the allow-list to base, a transport with its own
+// timeouts or roots
+func (cfg EgressConfig) transportFrom(base *http.Transport) (http.RoundTripper, error) {
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil || (proxyURL.Scheme != "http" && proxyURL.Scheme != "https") || proxyURL.Host == "" {
+			return nil, fmt.Errorf("egress.proxy must be an http:// or https:// URL")
+		}
+		base.Proxy = func(req *http.Request) (*url.URL, error) {
+			if hostMatches(req.URL.Hostname(), cfg.NoProxy) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	}
+	for _, host := range cfg.AllowedHosts {
+		if strings.Contains(host, "/") || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+			return nil, fmt.Errorf("egress.allowed-hosts takes host names without scheme or port, got %q", host)
+		}
+	}
+	if len(cfg.AllowedHosts) == 0 {
+		return base, nil
+	}
+	return &egressTransport{next: base, allowed: cfg.AllowedHosts}, nil
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var panicsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "http",
+	Name:      "panics_total",
+	Help:      "The total number of panics recovered in HTTP handlers.",
+}, []string{"route"})
+
+func init() {
+	prometheus.MustRegister(panicsCounter)
+}
+
+// errorTags collects the request attributes attached to error reports
+func (s *Server) errorTags(c fiber.Ctx) map[string]string {
+	tags := map[string]string{
+		"method": c.Method(),
+		"route":  c.Route().Path,
+	}
+	if requestID := requestid.FromContext(c); requestID != "" {
+		tags["requestId"] = requestID
+	}
+	if docType, ok := c.Locals("docType").(string); ok && docType != "" {
+		tags["docType"] = docType
+	}
+	return tags
+}
+
+// captureError reports a handler failure to the error tracker
+func (s *Server) captureError(c fiber.Ctx, stage string, err error) {
+	tags := s.errorTags(c)
+	tags["stage"] = stage
+	s.sentry.CaptureException(fmt.Errorf("%s: %w", stage, err), tags)
+}
+
+// handlePanic is called by the recover middleware before the panic is turned into a 500
+func (s *Server) handlePanic(c fiber.Ctx, e any) {
+	panicsCounter.WithLabelValues(c.Route().Path).Inc()
+	s.requestLogger(c).Error("panic recovered",
+		zap.Any("panic", e),
+		zap.ByteString("stack", debug.Stack()),
+	)
+	s.sentry.CapturePanic(e, s.errorTags(c))
+}
+
+// errorStatus is the status the error handler will respond with for err
+func errorStatus(err error) int {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// errorHandler renders every error returned by a handler, including recovered panics,
+// as a BaseResponse. Only *fiber.Error messages are shown to the client.
+func (s *Server) errorHandler(c fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+	message := "Internal server error"
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		code = fiberErr.Code
+		message = fiberErr.Message
+	}
+
+	return c.Status(code).JSON(BaseResponse{
+		Success:   false,
+		Message:   message,
+		RequestID: requestid.FromContext(c),
+	})
+}
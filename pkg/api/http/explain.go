@@ -0,0 +1,132 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	CandidateChosen   = "chosen"
+	CandidateRejected = "rejected"
+
+	// maxCandidates bounds the candidates listed per field; near misses of a short key
+	// can match a large part of a long document
+	maxCandidates = 20
+)
+
+// Candidate is a block a strategy looked at for a field
+type Candidate struct {
+	BlockID    string  `json:"blockId,omitempty"`
+	Page       int32   `json:"page,omitempty"`
+	Text       string  `json:"text"`
+	Confidence float32 `json:"confidence,omitempty"`
+	// Outcome is chosen or rejected
+	Outcome string `json:"outcome"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// FieldExplanation tells which blocks the strategy of a field considered and why the
+// value was chosen or not found
+type FieldExplanation struct {
+	Strategy   string      `json:"strategy"`
+	Key        string      `json:"key,omitempty"`
+	Candidates []Candidate `json:"candidates"`
+	// Omitted counts the candidates beyond the listed ones
+	Omitted int    `json:"omitted,omitempty"`
+	Value   string `json:"value,omitempty"`
+	// Outcome is found, low_confidence, missing or not_applicable
+	Outcome string `json:"outcome"`
+}
+
+// Explanation returns the per field explanation of an explain parse, nil otherwise
+func (p *ReceiptParser) Explanation() map[string]*FieldExplanation {
+	return p.explanation
+}
+
+// beginExplain starts recording the candidates of field
+func (p *ReceiptParser) beginExplain(field string, strategy FieldStrategy) {
+	if !p.options.Explain {
+		return
+	}
+	if p.explanation == nil {
+		p.explanation = make(map[string]*FieldExplanation)
+	}
+	key := strategy.Key
+	if strategy.Strategy == StrategyCEL {
+		key = strategy.Expression
+	}
+	p.explaining = &FieldExplanation{Strategy: strategy.Strategy, Key: key, Candidates: []Candidate{}}
+	p.explanation[field] = p.explaining
+}
+
+// endExplain records the outcome of the current field; source is the block the value
+// was read from, rejected with reason when its confidence was too low
+func (p *ReceiptParser) endExplain(source *types.Block, value, outcome, reason string) {
+	if p.explaining == nil {
+		return
+	}
+	p.explaining.Outcome = outcome
+	if source != nil {
+		candidateOutcome := CandidateChosen
+		if reason != "" {
+			candidateOutcome = CandidateRejected
+		}
+		p.addCandidate(source, p.text(*source), candidateOutcome, reason)
+	}
+	if outcome == OutcomeFound {
+		p.explaining.Value = value
+	}
+	p.explaining = nil
+}
+
+// reject records a block the current field's strategy looked at and passed over
+func (p *ReceiptParser) reject(block *types.Block, text, format string, args ...any) {
+	if p.explaining == nil {
+		return
+	}
+	p.addCandidate(block, text, CandidateRejected, fmt.Sprintf(format, args...))
+}
+
+func (p *ReceiptParser) addCandidate(block *types.Block, text, outcome, reason string) {
+	// the chosen block is always listed
+	if len(p.explaining.Candidates) >= maxCandidates && outcome != CandidateChosen {
+		p.explaining.Omitted++
+		return
+	}
+	candidate := Candidate{Text: text, Outcome: outcome, Reason: reason}
+	if block != nil {
+		candidate.BlockID = blockID(*block)
+		candidate.Page = blockPage(*block)
+		candidate.Confidence = blockConfidence(*block)
+	}
+	p.explaining.Candidates = append(p.explaining.Candidates, candidate)
+}
+
+// nearMiss reports whether text contains key when case and surrounding colons are
+// ignored, the usual reason a key does not match
+func nearMiss(text, key string) bool {
+	if key == "" {
+		return false
+	}
+	lower := func(s string) string { return strings.ToLowerSpecial(unicode.TurkishCase, normalizeKey(s)) }
+	return strings.Contains(lower(text), lower(key))
+}
+
+// Explain godoc
+// @Summary Explain an extraction
+// @Description runs the extraction with full tracing and returns, per schema field, every block the strategy considered, why it was rejected and the final choice
+// @Tags Admin
+// @Accept multipart/form-data
+// @Produce json
+// @Param document formData file true "Document"
+// @Param docType formData string true "Document type"
+// @Router /api/v1/debug/explain [post]
+// @Success 200 {object} BaseResponse
+func (s *Server) explainHandler(c fiber.Ctx) error {
+	c.Locals("explain", true)
+	return s.testTextractorHandler(c)
+}
@@ -0,0 +1,576 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Computed schema fields are small expressions over the extracted fields:
+//
+//	"netTutar": "tutar - masraf"
+//	"tutarTutarli": "abs(tutar - toplam) < 0.01"
+//
+// Field values are read as numbers (Turkish "1.234,56 TL" and "1,234.56" both work),
+// booleans ("true"/"false", as returned by checkbox fields) or strings, depending on the
+// operator. Supported are + - * / == != < <= > >= && || ! parentheses, 'string' and
+// number literals, true, false and the functions abs, round, min, max, date, now and
+// sumColumn:
+//
+//	date(tarih) <= now()          dates are compared as unix seconds
+//	sumColumn('Tutar') == toplam  sums the numeric cells under a table header
+
+var errMissingField = errors.New("field not extracted")
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindBool
+)
+
+type exprValue struct {
+	kind valueKind
+	str  string
+	num  float64
+	b    bool
+}
+
+func (v exprValue) number() (float64, error) {
+	switch v.kind {
+	case kindNumber:
+		return v.num, nil
+	case kindString:
+		if n, ok := parseNumber(v.str); ok {
+			return n, nil
+		}
+		return 0, fmt.Errorf("%q is not a number", v.str)
+	default:
+		return 0, errors.New("boolean used as a number")
+	}
+}
+
+func (v exprValue) boolean() (bool, error) {
+	switch v.kind {
+	case kindBool:
+		return v.b, nil
+	case kindString:
+		if b, err := strconv.ParseBool(strings.TrimSpace(v.str)); err == nil {
+			return b, nil
+		}
+		return false, fmt.Errorf("%q is not a boolean", v.str)
+	default:
+		return false, errors.New("number used as a boolean")
+	}
+}
+
+// String formats the value the way it is returned in the extracted info
+func (v exprValue) String() string {
+	switch v.kind {
+	case kindNumber:
+		return strconv.FormatFloat(v.num, 'f', -1, 64)
+	case kindBool:
+		return strconv.FormatBool(v.b)
+	default:
+		return v.str
+	}
+}
+
+// parseNumber reads amounts as printed on receipts. With both separators the last one is
+// the decimal separator; a lone dot followed by three digits is a thousands separator.
+func parseNumber(text string) (float64, bool) {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(text) {
+		if unicode.IsDigit(r) || r == '.' || r == ',' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+	s := b.String()
+	if s == "" || s == "-" {
+		return 0, false
+	}
+
+	dot, comma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case dot >= 0 && comma >= 0 && comma > dot:
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	case dot >= 0 && comma >= 0:
+		s = strings.ReplaceAll(s, ",", "")
+	case comma >= 0:
+		s = strings.ReplaceAll(s, ".", "")
+		if strings.Count(s, ",") > 1 {
+			return 0, false
+		}
+		s = strings.Replace(s, ",", ".", 1)
+	case dot >= 0 && (strings.Count(s, ".") > 1 || len(s)-dot-1 == 3):
+		s = strings.ReplaceAll(s, ".", "")
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	return n, err == nil
+}
+
+// exprEnv resolves the fields and table columns an expression reads
+type exprEnv interface {
+	field(name string) (string, bool)
+	// column returns the data cells under the header containing header, in the tables
+	// whose title contains title
+	column(header, title string) []string
+}
+
+type expr interface {
+	eval(env exprEnv) (exprValue, error)
+	// fields calls fn for every field the expression reads
+	fields(fn func(string))
+}
+
+type literalExpr struct{ value exprValue }
+
+type fieldExpr struct{ name string }
+
+type unaryExpr struct {
+	op      string
+	operand expr
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+type callExpr struct {
+	name string
+	args []expr
+}
+
+func (e literalExpr) eval(exprEnv) (exprValue, error) { return e.value, nil }
+func (e literalExpr) fields(func(string))             {}
+
+func (e fieldExpr) eval(env exprEnv) (exprValue, error) {
+	value, ok := env.field(e.name)
+	if !ok {
+		return exprValue{}, fmt.Errorf("%s: %w", e.name, errMissingField)
+	}
+	return exprValue{kind: kindString, str: value}, nil
+}
+func (e fieldExpr) fields(fn func(string)) { fn(e.name) }
+
+func (e unaryExpr) eval(env exprEnv) (exprValue, error) {
+	v, err := e.operand.eval(env)
+	if err != nil {
+		return exprValue{}, err
+	}
+	if e.op == "!" {
+		b, err := v.boolean()
+		return exprValue{kind: kindBool, b: !b}, err
+	}
+	n, err := v.number()
+	return exprValue{kind: kindNumber, num: -n}, err
+}
+func (e unaryExpr) fields(fn func(string)) { e.operand.fields(fn) }
+
+func (e binaryExpr) eval(env exprEnv) (exprValue, error) {
+	left, err := e.left.eval(env)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	// && and || only evaluate the right side when needed
+	if e.op == "&&" || e.op == "||" {
+		l, err := left.boolean()
+		if err != nil {
+			return exprValue{}, err
+		}
+		if l == (e.op == "||") {
+			return exprValue{kind: kindBool, b: l}, nil
+		}
+		right, err := e.right.eval(env)
+		if err != nil {
+			return exprValue{}, err
+		}
+		r, err := right.boolean()
+		return exprValue{kind: kindBool, b: r}, err
+	}
+
+	right, err := e.right.eval(env)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	if e.op == "==" || e.op == "!=" {
+		equal := false
+		l, lerr := left.number()
+		r, rerr := right.number()
+		switch {
+		case lerr == nil && rerr == nil:
+			equal = l == r
+		case left.kind == kindBool || right.kind == kindBool:
+			lb, lerr := left.boolean()
+			rb, rerr := right.boolean()
+			equal = lerr == nil && rerr == nil && lb == rb
+		default:
+			equal = strings.TrimSpace(left.String()) == strings.TrimSpace(right.String())
+		}
+		return exprValue{kind: kindBool, b: equal == (e.op == "==")}, nil
+	}
+
+	l, err := left.number()
+	if err != nil {
+		return exprValue{}, err
+	}
+	r, err := right.number()
+	if err != nil {
+		return exprValue{}, err
+	}
+	switch e.op {
+	case "+":
+		return exprValue{kind: kindNumber, num: l + r}, nil
+	case "-":
+		return exprValue{kind: kindNumber, num: l - r}, nil
+	case "*":
+		return exprValue{kind: kindNumber, num: l * r}, nil
+	case "/":
+		if r == 0 {
+			return exprValue{}, errors.New("division by zero")
+		}
+		return exprValue{kind: kindNumber, num: l / r}, nil
+	case "<":
+		return exprValue{kind: kindBool, b: l < r}, nil
+	case "<=":
+		return exprValue{kind: kindBool, b: l <= r}, nil
+	case ">":
+		return exprValue{kind: kindBool, b: l > r}, nil
+	default:
+		return exprValue{kind: kindBool, b: l >= r}, nil
+	}
+}
+func (e binaryExpr) fields(fn func(string)) { e.left.fields(fn); e.right.fields(fn) }
+
+func (e callExpr) eval(env exprEnv) (exprValue, error) {
+	args := make([]exprValue, len(e.args))
+	for i, arg := range e.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return exprValue{}, err
+		}
+		args[i] = v
+	}
+
+	switch e.name {
+	case "now":
+		return exprValue{kind: kindNumber, num: float64(time.Now().Unix())}, nil
+	case "date":
+		t, ok := parseDate(args[0].String())
+		if !ok {
+			return exprValue{}, fmt.Errorf("%q is not a date", args[0].String())
+		}
+		return exprValue{kind: kindNumber, num: float64(t.Unix())}, nil
+	case "sumColumn":
+		var title string
+		if len(args) == 2 {
+			title = args[1].String()
+		}
+		cells := env.column(args[0].String(), title)
+		if len(cells) == 0 {
+			return exprValue{}, fmt.Errorf("column %s: %w", args[0].String(), errMissingField)
+		}
+		var sum float64
+		for _, cell := range cells {
+			if n, ok := parseNumber(cell); ok {
+				sum += n
+			}
+		}
+		return exprValue{kind: kindNumber, num: sum}, nil
+	}
+
+	nums := make([]float64, len(args))
+	for i, arg := range args {
+		n, err := arg.number()
+		if err != nil {
+			return exprValue{}, err
+		}
+		nums[i] = n
+	}
+
+	var result float64
+	switch e.name {
+	case "abs":
+		result = math.Abs(nums[0])
+	case "round":
+		scale := 1.0
+		if len(nums) == 2 {
+			scale = math.Pow(10, nums[1])
+		}
+		result = math.Round(nums[0]*scale) / scale
+	case "min":
+		result = nums[0]
+		for _, n := range nums[1:] {
+			result = math.Min(result, n)
+		}
+	case "max":
+		result = nums[0]
+		for _, n := range nums[1:] {
+			result = math.Max(result, n)
+		}
+	}
+	return exprValue{kind: kindNumber, num: result}, nil
+}
+
+func (e callExpr) fields(fn func(string)) {
+	for _, arg := range e.args {
+		arg.fields(fn)
+	}
+}
+
+// exprFunctions maps the supported functions to their minimum and maximum argument count
+var exprFunctions = map[string][2]int{
+	"abs":       {1, 1},
+	"round":     {1, 2},
+	"min":       {1, -1},
+	"max":       {1, -1},
+	"now":       {0, 0},
+	"date":      {1, 1},
+	"sumColumn": {1, 2},
+}
+
+// dateLayouts are the date formats found on the supported receipts
+var dateLayouts = []string{
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseDate reads a date in one of dateLayouts, as Turkey local time
+func parseDate(text string) (time.Time, bool) {
+	text = strings.TrimSpace(text)
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, text, turkeyTime); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+var turkeyTime = time.FixedZone("TRT", 3*60*60)
+
+// parseExpr compiles a computed field expression
+func parseExpr(src string) (expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenString
+	tokenIdent
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "!", "(", ")", ","}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i])})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i])})
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{kind: tokenOp, text: op})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q", r)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peekOp(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) binary(next func() (expr, error), ops ...string) (expr, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOp(ops...)
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) or() (expr, error)  { return p.binary(p.and, "||") }
+func (p *exprParser) and() (expr, error) { return p.binary(p.comparison, "&&") }
+func (p *exprParser) comparison() (expr, error) {
+	return p.binary(p.additive, "==", "!=", "<=", ">=", "<", ">")
+}
+func (p *exprParser) additive() (expr, error)       { return p.binary(p.multiplicative, "+", "-") }
+func (p *exprParser) multiplicative() (expr, error) { return p.binary(p.unary, "*", "/") }
+
+func (p *exprParser) unary() (expr, error) {
+	if op, ok := p.peekOp("!", "-"); ok {
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: op, operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (expr, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+
+	switch t.kind {
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return literalExpr{exprValue{kind: kindNumber, num: n}}, nil
+	case tokenString:
+		return literalExpr{exprValue{kind: kindString, str: t.text}}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return literalExpr{exprValue{kind: kindBool, b: t.text == "true"}}, nil
+		}
+		if _, ok := p.peekOp("("); ok {
+			return p.call(t.text)
+		}
+		return fieldExpr{name: t.text}, nil
+	}
+
+	if t.text != "(" {
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.peekOp(")"); !ok {
+		return nil, errors.New("missing )")
+	}
+	p.pos++
+	return e, nil
+}
+
+func (p *exprParser) call(name string) (expr, error) {
+	arity, ok := exprFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	p.pos++ // (
+
+	var args []expr
+	if _, ok := p.peekOp(")"); !ok {
+		for {
+			arg, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.peekOp(","); !ok {
+				break
+			}
+			p.pos++
+		}
+	}
+	if _, ok := p.peekOp(")"); !ok {
+		return nil, fmt.Errorf("missing ) after %s arguments", name)
+	}
+	p.pos++
+
+	if len(args) < arity[0] || (arity[1] >= 0 && len(args) > arity[1]) {
+		return nil, fmt.Errorf("wrong number of arguments for %s", name)
+	}
+	return callExpr{name: name, args: args}, nil
+}
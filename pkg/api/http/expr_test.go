@@ -0,0 +1,205 @@
+package http
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// mapEnv is an exprEnv over fixed fields and table columns
+type mapEnv struct {
+	values  map[string]string
+	columns map[string][]string
+}
+
+func (e mapEnv) field(name string) (string, bool) {
+	value, ok := e.values[name]
+	return value, ok
+}
+
+func (e mapEnv) column(header, title string) []string {
+	return e.columns[title+"/"+header]
+}
+
+var testExprEnv = mapEnv{
+	values: map[string]string{
+		"tutar":  "1.234,56 TL",
+		"masraf": "4,56",
+		"toplam": "1,234.56",
+		"sifir":  "0",
+		"onay":   "true",
+		"tarih":  "15.03.2024 14:30",
+		"banka":  " Papara ",
+	},
+	columns: map[string][]string{
+		"/Tutar":      {"10,00", "20,50", "-"},
+		"Ödeme/Tutar": {"5"},
+	},
+}
+
+func TestExprEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// precedence
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"10 - 4 - 3", "3"},
+		{"8 / 4 / 2", "1"},
+		{"-2 * 3", "-6"},
+		{"--2", "2"},
+		{"1 + 2 < 4", "true"},
+		{"1 < 2 == true", "true"},
+		{"true || false && false", "true"},
+		{"(true || false) && false", "false"},
+		{"!false && !false", "true"},
+		{"!(1 < 2)", "false"},
+
+		// fields are read as numbers, booleans or strings depending on the operator
+		{"tutar - masraf", "1230"},
+		{"abs(tutar - toplam) < 0.01", "true"},
+		{"onay && tutar > 1000", "true"},
+		{"banka == 'Papara'", "true"},
+		{`banka != "Papara"`, "false"},
+		{"onay == true", "true"},
+		{"sifir == 0", "true"},
+
+		// functions
+		{"abs(-1.5)", "1.5"},
+		{"round(2.345, 2)", "2.35"},
+		{"round(2.5)", "3"},
+		{"min(3, 1, 2)", "1"},
+		{"max(3, tutar, 2)", "1234.56"},
+		{"date(tarih) == date('2024-03-15 14:30:00')", "true"},
+		{"date(tarih) <= now()", "true"},
+		{"sumColumn('Tutar')", "30.5"},
+		{"sumColumn('Tutar', 'Ödeme')", "5"},
+
+		// short circuit skips the right side
+		{"false && eksik > 0", "false"},
+		{"true || 1 / 0", "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := parseExpr(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := e.eval(testExprEnv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExprEvalErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		missing bool
+		want    string
+	}{
+		{src: "1 / 0", want: "division by zero"},
+		{src: "tutar / sifir", want: "division by zero"},
+		{src: "tutar / (masraf - 4.56)", want: "division by zero"},
+		{src: "eksik + 1", missing: true},
+		{src: "abs(eksik)", missing: true},
+		{src: "true && eksik", missing: true},
+		{src: "sumColumn('Yok')", missing: true},
+		{src: "banka + 1", want: "is not a number"},
+		{src: "onay + 1", want: `"true" is not a number`},
+		{src: "(1 < 2) + 1", want: "boolean used as a number"},
+		{src: "tutar && true", want: "is not a boolean"},
+		{src: "date(banka)", want: "is not a date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := parseExpr(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = e.eval(testExprEnv)
+			switch {
+			case err == nil:
+				t.Fatal("no error")
+			case tt.missing && !errors.Is(err, errMissingField):
+				t.Errorf("got %v, want errMissingField", err)
+			case !tt.missing && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"", "unexpected end of expression"},
+		{"1 +", "unexpected end of expression"},
+		{"(1 + 2", "missing )"},
+		{"1 + 2)", `unexpected ")"`},
+		{"tutar masraf", `unexpected "masraf"`},
+		{"* 2", `unexpected "*"`},
+		{"'acik", "unterminated string"},
+		{"tutar # 2", "unexpected character '#'"},
+		{"tutar = 2", "unexpected character '='"},
+		{"1.2.3", `invalid number "1.2.3"`},
+		{"topla(1, 2)", "unknown function topla"},
+		{"abs()", "wrong number of arguments for abs"},
+		{"round(1, 2, 3)", "wrong number of arguments for round"},
+		{"now(1)", "wrong number of arguments for now"},
+		{"min(1, 2", "missing ) after min arguments"},
+		{"max(1,)", `unexpected ")"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := parseExpr(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExprFields(t *testing.T) {
+	e, err := parseExpr("abs(tutar - toplam) < 0.01 && date(tarih) <= now() || !onay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	e.fields(func(name string) { fields = append(fields, name) })
+	if got := strings.Join(fields, ","); got != "tutar,toplam,tarih,onay" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text string
+		want float64
+		ok   bool
+	}{
+		{"1.234,56 TL", 1234.56, true},
+		{"1,234.56", 1234.56, true},
+		{"1.234", 1234, true},
+		{"1.5", 1.5, true},
+		{"12,5", 12.5, true},
+		{"1.234.567", 1234567, true},
+		{"-45,00", -45, true},
+		{"1,234,567", 0, false},
+		{"TL", 0, false},
+		{"-", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseNumber(tt.text)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseNumber(%q) = %v, %v, want %v, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
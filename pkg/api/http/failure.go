@@ -0,0 +1,130 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+// ErrCodeNothingExtracted is returned when no schema field could be found in the document
+const ErrCodeNothingExtracted = "NOTHING_EXTRACTED"
+
+// ErrCodeUnknownDocType is returned for a docType that is neither a schema nor an alias
+const ErrCodeUnknownDocType = "UNKNOWN_DOC_TYPE"
+
+// CodePartialResult marks a 206 response whose data.missingFields lists the required
+// fields that were not found
+const CodePartialResult = "PARTIAL_RESULT"
+
+var (
+	errSchemaNotFound   = errors.New("schema not found")
+	errNothingExtracted = errors.New("no information could be extracted from the document")
+)
+
+// FieldAttempt is one schema field the parser looked for
+type FieldAttempt struct {
+	Field    string `json:"field"`
+	Key      string `json:"key"`
+	Strategy string `json:"strategy"`
+	// KeyFound tells whether the key text occurs anywhere in the document
+	KeyFound bool `json:"keyFound"`
+	Optional bool `json:"optional,omitempty"`
+}
+
+// FailureReport explains why nothing was extracted, without exposing the document
+type FailureReport struct {
+	DocType       string         `json:"docType"`
+	LinesDetected int            `json:"linesDetected"`
+	Attempts      []FieldAttempt `json:"attempts"`
+	Suggestions   []string       `json:"suggestions"`
+}
+
+// failureReport summarizes a parse that extracted nothing and suggests what to check
+func (s *AWSService) failureReport(docType string, parser *ReceiptParser) FailureReport {
+	lines := documentLines(parser.blocks)
+	report := FailureReport{
+		DocType:       docType,
+		LinesDetected: len(lines),
+		Attempts:      make([]FieldAttempt, 0, len(parser.schema.Fields)),
+	}
+
+	found, caseMismatch := 0, []string{}
+	for field, strategy := range parser.schema.Fields {
+		attempt := FieldAttempt{Field: field, Key: strategy.Key, Strategy: strategy.Strategy, Optional: strategy.Optional}
+		if strategy.Key != "" {
+			attempt.KeyFound = containsLine(lines, strategy.Key, false)
+			if attempt.KeyFound {
+				found++
+			} else if containsLine(lines, strategy.Key, true) {
+				caseMismatch = append(caseMismatch, strategy.Key)
+			}
+		}
+		report.Attempts = append(report.Attempts, attempt)
+	}
+	sort.Slice(report.Attempts, func(i, j int) bool {
+		return report.Attempts[i].Field < report.Attempts[j].Field
+	})
+
+	switch {
+	case len(lines) == 0:
+		report.Suggestions = append(report.Suggestions, "No text was detected, check that the scan is readable and not blank")
+	case found == 0:
+		report.Suggestions = append(report.Suggestions, fmt.Sprintf("None of the %s keys occur in the document, check the docType", docType))
+		if best := s.closestDocType(lines, docType); best != "" {
+			report.Suggestions = append(report.Suggestions, fmt.Sprintf("The document matches the keys of %s best", best))
+		}
+	default:
+		report.Suggestions = append(report.Suggestions, "Keys were found but no values next to them, the strategies may not fit this layout")
+	}
+	if len(caseMismatch) > 0 {
+		sort.Strings(caseMismatch)
+		report.Suggestions = append(report.Suggestions, fmt.Sprintf("Keys match only ignoring case: %s; set ignoreCase on their fields", strings.Join(caseMismatch, ", ")))
+	}
+	if n := len(parser.LowConfidence()); n > 0 {
+		report.Suggestions = append(report.Suggestions, fmt.Sprintf("%d values were held back by the minimum confidence", n))
+	}
+
+	return report
+}
+
+// closestDocType returns the other docType whose keys occur most often in the document
+func (s *AWSService) closestDocType(lines []string, exclude string) string {
+	best, bestCount := "", 0
+	for docType, schema := range s.schemas.Load().schemas {
+		if docType == exclude {
+			continue
+		}
+		count := 0
+		for _, strategy := range schema.Fields {
+			if strategy.Key != "" && containsLine(lines, strategy.Key, false) {
+				count++
+			}
+		}
+		if count > bestCount || (count == bestCount && count > 0 && docType < best) {
+			best, bestCount = docType, count
+		}
+	}
+	return best
+}
+
+func documentLines(blocks []types.Block) []string {
+	var lines []string
+	for _, block := range blocks {
+		if block.BlockType == types.BlockTypeLine && block.Text != nil {
+			lines = append(lines, blockText(block))
+		}
+	}
+	return lines
+}
+
+func containsLine(lines []string, key string, ignoreCase bool) bool {
+	for _, line := range lines {
+		if strings.Contains(line, key) || (ignoreCase && strings.Contains(strings.ToLower(line), strings.ToLower(key))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract"
+)
+
+// tableSeed is a table whose cells carry indexes and spans Textract should never send
+const tableSeed = `{"Blocks":[
+{"Id":"t","BlockType":"TABLE","Relationships":[{"Type":"CHILD","Ids":["c0","c1","c2","c3"]},{"Type":"MERGED_CELL","Ids":["m"]}]},
+{"Id":"c0","BlockType":"CELL","RowIndex":0,"ColumnIndex":1,"Relationships":[{"Type":"CHILD","Ids":["w"]}]},
+{"Id":"c1","BlockType":"CELL","RowIndex":-1,"ColumnIndex":-5},
+{"Id":"c2","BlockType":"CELL","RowIndex":2147483647,"ColumnIndex":1},
+{"Id":"c3","BlockType":"CELL","RowIndex":1,"ColumnIndex":2,"Relationships":[{"Type":"CHILD","Ids":["w"]}]},
+{"Id":"m","BlockType":"MERGED_CELL","RowIndex":1,"ColumnIndex":1,"RowSpan":2147483647,"ColumnSpan":3},
+{"Id":"w","BlockType":"WORD","Text":"Tutar"},
+{"Id":"l","BlockType":"LINE","Text":"Tutar: 10,00 TL"}]}`
+
+// celSeedSchema is a schema file with cel fields over the lines, forms and tables
+const celSeedSchema = `{"fuzz":{"type":"fuzz","fields":{
+"line":{"strategy":"cel","expression":"lines.filter(l, l.startsWith(\"Tutar\"))[0].split(\":\")[1].trim()"},
+"form":{"strategy":"cel","expression":"keyValues.exists(k, true) ? keyValues[keyValues.map(k, k)[0]] : \"\""},
+"cell":{"strategy":"cel","expression":"tables.size() > 0 && tables[0].rows.size() > 0 ? string(tables[0].rows[0][0]) : \"\""}}}}`
+
+// celFuzzExpressions are the expressions of the cel fields of fuzzSchema, KEY is the
+// quoted key
+var celFuzzExpressions = []string{
+	`lines.exists(l, l.contains(KEY)) ? lines.filter(l, l.contains(KEY))[0] : ""`,
+	`KEY in keyValues ? keyValues[KEY] : ""`,
+	`tables.size() > 0 && tables[0].rows.size() > 0 && tables[0].rows[0].size() > 0 ? string(tables[0].rows[0][0]) : ""`,
+	`tables.map(t, t.rows.size()).exists(n, n > 1000) ? "" : lines.join(" ")`,
+	`blocks.filter(b, b.text.contains(KEY) && has(b.left) && b.page >= 1).map(b, b.id + b.type + string(b.confidence)).join("")`,
+}
+
+// FuzzParse runs every embedded schema and every strategy over mutated AnalyzeDocument
+// responses: dropped Text, Id, indexes and relationships, relationships to missing
+// blocks and out of range cell indexes, as seen in unusual Textract output.
+func FuzzParse(f *testing.F) {
+	addFileSeeds(f, "testdata/*/*"+textractFixtureSuffix)
+	f.Add([]byte(tableSeed))
+
+	schemas, err := loadEmbeddedSchemas()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var output textract.AnalyzeDocumentOutput
+		if err := json.Unmarshal(data, &output); err != nil {
+			return
+		}
+		for _, schema := range schemas {
+			parseBothModes(output, schema)
+		}
+		parseBothModes(output, fuzzSchema(output))
+	})
+}
+
+func parseBothModes(output textract.AnalyzeDocumentOutput, schema DocumentSchema) {
+	for _, mode := range []string{ParseModeLenient, ParseModeStrict} {
+		_, _ = NewReceiptParser(output.Blocks, schema, ParseOptions{Mode: mode, MinConfidence: 50}).Parse()
+	}
+}
+
+// fuzzSchema looks up the text of every block with every strategy, so the strategies
+// also follow the matches deeper into the block graph. Only the first blocks get a cel
+// field since compiling the expressions dominates the run time otherwise.
+func fuzzSchema(output textract.AnalyzeDocumentOutput) DocumentSchema {
+	schema := DocumentSchema{Type: "fuzz", Fields: map[string]FieldStrategy{}, ReconstructLines: true}
+	celFields := 0
+	for i, block := range output.Blocks {
+		key := blockText(block)
+		strategy := FieldStrategy{Key: key, Strategy: strategies[i%len(strategies)]}
+		if strategy.Strategy == StrategyCEL {
+			if celFields == len(celFuzzExpressions) {
+				continue
+			}
+			strategy.Expression = strings.ReplaceAll(celFuzzExpressions[celFields], "KEY", strconv.Quote(key))
+			celFields++
+		}
+		schema.Fields[fmt.Sprintf("%s%d", strategy.Strategy, i)] = strategy
+	}
+	return schema
+}
+
+// FuzzLoadSchemas feeds malformed schema files through decoding and validation, then
+// parses the fixtures with the schemas that validate
+func FuzzLoadSchemas(f *testing.F) {
+	addFileSeeds(f, "schemas/*.json")
+	addFileSeeds(f, "../../../schema.json")
+	f.Add([]byte(celSeedSchema))
+
+	outputs := []textract.AnalyzeDocumentOutput{{}}
+	paths, _ := filepath.Glob("testdata/*/*" + textractFixtureSuffix)
+	for _, path := range paths {
+		outputs = append(outputs, readFixture(f, path))
+	}
+	var table textract.AnalyzeDocumentOutput
+	if err := json.Unmarshal([]byte(tableSeed), &table); err != nil {
+		f.Fatal(err)
+	}
+	outputs = append(outputs, table)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		schemas, err := parseSchemaFile(data)
+		if err != nil {
+			return
+		}
+		if err := validateSchemas(schemas); err != nil {
+			return
+		}
+		for _, schema := range schemas {
+			for _, output := range outputs {
+				_, _ = NewReceiptParser(output.Blocks, schema, ParseOptions{Mode: ParseModeStrict}).Parse()
+			}
+		}
+	})
+}
+
+func addFileSeeds(f *testing.F, pattern string) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
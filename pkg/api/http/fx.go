@@ -0,0 +1,309 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultFXBaseURL = "https://www.tcmb.gov.tr/kurlar"
+	defaultFXRate    = "forex-selling"
+	defaultFXTimeout = 5 * time.Second
+	fxCachePrefix    = "fx:"
+	// published bulletins never change, the TTL only bounds the cache size
+	fxCacheTTL = 30 * 24 * time.Hour
+	// weekends and holidays have no bulletin, the previous one applies
+	fxMaxLookback = 10
+)
+
+// FXConfig enables converting foreign currency amounts to TRY with the TCMB rate of the
+// document date. Schemas opt in with a "currency" section.
+type FXConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	BaseURL string `mapstructure:"base-url"`
+	// Rate is forex-buying, forex-selling, banknote-buying or banknote-selling
+	Rate    string        `mapstructure:"rate"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// CurrencyConversion names the fields a schema converts
+type CurrencyConversion struct {
+	// Amount is the field holding the amount, e.g. tutar
+	Amount string `json:"amount"`
+	// Currency is the field holding the ISO code; without it the code is read from the
+	// amount, e.g. "1.250,00 USD" or "€1,250.00"
+	Currency string `json:"currency,omitempty"`
+	// Date is the field holding the document date
+	Date string `json:"date"`
+	// RateField and ConvertedField name the added fields, exchangeRate and <amount>TRY
+	// by default
+	RateField      string `json:"rateField,omitempty"`
+	ConvertedField string `json:"convertedField,omitempty"`
+}
+
+var currencySymbols = map[string]string{"$": "USD", "€": "EUR", "£": "GBP"}
+
+// tcmbBulletin is the daily exchange rate bulletin of the Turkish central bank
+type tcmbBulletin struct {
+	Currencies []struct {
+		Code            string `xml:"CurrencyCode,attr"`
+		Unit            string `xml:"Unit"`
+		ForexBuying     string `xml:"ForexBuying"`
+		ForexSelling    string `xml:"ForexSelling"`
+		BanknoteBuying  string `xml:"BanknoteBuying"`
+		BanknoteSelling string `xml:"BanknoteSelling"`
+	} `xml:"Currency"`
+}
+
+// fxRates holds the TRY rate per currency of one bulletin
+type fxRates struct {
+	Date  string             `json:"date"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+var errNoBulletin = errors.New("no bulletin published")
+
+type fxService struct {
+	cfg    FXConfig
+	client *http.Client
+	pool   func() *redis.Pool
+	logger *zap.Logger
+
+	mu sync.Mutex
+	// memory caches bulletins when no cache server is configured
+	memory map[string]*fxRates
+}
+
+func newFXService(cfg FXConfig, transport http.RoundTripper, pool func() *redis.Pool, logger *zap.Logger) (*fxService, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultFXBaseURL
+	}
+	if cfg.Rate == "" {
+		cfg.Rate = defaultFXRate
+	}
+	switch cfg.Rate {
+	case "forex-buying", "forex-selling", "banknote-buying", "banknote-selling":
+	default:
+		return nil, fmt.Errorf("fx.rate must be forex-buying, forex-selling, banknote-buying or banknote-selling")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultFXTimeout
+	}
+	return &fxService{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		pool:   pool,
+		logger: logger,
+		memory: make(map[string]*fxRates),
+	}, nil
+}
+
+// rate returns the TRY rate of currency on date, taken from the latest bulletin
+// published on or before it
+func (f *fxService) rate(ctx context.Context, currency string, date time.Time) (float64, string, error) {
+	for i := 0; i < fxMaxLookback; i++ {
+		day := date.AddDate(0, 0, -i)
+		rates, err := f.bulletin(ctx, day)
+		if errors.Is(err, errNoBulletin) {
+			continue
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		rate, ok := rates.Rates[currency]
+		if !ok {
+			return 0, "", fmt.Errorf("TCMB publishes no rate for %s", currency)
+		}
+		return rate, rates.Date, nil
+	}
+	return 0, "", fmt.Errorf("no TCMB bulletin in the %d days before %s", fxMaxLookback, date.Format(time.DateOnly))
+}
+
+// bulletin loads the bulletin of day from the cache or from TCMB. Days without a
+// bulletin are cached too, as rates without entries.
+func (f *fxService) bulletin(ctx context.Context, day time.Time) (*fxRates, error) {
+	key := fxCachePrefix + f.cfg.Rate + ":" + day.Format(time.DateOnly)
+	if rates, ok := f.cached(key); ok {
+		if rates.Rates == nil {
+			return nil, errNoBulletin
+		}
+		return rates, nil
+	}
+
+	url := fmt.Sprintf("%s/%s/%s.xml", f.cfg.BaseURL, day.Format("200601"), day.Format("02012006"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	rates := &fxRates{Date: day.Format(time.DateOnly)}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var bulletin tcmbBulletin
+		if err := xml.NewDecoder(resp.Body).Decode(&bulletin); err != nil {
+			return nil, fmt.Errorf("TCMB bulletin %s: %w", rates.Date, err)
+		}
+		rates.Rates = f.parseRates(bulletin)
+	case http.StatusNotFound:
+		// the day of the document itself may not be published yet, do not cache it
+		if time.Since(day) < 24*time.Hour {
+			return nil, errNoBulletin
+		}
+	default:
+		return nil, fmt.Errorf("TCMB bulletin %s: %s", rates.Date, resp.Status)
+	}
+
+	f.store(key, rates)
+	if rates.Rates == nil {
+		return nil, errNoBulletin
+	}
+	return rates, nil
+}
+
+func (f *fxService) parseRates(bulletin tcmbBulletin) map[string]float64 {
+	rates := make(map[string]float64, len(bulletin.Currencies))
+	for _, currency := range bulletin.Currencies {
+		text := map[string]string{
+			"forex-buying":     currency.ForexBuying,
+			"forex-selling":    currency.ForexSelling,
+			"banknote-buying":  currency.BanknoteBuying,
+			"banknote-selling": currency.BanknoteSelling,
+		}[f.cfg.Rate]
+		rate, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil || rate <= 0 {
+			continue
+		}
+		unit, err := strconv.ParseFloat(strings.TrimSpace(currency.Unit), 64)
+		if err != nil || unit <= 0 {
+			unit = 1
+		}
+		rates[currency.Code] = rate / unit
+	}
+	return rates
+}
+
+func (f *fxService) cached(key string) (*fxRates, bool) {
+	pool := f.pool()
+	if pool == nil {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		rates, ok := f.memory[key]
+		return rates, ok
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	data, err := redis.Bytes(conn.Do("GET", key))
+	if err != nil {
+		return nil, false
+	}
+	var rates fxRates
+	if json.Unmarshal(data, &rates) != nil {
+		return nil, false
+	}
+	return &rates, true
+}
+
+func (f *fxService) store(key string, rates *fxRates) {
+	pool := f.pool()
+	if pool == nil {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.memory[key] = rates
+		return
+	}
+	data, err := json.Marshal(rates)
+	if err != nil {
+		return
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("SET", key, data, "EX", int(fxCacheTTL.Seconds())); err != nil {
+		f.logger.Warn("fx cache write failed", zap.Error(err))
+	}
+}
+
+// amountCurrency returns the ISO code written next to an amount, TRY if there is none
+func amountCurrency(amount string) string {
+	for symbol, code := range currencySymbols {
+		if strings.Contains(amount, symbol) {
+			return code
+		}
+	}
+	for _, word := range strings.Fields(strings.ToUpper(amount)) {
+		word = strings.Trim(word, ".,:;()")
+		if len(word) == 3 && strings.IndexFunc(word, func(r rune) bool { return r < 'A' || r > 'Z' }) < 0 {
+			return word
+		}
+	}
+	return "TRY"
+}
+
+// convertCurrency adds the TCMB rate and the TRY amount to a foreign currency result.
+// Failures are logged and leave the result unchanged, the extraction itself succeeded.
+func (s *Server) convertCurrency(ctx context.Context, extractedInfo ExtractedInfo, parser *ReceiptParser) {
+	conversion := parser.schema.Currency
+	if s.fx == nil || conversion == nil {
+		return
+	}
+	amountText, ok := extractedInfo[conversion.Amount]
+	if !ok {
+		return
+	}
+	currency := amountCurrency(amountText)
+	if conversion.Currency != "" {
+		if code, ok := extractedInfo[conversion.Currency]; ok {
+			currency = strings.ToUpper(strings.TrimSpace(code))
+		}
+	}
+	if currency == "TRY" || currency == "TL" || currency == "" {
+		return
+	}
+
+	logger := s.logger.With(zap.String("currency", currency))
+	amount, ok := parseNumber(amountText)
+	if !ok {
+		logger.Warn("Amount to convert is not a number")
+		parser.warn(WarnNormalizationFailed, conversion.Amount, "amount is not a number, it was not converted to TRY")
+		return
+	}
+	date, ok := parseDate(extractedInfo[conversion.Date])
+	if !ok {
+		logger.Warn("Document date for currency conversion not found")
+		parser.warn(WarnNormalizationFailed, conversion.Date, "date is missing or not a date, the amount was not converted to TRY")
+		return
+	}
+	rate, bulletinDate, err := s.fx.rate(ctx, currency, date)
+	if err != nil {
+		logger.Warn("Failed to get exchange rate", zap.Error(err))
+		return
+	}
+
+	rateField := withDefault(conversion.RateField, "exchangeRate")
+	convertedField := withDefault(conversion.ConvertedField, conversion.Amount+"TRY")
+	extractedInfo[rateField] = strconv.FormatFloat(rate, 'f', -1, 64)
+	extractedInfo[convertedField] = strconv.FormatFloat(amount*rate, 'f', 2, 64)
+
+	source := fmt.Sprintf("TCMB %s %s %s", s.fx.cfg.Rate, currency, bulletinDate)
+	provenance := parser.Provenance()
+	provenance[rateField] = FieldProvenance{Strategy: StrategyComputed, Key: source, Confidence: 100}
+	provenance[convertedField] = FieldProvenance{Strategy: StrategyComputed, Key: source, Confidence: provenance[conversion.Amount].Confidence}
+}
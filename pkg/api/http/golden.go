@@ -0,0 +1,190 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract"
+)
+
+const (
+	textractFixtureSuffix = ".textract.json"
+	goldenSuffix          = ".golden.json"
+)
+
+// goldenFixture is a saved Textract response and the golden file of its parser output
+type goldenFixture struct {
+	docType    string
+	name       string
+	path       string
+	goldenFile string
+}
+
+// findGoldenFixtures lists the <docType>/<name>.textract.json fixtures below dir
+func findGoldenFixtures(dir string) ([]goldenFixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*"+textractFixtureSuffix))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no fixtures found in %s", dir)
+	}
+	fixtures := make([]goldenFixture, 0, len(paths))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), textractFixtureSuffix)
+		fixtures = append(fixtures, goldenFixture{
+			docType:    filepath.Base(filepath.Dir(path)),
+			name:       name,
+			path:       path,
+			goldenFile: filepath.Join(filepath.Dir(path), name+goldenSuffix),
+		})
+	}
+	return fixtures, nil
+}
+
+// runGoldenFixtures parses every <docType>/<name>.textract.json fixture below dir with the
+// schema for docType and compares the result with <name>.golden.json. The schemas are the
+// embedded ones, merged with schemaFile if set. With update set the golden files are
+// rewritten instead. It returns false if any fixture regressed.
+func runGoldenFixtures(dir, schemaFile string, update bool, out io.Writer) (bool, error) {
+	schemas, err := loadSchemas(schemaFile)
+	if err != nil {
+		return false, err
+	}
+
+	fixtures, err := findGoldenFixtures(dir)
+	if err != nil {
+		return false, err
+	}
+
+	passed := true
+	for _, fixture := range fixtures {
+		docType, name := fixture.docType, fixture.name
+		schema, ok := schemas[docType]
+		if !ok {
+			return false, fmt.Errorf("%s: no schema for document type %s", fixture.path, docType)
+		}
+
+		got, err := parseFixture(fixture.path, schema)
+		if err != nil {
+			return false, err
+		}
+
+		if update {
+			if err := os.WriteFile(fixture.goldenFile, got, 0644); err != nil {
+				return false, err
+			}
+			fmt.Fprintf(out, "[UPDATE] %s/%s\n", docType, name)
+			continue
+		}
+
+		want, err := os.ReadFile(fixture.goldenFile)
+		if err != nil {
+			return false, err
+		}
+		if bytes.Equal(bytes.TrimSpace(want), bytes.TrimSpace(got)) {
+			fmt.Fprintf(out, "[ OK ] %s/%s\n", docType, name)
+			continue
+		}
+
+		passed = false
+		fmt.Fprintf(out, "[FAIL] %s/%s\n", docType, name)
+		if err := diffExtractedInfo(out, want, got); err != nil {
+			return false, fmt.Errorf("%s: %w", fixture.goldenFile, err)
+		}
+	}
+
+	return passed, nil
+}
+
+// parseFixture runs the parser over a saved AnalyzeDocument response and returns the
+// result in golden file form
+func parseFixture(fixture string, schema DocumentSchema) ([]byte, error) {
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		return nil, err
+	}
+	var output textract.AnalyzeDocumentOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("%s: %w", fixture, err)
+	}
+
+	extractedInfo, err := NewReceiptParser(output.Blocks, schema, ParseOptions{Mode: ParseModeStrict}).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fixture, err)
+	}
+
+	got, err := json.MarshalIndent(extractedInfo, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(got, '\n'), nil
+}
+
+// diffExtractedInfo prints the fields that differ between the golden and the actual output
+func diffExtractedInfo(out io.Writer, wantData, gotData []byte) error {
+	diffs, err := fieldDiffs(wantData, gotData)
+	if err != nil {
+		return err
+	}
+	for _, diff := range diffs {
+		switch {
+		case !diff.InGot:
+			fmt.Fprintf(out, "    - %s: %q\n", diff.Field, diff.Want)
+		case !diff.InWant:
+			fmt.Fprintf(out, "    + %s: %q\n", diff.Field, diff.Got)
+		default:
+			fmt.Fprintf(out, "    - %s: %q\n    + %s: %q\n", diff.Field, diff.Want, diff.Field, diff.Got)
+		}
+	}
+	return nil
+}
+
+// FieldDiff is a field whose parsed value differs from the golden file; a field missing
+// from either side has InWant or InGot unset
+type FieldDiff struct {
+	Field  string `json:"field"`
+	Want   string `json:"want,omitempty"`
+	Got    string `json:"got,omitempty"`
+	InWant bool   `json:"inWant"`
+	InGot  bool   `json:"inGot"`
+}
+
+// fieldDiffs compares the golden and the actual output field by field, sorted by field
+func fieldDiffs(wantData, gotData []byte) ([]FieldDiff, error) {
+	var want, got ExtractedInfo
+	if err := json.Unmarshal(wantData, &want); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(gotData, &got); err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(want)+len(got))
+	for field := range want {
+		fields = append(fields, field)
+	}
+	for field := range got {
+		if _, ok := want[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var diffs []FieldDiff
+	for _, field := range fields {
+		wantValue, inWant := want[field]
+		gotValue, inGot := got[field]
+		if inWant && inGot && wantValue == gotValue {
+			continue
+		}
+		diffs = append(diffs, FieldDiff{Field: field, Want: wantValue, Got: gotValue, InWant: inWant, InGot: inGot})
+	}
+	return diffs, nil
+}
@@ -0,0 +1,26 @@
+package http
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+var (
+	updateGolden     = flag.Bool("update", false, "rewrite the golden files from the current parser output")
+	goldenSchemaFile = flag.String("schema-file", "", "schema file merged over the embedded schemas, as deployed")
+)
+
+// TestGoldenFixtures checks the parser against the Textract fixtures in testdata; after an
+// intended parser change run it with -args -update to rewrite the golden files
+func TestGoldenFixtures(t *testing.T) {
+	var out strings.Builder
+	passed, err := runGoldenFixtures("testdata", *goldenSchemaFile, *updateGolden, &out)
+	t.Log("\n" + out.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !passed {
+		t.Error("the parser output differs from the golden files")
+	}
+}
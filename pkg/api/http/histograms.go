@@ -0,0 +1,85 @@
+package http
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	HistogramHTTPRequestDuration   = "http_request_duration_seconds"
+	HistogramPipelineStageDuration = "pipeline_stage_duration_seconds"
+	HistogramDocumentSize          = "document_size_bytes"
+	HistogramDocumentPages         = "document_pages"
+)
+
+// HistogramConfig tunes the buckets of one histogram, keyed by its metric name under
+// histograms in the config
+type HistogramConfig struct {
+	Buckets []float64 `mapstructure:"buckets"`
+	// NativeBucketFactor above 1 also exposes a native histogram with this growth factor
+	// between buckets, e.g. 1.1; scrapers without native histogram support keep using Buckets
+	NativeBucketFactor float64 `mapstructure:"native-bucket-factor"`
+	NativeMaxBuckets   uint32  `mapstructure:"native-max-buckets"`
+}
+
+// textractBuckets reach up to five minutes; async Textract jobs and large PDFs are far
+// above prometheus.DefBuckets' 10 second limit
+var textractBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+
+// documentSizeBuckets double from 16 KiB to 32 MiB, past the largest body limit in use
+var documentSizeBuckets = prometheus.ExponentialBuckets(16<<10, 2, 12)
+
+var documentPageBuckets = []float64{1, 2, 3, 5, 10, 20, 50, 100, 200, 500, 1000, 3000}
+
+var defaultHistograms = map[string]HistogramConfig{
+	HistogramHTTPRequestDuration:   {Buckets: textractBuckets},
+	HistogramPipelineStageDuration: {Buckets: textractBuckets},
+	HistogramDocumentSize:          {Buckets: documentSizeBuckets},
+	HistogramDocumentPages:         {Buckets: documentPageBuckets},
+}
+
+// validateHistograms rejects unknown histogram names and unsorted buckets, which
+// prometheus would panic on at registration
+func validateHistograms(histograms map[string]HistogramConfig) error {
+	for name, cfg := range histograms {
+		if _, ok := defaultHistograms[name]; !ok {
+			return fmt.Errorf("unknown histogram %q", name)
+		}
+		for i := 1; i < len(cfg.Buckets); i++ {
+			if cfg.Buckets[i] <= cfg.Buckets[i-1] {
+				return fmt.Errorf("histogram %s: buckets must be in increasing order", name)
+			}
+		}
+		if cfg.NativeBucketFactor != 0 && cfg.NativeBucketFactor <= 1 {
+			return fmt.Errorf("histogram %s: native-bucket-factor must be above 1", name)
+		}
+	}
+	return nil
+}
+
+// histogramOpts applies the configured buckets of opts' metric over the defaults
+func (s *Server) histogramOpts(opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	name := prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)
+	cfg := defaultHistograms[name]
+	if configured, ok := s.config.Histograms[name]; ok {
+		if len(configured.Buckets) > 0 {
+			cfg.Buckets = configured.Buckets
+		}
+		cfg.NativeBucketFactor = configured.NativeBucketFactor
+		cfg.NativeMaxBuckets = configured.NativeMaxBuckets
+	}
+
+	opts.Buckets = cfg.Buckets
+	if cfg.NativeBucketFactor > 1 {
+		opts.NativeHistogramBucketFactor = cfg.NativeBucketFactor
+		opts.NativeHistogramMaxBucketNumber = cfg.NativeMaxBuckets
+		if opts.NativeHistogramMaxBucketNumber == 0 {
+			opts.NativeHistogramMaxBucketNumber = 160
+		}
+		// reset instead of losing resolution once the bucket limit is hit
+		opts.NativeHistogramMinResetDuration = time.Hour
+	}
+	return opts
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+)
+
+// Custom builds extend the analysis pipeline by registering hooks from an init function,
+// the way database/sql drivers register, and importing their package for its side
+// effects in cmd/api:
+//
+//	func init() {
+//		http.RegisterHook("acme-validation", acmeHook{})
+//	}
+//
+// A hook implements one or more of PreAnalysisHook, PostExtractionHook and
+// PreResponseHook. Hooks run in registration order.
+
+// AnalysisRequest is the document a request analyzes, after decryption and image
+// conversion
+type AnalysisRequest struct {
+	DocType string
+	// Document may be replaced by the hook
+	Document []byte
+	// FormValue returns a form field of the request
+	FormValue func(key string) string
+}
+
+// ExtractionResult is the outcome of a successful parse, before personal data is masked
+type ExtractionResult struct {
+	DocType string
+	// Fields may be changed or extended by the hook
+	Fields ExtractedInfo
+	// Provenance tells where each field was read from; hooks adding a field may record
+	// its source with StrategyHook
+	Provenance map[string]FieldProvenance
+}
+
+// PreAnalysisHook runs before the cache lookup and the Textract call
+type PreAnalysisHook interface {
+	PreAnalysis(ctx context.Context, req *AnalysisRequest) error
+}
+
+// PostExtractionHook runs after the schema fields are extracted and computed. Returning
+// a *ValidationError fails the request with VALIDATION_FAILED like a schema assertion.
+type PostExtractionHook interface {
+	PostExtraction(ctx context.Context, result *ExtractionResult) error
+}
+
+// PreResponseHook sees the responses of the analysis pipeline, successful or not, before
+// they are sent; request errors such as an unknown docType are not passed to it
+type PreResponseHook interface {
+	PreResponse(ctx context.Context, docType string, status int, response *BaseResponse)
+}
+
+// StrategyHook marks the provenance of a field set by a hook; it is not a search strategy
+const StrategyHook = "hook"
+
+// HookError rejects a request with the given status and code, other hook errors fail it
+// with 500
+type HookError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *HookError) Error() string {
+	return e.Message
+}
+
+type registeredHook struct {
+	name string
+	hook any
+}
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []registeredHook
+)
+
+// RegisterHook adds a pipeline hook. It panics if name is registered twice or hook
+// implements none of the hook interfaces.
+func RegisterHook(name string, hook any) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	for _, registered := range hooks {
+		if registered.name == name {
+			panic(fmt.Sprintf("http: hook %s registered twice", name))
+		}
+	}
+	_, pre := hook.(PreAnalysisHook)
+	_, post := hook.(PostExtractionHook)
+	_, response := hook.(PreResponseHook)
+	if !pre && !post && !response {
+		panic(fmt.Sprintf("http: hook %s implements no hook interface", name))
+	}
+	hooks = append(hooks, registeredHook{name: name, hook: hook})
+}
+
+func registeredHooks() []registeredHook {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	return hooks
+}
+
+func (s *Server) logHooks() {
+	registered := registeredHooks()
+	if len(registered) == 0 {
+		return
+	}
+	names := make([]string, len(registered))
+	for i, hook := range registered {
+		names[i] = hook.name
+	}
+	s.logger.Info("Pipeline hooks registered", zap.Strings("hooks", names))
+}
+
+func (s *Server) runPreAnalysisHooks(ctx context.Context, req *AnalysisRequest) error {
+	for _, registered := range registeredHooks() {
+		if hook, ok := registered.hook.(PreAnalysisHook); ok {
+			if err := hook.PreAnalysis(ctx, req); err != nil {
+				return fmt.Errorf("hook %s: %w", registered.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) runPostExtractionHooks(ctx context.Context, docType string, extractedInfo ExtractedInfo, parser *ReceiptParser) error {
+	result := &ExtractionResult{DocType: docType, Fields: extractedInfo, Provenance: parser.Provenance()}
+	for _, registered := range registeredHooks() {
+		if hook, ok := registered.hook.(PostExtractionHook); ok {
+			if err := hook.PostExtraction(ctx, result); err != nil {
+				return fmt.Errorf("hook %s: %w", registered.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// hookFailed answers a request a hook rejected or failed on
+func (s *Server) hookFailed(c fiber.Ctx, docType string, err error) error {
+	var rejected *HookError
+	if errors.As(err, &rejected) {
+		s.requestLogger(c).Info("Request rejected by hook", zap.Error(err))
+		return s.respond(c, docType, rejected.Status, BaseResponse{
+			Success: false,
+			Message: rejected.Message,
+			Code:    rejected.Code,
+		})
+	}
+	s.requestLogger(c).Error("Pipeline hook failed", zap.Error(err))
+	s.captureError(c, "hook", err)
+	return s.respond(c, docType, fiber.StatusInternalServerError, BaseResponse{
+		Success: false,
+		Message: "Failed to analyze document",
+	})
+}
+
+// respond runs the pre-response hooks and sends response
+func (s *Server) respond(c fiber.Ctx, docType string, status int, response BaseResponse) error {
+	for _, registered := range registeredHooks() {
+		if hook, ok := registered.hook.(PreResponseHook); ok {
+			hook.PreResponse(c.UserContext(), docType, status, &response)
+		}
+	}
+	return c.Status(status).JSON(response)
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// keyMatcher folds keys and block text for the normalizeKeys flag of the schema and the
+// ignoreCase and ignoreDiacritics flags of a field. Casers and transformers keep state, so
+// every parser has its own, created on first use.
+type keyMatcher struct {
+	normalize        bool
+	ignoreCase       bool
+	ignoreDiacritics bool
+	lower            *cases.Caser
+	strip            transform.Transformer
+}
+
+// set applies the flags of the field about to be searched
+func (m *keyMatcher) set(strategy FieldStrategy) {
+	m.ignoreCase, m.ignoreDiacritics = strategy.IgnoreCase, strategy.IgnoreDiacritics
+	if m.ignoreCase && m.lower == nil {
+		// Turkish rules lower İ to i and I to ı; the root locale would turn "TARIH" into
+		// "tarih" and "İBAN" into "i̇ban"
+		lower := cases.Lower(language.Turkish)
+		m.lower = &lower
+	}
+	if m.ignoreDiacritics && m.strip == nil {
+		m.strip = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	}
+}
+
+// fold returns text in the form the current field compares keys in
+func (m *keyMatcher) fold(text string) string {
+	if m.normalize {
+		text = normalizeKeyText(text)
+	}
+	if m.ignoreCase {
+		text = m.lower.String(text)
+	}
+	if m.ignoreDiacritics {
+		// ı has no decomposition, its missing dot is not a mark
+		text = strings.ReplaceAll(text, "ı", "i")
+		text, _, _ = transform.String(m.strip, text)
+	}
+	return text
+}
+
+// keyDashes are the dashes OCR reads in place of a hyphen
+var keyDashes = strings.NewReplacer("‐", "-", "‑", "-", "‒", "-", "–", "-", "—", "-", "―", "-", "−", "-")
+
+// normalizeKeyText collapses whitespace, unifies dashes, drops the space OCR puts before
+// colons and strips trailing colons and dots: "Gönderen :" and "Gönderen:" both become
+// "Gönderen", "Valör Tarihi – " becomes "Valör Tarihi -"
+func normalizeKeyText(text string) string {
+	text = strings.Join(strings.Fields(keyDashes.Replace(text)), " ")
+	text = strings.ReplaceAll(text, " :", ":")
+	return strings.TrimRight(text, " :.")
+}
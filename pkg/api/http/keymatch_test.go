@@ -0,0 +1,105 @@
+package http
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+func TestKeyMatcherFold(t *testing.T) {
+	tests := []struct {
+		text, key                    string
+		ignoreCase, ignoreDiacritics bool
+		match                        bool
+	}{
+		{"Tarih", "Tarih", false, false, true},
+		{"TARİH", "tarih", false, false, false},
+		{"TARİH", "tarih", true, false, true},
+		// Turkish casing lowers I to ı
+		{"TARIH", "tarih", true, false, false},
+		{"TARIH", "tarıh", true, false, true},
+		{"İBAN", "iban", true, false, true},
+		{"Gönderen", "Gonderen", false, true, true},
+		{"Alıcı", "Alici", false, true, true},
+		{"Şube Çağrı Üye", "Sube Cagri Uye", false, true, true},
+		{"ALICI", "Alıcı", false, true, false},
+		{"ALICI", "alici", true, true, true},
+		{"GÖNDEREN", "Gonderen", true, true, true},
+		{"Gönderen:", "Gönderen", true, true, false},
+	}
+	for _, tt := range tests {
+		m := keyMatcher{}
+		m.set(FieldStrategy{IgnoreCase: tt.ignoreCase, IgnoreDiacritics: tt.ignoreDiacritics})
+		if got := m.fold(tt.text) == m.fold(tt.key); got != tt.match {
+			t.Errorf("%q and %q with ignoreCase %v, ignoreDiacritics %v: match %v, want %v",
+				tt.text, tt.key, tt.ignoreCase, tt.ignoreDiacritics, got, tt.match)
+		}
+	}
+}
+
+func TestParseKeyMatchFlags(t *testing.T) {
+	blocks := []types.Block{textBlock(types.BlockTypeLine, "l", "GONDEREN: Ali Demir")}
+	tests := []struct {
+		name     string
+		strategy FieldStrategy
+		fuzzy    bool
+	}{
+		{"fuzzy fallback", FieldStrategy{}, true},
+		{"flags", FieldStrategy{IgnoreCase: true, IgnoreDiacritics: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.strategy.Key, tt.strategy.Strategy = "Gönderen", StrategySameLine
+			value, parser := parseField(t, blocks, tt.strategy, ParseOptions{Mode: ParseModeStrict})
+			if value != "Ali Demir" {
+				t.Errorf("got %q", value)
+			}
+			if warned := slices.ContainsFunc(parser.Warnings(), func(w Warning) bool { return w.Code == WarnFuzzyKeyMatch }); warned != tt.fuzzy {
+				t.Errorf("got warnings %+v", parser.Warnings())
+			}
+		})
+	}
+}
+
+func TestNormalizeKeyText(t *testing.T) {
+	tests := map[string]string{
+		"Gönderen":             "Gönderen",
+		"Gönderen:":            "Gönderen",
+		"Gönderen :":           "Gönderen",
+		" Gönderen  : ":        "Gönderen",
+		"Ref. No.":             "Ref. No",
+		"Alıcı  Adı\tSoyadı":   "Alıcı Adı Soyadı",
+		"Valör Tarihi – ":      "Valör Tarihi -",
+		"Ödeme—Tarihi":         "Ödeme-Tarihi",
+		"İşlem Tarihi : 01.02": "İşlem Tarihi: 01.02",
+		"":                     "",
+	}
+	for text, want := range tests {
+		if got := normalizeKeyText(text); got != want {
+			t.Errorf("normalizeKeyText(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestParseNormalizeKeys(t *testing.T) {
+	blocks := []types.Block{
+		textBlock(types.BlockTypeLine, "l1", "Valör  Tarihi –"),
+		textBlock(types.BlockTypeLine, "l2", "01.02.2024"),
+	}
+	strategy := FieldStrategy{Key: "Valör Tarihi -", Strategy: StrategyNextLine}
+	for _, normalize := range []bool{false, true} {
+		schema := DocumentSchema{Type: "test", Fields: map[string]FieldStrategy{"alan": strategy}, NormalizeKeys: normalize}
+		parser := NewReceiptParser(blocks, schema, ParseOptions{Mode: ParseModeStrict})
+		info, err := parser.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[bool]string{false: "", true: "01.02.2024"}[normalize]; info["alan"] != want {
+			t.Errorf("normalizeKeys %v: got %q, want %q", normalize, info["alan"], want)
+		}
+		if len(parser.Warnings()) > 0 {
+			t.Errorf("normalizeKeys %v: got warnings %+v", normalize, parser.Warnings())
+		}
+	}
+}
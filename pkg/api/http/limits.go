@@ -0,0 +1,152 @@
+package http
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	defaultBodyLimit        = 1 << 20
+	defaultAnalyzeBodyLimit = 20 << 20
+	defaultHeaderLimit      = 8 << 10
+)
+
+// RouteLimit overrides the request size limits for a single route
+type RouteLimit struct {
+	BodyLimit   int `mapstructure:"body-limit"`
+	HeaderLimit int `mapstructure:"header-limit"`
+}
+
+// defaultRouteLimits lets the analyze endpoints accept full size scans
+var defaultRouteLimits = map[string]RouteLimit{
+	"/api/v1/test":          {BodyLimit: defaultAnalyzeBodyLimit},
+	"/api/v1/debug/explain": {BodyLimit: defaultAnalyzeBodyLimit},
+	"/api/v1/uploads/:id":   {BodyLimit: defaultAnalyzeBodyLimit},
+}
+
+// routeLimit is a RouteLimit with the route pattern it applies to
+type routeLimit struct {
+	RouteLimit
+	pattern string
+}
+
+// routeLimits merges the configured overrides over the defaults, ordered so that the
+// first matching pattern is the most specific one: a path like /api/v1/uploads/status
+// takes the limit of that route over /api/v1/uploads/:id
+func (s *Server) routeLimits() []routeLimit {
+	merged := make(map[string]RouteLimit, len(defaultRouteLimits)+len(s.config.RouteLimits))
+	for route, limit := range defaultRouteLimits {
+		merged[route] = limit
+	}
+	for route, limit := range s.config.RouteLimits {
+		merged[route] = limit
+	}
+
+	limits := make([]routeLimit, 0, len(merged))
+	for route, limit := range merged {
+		limits = append(limits, routeLimit{RouteLimit: limit, pattern: route})
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		return moreSpecificRoute(limits[i].pattern, limits[j].pattern)
+	})
+	return limits
+}
+
+// moreSpecificRoute orders route patterns by their literal segments: more literal
+// segments first, then the pattern whose first literal segment comes earlier, then by
+// name so that the order never depends on map iteration
+func moreSpecificRoute(a, b string) bool {
+	aParts := strings.Split(strings.Trim(a, "/"), "/")
+	bParts := strings.Split(strings.Trim(b, "/"), "/")
+	if aLiterals, bLiterals := literalSegments(aParts), literalSegments(bParts); aLiterals != bLiterals {
+		return aLiterals > bLiterals
+	}
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aParam, bParam := strings.HasPrefix(aParts[i], ":"), strings.HasPrefix(bParts[i], ":")
+		if aParam != bParam {
+			return bParam
+		}
+	}
+	return a < b
+}
+
+func literalSegments(parts []string) int {
+	literals := 0
+	for _, part := range parts {
+		if !strings.HasPrefix(part, ":") {
+			literals++
+		}
+	}
+	return literals
+}
+
+// maxRequestLimits returns the largest body and header limits across all routes,
+// used to size fiber's own buffers
+func (s *Server) maxRequestLimits() (int, int) {
+	bodyLimit := withDefaultInt(s.config.BodyLimit, defaultBodyLimit)
+	headerLimit := withDefaultInt(s.config.HeaderLimit, defaultHeaderLimit)
+	for _, limit := range s.routeLimits() {
+		bodyLimit = max(bodyLimit, limit.BodyLimit)
+		headerLimit = max(headerLimit, limit.HeaderLimit)
+	}
+	return bodyLimit, headerLimit
+}
+
+func withDefaultInt(value, fallback int) int {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// matchRoute matches a path against a route pattern with :param segments
+func matchRoute(pattern, path string) bool {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternParts) != len(pathParts) {
+		return false
+	}
+	for i, part := range patternParts {
+		if !strings.HasPrefix(part, ":") && part != pathParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// requestLimits rejects requests whose headers or declared body exceed the limit of
+// their route. The request body is streamed, so oversized bodies are refused before
+// they are read into memory.
+func (s *Server) requestLimits() fiber.Handler {
+	routes := s.routeLimits()
+	defaultBody := withDefaultInt(s.config.BodyLimit, defaultBodyLimit)
+	defaultHeader := withDefaultInt(s.config.HeaderLimit, defaultHeaderLimit)
+
+	return func(c fiber.Ctx) error {
+		bodyLimit, headerLimit := defaultBody, defaultHeader
+		for _, limit := range routes {
+			if matchRoute(limit.pattern, c.Path()) {
+				bodyLimit = withDefaultInt(limit.BodyLimit, defaultBody)
+				headerLimit = withDefaultInt(limit.HeaderLimit, defaultHeader)
+				break
+			}
+		}
+
+		header := &c.Request().Header
+		if len(header.RawHeaders()) > headerLimit {
+			return fiber.NewError(fiber.StatusRequestHeaderFieldsTooLarge, "Request headers too large")
+		}
+
+		switch length := header.ContentLength(); {
+		case length > bodyLimit:
+			return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Request body too large")
+		case length == -1:
+			// chunked bodies have no declared size to check up front
+			return fiber.NewError(fiber.StatusLengthRequired, "Content-Length is required")
+		}
+
+		return c.Next()
+	}
+}
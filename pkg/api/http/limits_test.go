@@ -0,0 +1,45 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestRequestLimitsPrefersSpecificRoute(t *testing.T) {
+	s := &Server{config: &Config{RouteLimits: map[string]RouteLimit{
+		"/api/v1/uploads/status": {BodyLimit: 16},
+		"/api/:version/test":     {BodyLimit: 32},
+	}}}
+
+	tests := []struct {
+		path string
+		size int
+		want int
+	}{
+		{path: "/api/v1/uploads/status", size: 17, want: fiber.StatusRequestEntityTooLarge},
+		{path: "/api/v1/uploads/abc", size: 1 << 20, want: fiber.StatusOK},
+		{path: "/api/v1/test", size: 1 << 20, want: fiber.StatusOK},
+		{path: "/api/v2/test", size: 33, want: fiber.StatusRequestEntityTooLarge},
+	}
+	// the limits used to come from map iteration, so a wrong order only showed up sometimes
+	for range 20 {
+		app := fiber.New(fiber.Config{BodyLimit: 2 << 20})
+		app.Use(s.requestLimits())
+		app.Post("/*", func(c fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+		for _, tt := range tests {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Fatalf("%s with %d bytes: got status %d, want %d", tt.path, tt.size, resp.StatusCode, tt.want)
+			}
+		}
+	}
+}
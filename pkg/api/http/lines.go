@@ -0,0 +1,195 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+// defaultLineTolerance is the baseline distance, as a fraction of the page height,
+// within which two words count as being on the same line
+const defaultLineTolerance = 0.008
+
+// logicalLine collects the words sharing a baseline
+type logicalLine struct {
+	page     int32
+	baseline float32
+	words    []types.Block
+}
+
+// reconstructLines replaces the LINE blocks with lines rebuilt from the WORD blocks by
+// their geometry. Some receipts are OCR'd with one logical line split over several LINE
+// blocks, which breaks sameLine and nextLine. The blocks are returned unchanged if any
+// word lacks geometry.
+func reconstructLines(blocks []types.Block, tolerance float32) []types.Block {
+	if tolerance <= 0 {
+		tolerance = defaultLineTolerance
+	}
+
+	var words []types.Block
+	for _, block := range blocks {
+		if block.BlockType != types.BlockTypeWord {
+			continue
+		}
+		if block.Geometry == nil || block.Geometry.BoundingBox == nil {
+			return blocks
+		}
+		words = append(words, block)
+	}
+	if len(words) == 0 {
+		return blocks
+	}
+
+	sort.SliceStable(words, func(i, j int) bool {
+		if pi, pj := aws.ToInt32(words[i].Page), aws.ToInt32(words[j].Page); pi != pj {
+			return pi < pj
+		}
+		return wordBaseline(words[i]) < wordBaseline(words[j])
+	})
+
+	var lines []*logicalLine
+	for _, word := range words {
+		page, baseline := aws.ToInt32(word.Page), wordBaseline(word)
+		if n := len(lines); n > 0 && lines[n-1].page == page && float32(math.Abs(float64(baseline-lines[n-1].baseline))) <= tolerance {
+			line := lines[n-1]
+			line.words = append(line.words, word)
+			// track the running mean so long lines on skewed scans stay together
+			line.baseline += (baseline - line.baseline) / float32(len(line.words))
+			continue
+		}
+		lines = append(lines, &logicalLine{page: page, baseline: baseline, words: []types.Block{word}})
+	}
+
+	merged := make([]types.Block, 0, len(lines))
+	for i, line := range lines {
+		merged = append(merged, line.block(i))
+	}
+
+	// the rebuilt lines take the place of the first original LINE so their order is kept
+	out := make([]types.Block, 0, len(blocks))
+	inserted := false
+	for _, block := range blocks {
+		if block.BlockType != types.BlockTypeLine {
+			out = append(out, block)
+			continue
+		}
+		if !inserted {
+			out = append(out, merged...)
+			inserted = true
+		}
+	}
+	if !inserted {
+		out = append(out, merged...)
+	}
+	return out
+}
+
+func wordBaseline(word types.Block) float32 {
+	box := word.Geometry.BoundingBox
+	return box.Top + box.Height
+}
+
+// block turns the line into a LINE block with the words in reading order, the lowest
+// word confidence and the bounding box around all words
+func (l *logicalLine) block(index int) types.Block {
+	sort.SliceStable(l.words, func(i, j int) bool {
+		return l.words[i].Geometry.BoundingBox.Left < l.words[j].Geometry.BoundingBox.Left
+	})
+
+	texts := make([]string, 0, len(l.words))
+	ids := make([]string, 0, len(l.words))
+	confidence := float32(100)
+	left, top := float32(1), float32(1)
+	var right, bottom float32
+	for _, word := range l.words {
+		box := word.Geometry.BoundingBox
+		texts = append(texts, blockText(word))
+		ids = append(ids, blockID(word))
+		confidence = min(confidence, blockConfidence(word))
+		left, top = min(left, box.Left), min(top, box.Top)
+		right, bottom = max(right, box.Left+box.Width), max(bottom, box.Top+box.Height)
+	}
+
+	return types.Block{
+		BlockType:  types.BlockTypeLine,
+		Id:         aws.String(fmt.Sprintf("merged-line-%d", index)),
+		Text:       aws.String(strings.Join(texts, " ")),
+		Confidence: aws.Float32(confidence),
+		Page:       l.words[0].Page,
+		Geometry: &types.Geometry{BoundingBox: &types.BoundingBox{
+			Left:   left,
+			Top:    top,
+			Width:  right - left,
+			Height: bottom - top,
+		}},
+		Relationships: []types.Relationship{{Type: types.RelationshipTypeChild, Ids: ids}},
+	}
+}
+
+// sortReadingOrder puts the blocks of each type in reading order: by page, then by row
+// top to bottom, then left to right within a row. Textract does not guarantee its block
+// order, and nextLine and the first-match strategies depend on it. Each type keeps the
+// positions it had among the other types, so a LINE still follows the blocks it followed;
+// a type is left as it is if any of its blocks lacks geometry.
+func sortReadingOrder(blocks []types.Block, tolerance float32) []types.Block {
+	if tolerance <= 0 {
+		tolerance = defaultLineTolerance
+	}
+
+	slots := make(map[types.BlockType][]int)
+	for i, block := range blocks {
+		slots[block.BlockType] = append(slots[block.BlockType], i)
+	}
+
+	out := make([]types.Block, len(blocks))
+	copy(out, blocks)
+	for _, positions := range slots {
+		ordered := make([]types.Block, len(positions))
+		for i, position := range positions {
+			ordered[i] = blocks[position]
+		}
+		if !readingOrder(ordered, tolerance) {
+			continue
+		}
+		for i, position := range positions {
+			out[position] = ordered[i]
+		}
+	}
+	return out
+}
+
+// readingOrder sorts blocks in place, reporting false if a block lacks geometry
+func readingOrder(blocks []types.Block, tolerance float32) bool {
+	for _, block := range blocks {
+		if block.Geometry == nil || block.Geometry.BoundingBox == nil {
+			return false
+		}
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if pi, pj := aws.ToInt32(blocks[i].Page), aws.ToInt32(blocks[j].Page); pi != pj {
+			return pi < pj
+		}
+		return wordBaseline(blocks[i]) < wordBaseline(blocks[j])
+	})
+
+	// rows are compared to their first block so that a slow drift does not chain the
+	// rows of a skewed scan together
+	for start := 0; start < len(blocks); {
+		end := start + 1
+		for end < len(blocks) && aws.ToInt32(blocks[end].Page) == aws.ToInt32(blocks[start].Page) &&
+			wordBaseline(blocks[end])-wordBaseline(blocks[start]) <= tolerance {
+			end++
+		}
+		row := blocks[start:end]
+		sort.SliceStable(row, func(i, j int) bool {
+			return row[i].Geometry.BoundingBox.Left < row[j].Geometry.BoundingBox.Left
+		})
+		start = end
+	}
+	return true
+}
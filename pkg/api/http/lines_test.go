@@ -0,0 +1,175 @@
+package http
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+func lineTexts(blocks []types.Block) []string {
+	var texts []string
+	for _, block := range blocks {
+		if block.BlockType == types.BlockTypeLine {
+			texts = append(texts, blockText(block))
+		}
+	}
+	return texts
+}
+
+func TestReconstructLines(t *testing.T) {
+	low := at(textBlock(types.BlockTypeWord, "w3", "TL"), 0.6, 0.104)
+	low.Confidence = aws.Float32(70)
+	blocks := []types.Block{
+		textBlock(types.BlockTypePage, "p", ""),
+		textBlock(types.BlockTypeLine, "l1", "Tutar:"),
+		textBlock(types.BlockTypeLine, "l2", "10,00 TL"),
+		at(textBlock(types.BlockTypeWord, "w2", "10,00"), 0.5, 0.1),
+		low,
+		at(textBlock(types.BlockTypeWord, "w1", "Tutar:"), 0.1, 0.102),
+		at(textBlock(types.BlockTypeWord, "w4", "Açıklama"), 0.1, 0.2),
+	}
+
+	out := reconstructLines(blocks, 0)
+	if got := strings.Join(lineTexts(out), "|"); got != "Tutar: 10,00 TL|Açıklama" {
+		t.Fatalf("got lines %s", got)
+	}
+	// the rebuilt lines take the place of the first LINE, after the PAGE
+	if out[0].BlockType != types.BlockTypePage || out[1].BlockType != types.BlockTypeLine {
+		t.Errorf("got block order %s, %s", out[0].BlockType, out[1].BlockType)
+	}
+	line := out[1]
+	if blockConfidence(line) != 70 {
+		t.Errorf("got confidence %v, want the lowest word confidence", blockConfidence(line))
+	}
+	if box := line.Geometry.BoundingBox; box.Left != 0.1 || box.Top != 0.1 || math.Abs(float64(box.Left+box.Width-0.7)) > 1e-6 {
+		t.Errorf("got bounding box %+v", box)
+	}
+	if ids := line.Relationships[0].Ids; strings.Join(ids, ",") != "w1,w2,w3" {
+		t.Errorf("got child ids %v", ids)
+	}
+
+	// a tolerance below the baseline distance keeps the words apart
+	if got := lineTexts(reconstructLines(blocks, 0.001)); len(got) != 4 {
+		t.Errorf("got lines %v with a small tolerance", got)
+	}
+}
+
+func TestReconstructLinesPages(t *testing.T) {
+	second := at(textBlock(types.BlockTypeWord, "w2", "10,00"), 0.5, 0.1)
+	second.Page = aws.Int32(2)
+	blocks := []types.Block{
+		at(textBlock(types.BlockTypeWord, "w1", "Tutar:"), 0.1, 0.1),
+		second,
+	}
+	if got := lineTexts(reconstructLines(blocks, 0)); strings.Join(got, "|") != "Tutar:|10,00" {
+		t.Errorf("got lines %v, want one per page", got)
+	}
+}
+
+func TestReconstructLinesWithoutGeometry(t *testing.T) {
+	blocks := []types.Block{
+		textBlock(types.BlockTypeLine, "l1", "Tutar:"),
+		textBlock(types.BlockTypeLine, "l2", "10,00 TL"),
+		at(textBlock(types.BlockTypeWord, "w1", "Tutar:"), 0.1, 0.1),
+		textBlock(types.BlockTypeWord, "w2", "10,00"),
+	}
+	if got := lineTexts(reconstructLines(blocks, 0)); strings.Join(got, "|") != "Tutar:|10,00 TL" {
+		t.Errorf("got lines %v, want the original lines", got)
+	}
+}
+
+func TestParseReconstructLines(t *testing.T) {
+	blocks := []types.Block{
+		at(textBlock(types.BlockTypeLine, "l1", "Tutar:"), 0.1, 0.1),
+		at(textBlock(types.BlockTypeLine, "l2", "10,00 TL"), 0.5, 0.1),
+		at(textBlock(types.BlockTypeWord, "w1", "Tutar:"), 0.1, 0.1),
+		at(textBlock(types.BlockTypeWord, "w2", "10,00"), 0.5, 0.1),
+		at(textBlock(types.BlockTypeWord, "w3", "TL"), 0.6, 0.1),
+	}
+	strategy := FieldStrategy{Key: "Tutar", Strategy: StrategySameLine}
+	for _, reconstruct := range []bool{false, true} {
+		schema := DocumentSchema{Type: "test", Fields: map[string]FieldStrategy{"alan": strategy}, ReconstructLines: reconstruct}
+		info, err := NewReceiptParser(blocks, schema, ParseOptions{Mode: ParseModeStrict}).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[bool]string{false: "", true: "10,00 TL"}[reconstruct]; info["alan"] != want {
+			t.Errorf("reconstructLines %v: got %q, want %q", reconstruct, info["alan"], want)
+		}
+	}
+}
+
+func blockIDs(blocks []types.Block) string {
+	ids := make([]string, len(blocks))
+	for i, block := range blocks {
+		ids[i] = blockID(block)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestSortReadingOrder(t *testing.T) {
+	secondPage := at(textBlock(types.BlockTypeLine, "p2", "Sayfa 2"), 0.1, 0.05)
+	secondPage.Page = aws.Int32(2)
+
+	tests := []struct {
+		name   string
+		blocks []types.Block
+		want   string
+	}{
+		{"rows then left to right", []types.Block{
+			at(textBlock(types.BlockTypeLine, "c", "c"), 0.1, 0.3),
+			at(textBlock(types.BlockTypeLine, "b", "b"), 0.5, 0.1),
+			at(textBlock(types.BlockTypeLine, "a", "a"), 0.1, 0.105),
+		}, "a,b,c"},
+		{"pages first", []types.Block{
+			secondPage,
+			at(textBlock(types.BlockTypeLine, "p1", "Sayfa 1"), 0.1, 0.9),
+		}, "p1,p2"},
+		{"types keep their slots", []types.Block{
+			textBlock(types.BlockTypePage, "page", ""),
+			at(textBlock(types.BlockTypeLine, "l2", "l2"), 0.1, 0.5),
+			at(textBlock(types.BlockTypeWord, "w2", "w2"), 0.1, 0.5),
+			at(textBlock(types.BlockTypeLine, "l1", "l1"), 0.1, 0.1),
+			at(textBlock(types.BlockTypeWord, "w1", "w1"), 0.1, 0.1),
+		}, "page,l1,w1,l2,w2"},
+		{"type without geometry is kept", []types.Block{
+			at(textBlock(types.BlockTypeLine, "l2", "l2"), 0.1, 0.5),
+			textBlock(types.BlockTypeLine, "l1", "l1"),
+			at(textBlock(types.BlockTypeWord, "w2", "w2"), 0.1, 0.5),
+			at(textBlock(types.BlockTypeWord, "w1", "w1"), 0.1, 0.1),
+		}, "l2,l1,w1,w2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockIDs(sortReadingOrder(tt.blocks, 0)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortReadingOrderSkewedRows(t *testing.T) {
+	// a slow drift of the baseline must not chain all rows of a skewed scan together
+	var blocks []types.Block
+	for i, id := range []string{"a", "b", "c", "d"} {
+		blocks = append(blocks, at(textBlock(types.BlockTypeLine, id, id), 0.8-float32(i)*0.2, 0.1+float32(i)*0.006))
+	}
+	if got := blockIDs(sortReadingOrder(blocks, 0)); got != "b,a,d,c" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestParseNextLineReadingOrder(t *testing.T) {
+	blocks := []types.Block{
+		at(textBlock(types.BlockTypeLine, "l3", "Açıklama"), 0.1, 0.3),
+		at(textBlock(types.BlockTypeLine, "l2", "10,00 TL"), 0.1, 0.2),
+		at(textBlock(types.BlockTypeLine, "l1", "Tutar"), 0.1, 0.1),
+	}
+	value, _ := parseField(t, blocks, FieldStrategy{Key: "Tutar", Strategy: StrategyNextLine}, ParseOptions{Mode: ParseModeStrict})
+	if value != "10,00 TL" {
+		t.Errorf("got %q", value)
+	}
+}
@@ -1,8 +1,12 @@
 package http
 
 import (
-	"go.uber.org/zap"
 	"net/http"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+	"github.com/mehmetsafabenli/cbomdekont/pkg/logging"
+	"go.uber.org/zap"
 )
 
 type LoggingMiddleware struct {
@@ -28,3 +32,39 @@ func (m *LoggingMiddleware) Handler(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requestLogging adds the request attributes to the user context of the request; handlers
+// log through requestLogger and services through logging.FromContext instead of adding
+// them by hand
+func (s *Server) requestLogging(c fiber.Ctx) error {
+	s.addLogFields(c,
+		zap.String("requestId", requestid.FromContext(c)),
+		zap.String("method", c.Method()),
+		zap.String("path", c.Path()),
+	)
+	return c.Next()
+}
+
+// addLogFields adds fields to every log of the rest of the request
+func (s *Server) addLogFields(c fiber.Ctx, fields ...zap.Field) {
+	c.SetUserContext(logging.WithFields(c.UserContext(), fields...))
+}
+
+// setDocType records the document type of the request for logs and error reports
+func (s *Server) setDocType(c fiber.Ctx, docType string) {
+	c.Locals("docType", docType)
+	s.addLogFields(c, zap.String("docType", docType))
+}
+
+// requestLogger returns the server logger with the request attributes. The route and
+// upload id are only known once the request reached its handler, so they are added here.
+func (s *Server) requestLogger(c fiber.Ctx) *zap.Logger {
+	logger := logging.FromContext(c.UserContext(), s.logger)
+	if route := c.Route(); route != nil && route.Path != "/" {
+		logger = logger.With(zap.String("route", route.Path))
+	}
+	if id := c.Params("id"); id != "" {
+		logger = logger.With(zap.String("uploadId", id))
+	}
+	return logger
+}
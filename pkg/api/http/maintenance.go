@@ -0,0 +1,113 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+)
+
+// ErrCodeMaintenance is returned for new analyses during a maintenance window
+const ErrCodeMaintenance = "MAINTENANCE"
+
+// MaintenanceConfig lists planned maintenance windows (AWS, database) during which new
+// analyses are rejected with Retry-After. Uploads and retrieval keep working.
+type MaintenanceConfig struct {
+	Windows []MaintenanceWindow `mapstructure:"windows"`
+	// Unready also fails the readiness probe while a window is active
+	Unready bool `mapstructure:"unready"`
+}
+
+// MaintenanceWindow is a single window, Start and End are RFC 3339 timestamps
+type MaintenanceWindow struct {
+	Start  string `mapstructure:"start"`
+	End    string `mapstructure:"end"`
+	Reason string `mapstructure:"reason"`
+}
+
+type maintenanceWindow struct {
+	start  time.Time
+	end    time.Time
+	reason string
+}
+
+func parseMaintenanceWindows(windows []MaintenanceWindow) ([]maintenanceWindow, error) {
+	parsed := make([]maintenanceWindow, 0, len(windows))
+	for i, w := range windows {
+		start, err := time.Parse(time.RFC3339, w.Start)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %d: invalid start: %w", i, err)
+		}
+		end, err := time.Parse(time.RFC3339, w.End)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %d: invalid end: %w", i, err)
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("maintenance window %d: end must be after start", i)
+		}
+		parsed = append(parsed, maintenanceWindow{start: start, end: end, reason: w.Reason})
+	}
+	return parsed, nil
+}
+
+// activeMaintenance returns the window covering now, if any
+func (s *Server) activeMaintenance(now time.Time) *maintenanceWindow {
+	for i := range s.maintenance {
+		if w := &s.maintenance[i]; !now.Before(w.start) && now.Before(w.end) {
+			return w
+		}
+	}
+	return nil
+}
+
+// maintenanceGate rejects new analyses with 503 and a Retry-After pointing at the end of
+// the active maintenance window
+func (s *Server) maintenanceGate(c fiber.Ctx) error {
+	now := time.Now()
+	w := s.activeMaintenance(now)
+	if w == nil {
+		return c.Next()
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(w.end.Sub(now).Seconds())+1))
+	message := "Service is under maintenance"
+	if w.reason != "" {
+		message += ": " + w.reason
+	}
+	return c.Status(fiber.StatusServiceUnavailable).JSON(BaseResponse{
+		Success: false,
+		Message: message,
+		Code:    ErrCodeMaintenance,
+	})
+}
+
+// startMaintenanceWatcher fails the readiness probe while a maintenance window is active
+// and restores it afterwards, if maintenance.unready is set
+func (s *Server) startMaintenanceWatcher() {
+	if !s.config.Maintenance.Unready || len(s.maintenance) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		inWindow := false
+		for ; true; <-ticker.C {
+			w := s.activeMaintenance(time.Now())
+			switch {
+			case w != nil && !inWindow:
+				s.logger.Warn("Maintenance window started, marking not ready",
+					zap.Time("end", w.end), zap.String("reason", w.reason))
+				atomic.StoreInt32(&ready, 0)
+			case w == nil && inWindow:
+				s.logger.Info("Maintenance window ended")
+				if !s.config.Unready {
+					atomic.StoreInt32(&ready, 1)
+				}
+			}
+			inWindow = w != nil
+		}
+	}()
+}
@@ -10,15 +10,16 @@ import (
 type PrometheusMiddleware struct {
 	Histogram *prometheus.HistogramVec
 	Counter   *prometheus.CounterVec
+	// InFlight shows the progress of the connection draining on shutdown
+	InFlight prometheus.Gauge
 }
 
-func NewPrometheusMiddleware() *PrometheusMiddleware {
-	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+func NewPrometheusMiddleware(histogramOpts func(prometheus.HistogramOpts) prometheus.HistogramOpts) *PrometheusMiddleware {
+	histogram := prometheus.NewHistogramVec(histogramOpts(prometheus.HistogramOpts{
 		Subsystem: "http",
 		Name:      "request_duration_seconds",
 		Help:      "The HTTP request latencies in seconds.",
-		Buckets:   prometheus.DefBuckets,
-	}, []string{"method", "path", "status"})
+	}), []string{"method", "path", "status"})
 
 	counter := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -27,13 +28,21 @@ func NewPrometheusMiddleware() *PrometheusMiddleware {
 			Help:      "The total number of HTTP requests.",
 		}, []string{"status"})
 
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "The number of HTTP requests being served.",
+	})
+
 	//must register
 	prometheus.MustRegister(histogram)
 	prometheus.MustRegister(counter)
+	prometheus.MustRegister(inFlight)
 
 	return &PrometheusMiddleware{
 		Histogram: histogram,
 		Counter:   counter,
+		InFlight:  inFlight,
 	}
 }
 
@@ -46,12 +55,15 @@ func NewPrometheusMiddleware() *PrometheusMiddleware {
 // @Success 200 {string} string "OK"
 func (p *PrometheusMiddleware) Handler(c fiber.Ctx) error {
 	begin := time.Now()
+	p.InFlight.Inc()
+	defer p.InFlight.Dec()
 	err := c.Next()
 
 	duration := time.Since(begin)
 	status := strconv.Itoa(c.Response().StatusCode())
 	method := c.Method()
-	path := c.Path()
+	// the route pattern, e.g. /api/v1/uploads/:id, keeps upload ids out of the labels
+	path := c.Route().Path
 
 	p.Histogram.WithLabelValues(method, path, status).Observe(duration.Seconds())
 	p.Counter.WithLabelValues(status).Inc()
@@ -0,0 +1,195 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// maxPendingNotifications bounds the deliveries in flight; a slow receiver must not pile
+// up goroutines
+const maxPendingNotifications = 32
+
+var notificationsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "notifications",
+	Name:      "total",
+	Help:      "The number of notifications by rule and result: sent, failed or dropped.",
+}, []string{"rule", "result"})
+
+func init() {
+	prometheus.MustRegister(notificationsCounter)
+}
+
+// NotificationRule posts the result of every newly analyzed document matching Filter to
+// URL; cached results are not notified again
+type NotificationRule struct {
+	Name string `mapstructure:"name"`
+	// DocTypes limits the rule to these docTypes, empty matches every docType
+	DocTypes []string `mapstructure:"doc-types"`
+	// Filter is an expression over the extracted fields like the schema assertions, which
+	// can also read docType, e.g. "tutar > 10000 && docType == 'halkbank'"; empty matches
+	// every document
+	Filter string `mapstructure:"filter"`
+	URL    string `mapstructure:"url"`
+}
+
+// Notification is the body posted to the URL of a matching rule
+type Notification struct {
+	Rule          string        `json:"rule"`
+	DocType       string        `json:"docType"`
+	RequestID     string        `json:"requestId"`
+	ProcessedAt   time.Time     `json:"processedAt"`
+	ExtractedInfo ExtractedInfo `json:"extractedInfo"`
+}
+
+type notificationRule struct {
+	NotificationRule
+	filter expr
+}
+
+// notifier evaluates the notification rules after an extraction and delivers the
+// notifications in the background
+type notifier struct {
+	rules   []notificationRule
+	client  *http.Client
+	pending chan struct{}
+	logger  *zap.Logger
+}
+
+func newNotifier(rules []NotificationRule, transport http.RoundTripper, logger *zap.Logger) (*notifier, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	n := &notifier{
+		client:  &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		pending: make(chan struct{}, maxPendingNotifications),
+		logger:  logger,
+	}
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		switch {
+		case rule.Name == "":
+			return nil, fmt.Errorf("notifications[%d]: name is required", i)
+		case names[rule.Name]:
+			return nil, fmt.Errorf("notifications.%s: duplicate rule name", rule.Name)
+		case rule.URL == "":
+			return nil, fmt.Errorf("notifications.%s: url is required", rule.Name)
+		}
+		names[rule.Name] = true
+		compiled := notificationRule{NotificationRule: rule}
+		if rule.Filter != "" {
+			filter, err := parseExpr(rule.Filter)
+			if err != nil {
+				return nil, fmt.Errorf("notifications.%s: invalid filter: %w", rule.Name, err)
+			}
+			compiled.filter = filter
+		}
+		n.rules = append(n.rules, compiled)
+	}
+	return n, nil
+}
+
+// notificationEnv is the parser env with docType readable as a field
+type notificationEnv struct {
+	*parserEnv
+	docType string
+}
+
+func (e *notificationEnv) field(name string) (string, bool) {
+	if value, ok := e.parserEnv.field(name); ok {
+		return value, ok
+	}
+	if name == "docType" {
+		return e.docType, true
+	}
+	return "", false
+}
+
+// notify sends the extraction to the rules it matches. A filter over a field that was
+// not extracted does not match.
+func (s *Server) notify(c fiber.Ctx, docType string, extractedInfo ExtractedInfo, parser *ReceiptParser) {
+	if s.notifier == nil {
+		return
+	}
+	env := &notificationEnv{parserEnv: &parserEnv{parser: parser, extractedInfo: extractedInfo}, docType: docType}
+	for _, rule := range s.notifier.rules {
+		if len(rule.DocTypes) > 0 && !slices.Contains(rule.DocTypes, docType) {
+			continue
+		}
+		if rule.filter != nil {
+			value, err := rule.filter.eval(env)
+			if errors.Is(err, errMissingField) {
+				continue
+			}
+			var matched bool
+			if err == nil {
+				matched, err = value.boolean()
+			}
+			if err != nil {
+				s.requestLogger(c).Warn("Notification filter failed", zap.String("rule", rule.Name), zap.Error(err))
+				continue
+			}
+			if !matched {
+				continue
+			}
+		}
+		s.notifier.send(rule.NotificationRule, Notification{
+			Rule:          rule.Name,
+			DocType:       docType,
+			RequestID:     requestid.FromContext(c),
+			ProcessedAt:   time.Now().UTC(),
+			ExtractedInfo: extractedInfo,
+		})
+	}
+}
+
+func (n *notifier) send(rule NotificationRule, notification Notification) {
+	select {
+	case n.pending <- struct{}{}:
+	default:
+		notificationsCounter.WithLabelValues(rule.Name, "dropped").Inc()
+		n.logger.Warn("Too many pending notifications, dropped one", zap.String("rule", rule.Name))
+		return
+	}
+	go func() {
+		defer func() { <-n.pending }()
+		if err := n.post(rule.URL, notification); err != nil {
+			notificationsCounter.WithLabelValues(rule.Name, "failed").Inc()
+			n.logger.Warn("Failed to send notification", zap.String("rule", rule.Name),
+				zap.String("requestId", notification.RequestID), zap.Error(err))
+			return
+		}
+		notificationsCounter.WithLabelValues(rule.Name, "sent").Inc()
+	}()
+}
+
+func (n *notifier) post(url string, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package http
+
+import (
+	_ "embed"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// openAPISpec describes the public API; the clients under clients/ are generated from it
+// with make clients, so change it together with the handlers
+//
+//go:generate make -C ../../.. clients
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// OpenAPI godoc
+// @Summary OpenAPI specification
+// @Description returns the OpenAPI 3 description of the API
+// @Tags HTTP API
+// @Produce application/yaml
+// @Router /api/v1/openapi.yaml [get]
+// @Success 200 {string} string "OK"
+func (s *Server) openAPIHandler(c fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "application/yaml")
+	return c.Send(openAPISpec)
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+const (
+	// PageFirst and PageLast scope a field to the first or last page of the document; a
+	// page number scopes it to that page
+	PageFirst = "first"
+	PageLast  = "last"
+)
+
+// validatePage checks the page of a field strategy
+func validatePage(page string) error {
+	if page == "" || page == PageFirst || page == PageLast {
+		return nil
+	}
+	if n, err := strconv.Atoi(page); err != nil || n < 1 {
+		return fmt.Errorf("page must be first, last or a page number, got %q", page)
+	}
+	return nil
+}
+
+// scopeToPage narrows the blocks the strategies see to one page, so a statement's
+// summary page does not answer for the field on the first page. The returned function
+// restores all blocks. A page the document does not have leaves no blocks.
+func (p *ReceiptParser) scopeToPage(page string) func() {
+	if page == "" {
+		return func() {}
+	}
+
+	var target int32
+	switch page {
+	case PageFirst, PageLast:
+		for _, block := range p.blocks {
+			n := blockPage(block)
+			if target == 0 || (page == PageFirst && n < target) || (page == PageLast && n > target) {
+				target = n
+			}
+		}
+	default:
+		n, _ := strconv.Atoi(page)
+		target = int32(n)
+	}
+
+	scoped := make([]types.Block, 0, len(p.blocks))
+	for _, block := range p.blocks {
+		if blockPage(block) == target {
+			scoped = append(scoped, block)
+		}
+	}
+	p.tracef("Searching page %d only, %d blocks", target, len(scoped))
+
+	// the block index and table grid are built lazily over the blocks they first see
+	blocks, index, tables := p.blocks, p.index, p.tables
+	p.blocks, p.index, p.tables = scoped, nil, nil
+	return func() {
+		p.blocks, p.index, p.tables = blocks, index, tables
+	}
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+func TestValidatePage(t *testing.T) {
+	for page, valid := range map[string]bool{
+		"": true, PageFirst: true, PageLast: true, "1": true, "12": true,
+		"0": false, "-1": false, "ilk": false, "1.5": false,
+	} {
+		if err := validatePage(page); (err == nil) != valid {
+			t.Errorf("validatePage(%q) = %v", page, err)
+		}
+	}
+}
+
+func TestParsePageScope(t *testing.T) {
+	// a statement repeating the key on every page; single page output leaves Page unset
+	var blocks []types.Block
+	for i, value := range []string{"1", "2", "3"} {
+		line := textBlock(types.BlockTypeLine, "l"+value, "Bakiye: "+value)
+		if i > 0 {
+			line.Page = aws.Int32(int32(i + 1))
+		}
+		blocks = append(blocks, line)
+	}
+
+	schema := DocumentSchema{Type: "test", Fields: map[string]FieldStrategy{}}
+	want := map[string]string{"": "1", PageFirst: "1", PageLast: "3", "2": "2", "5": ""}
+	for page := range want {
+		schema.Fields["bakiye"+page] = FieldStrategy{Key: "Bakiye", Strategy: StrategySameLine, Page: page}
+	}
+	parser := NewReceiptParser(blocks, schema, ParseOptions{Mode: ParseModeStrict})
+	info, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for page, value := range want {
+		if info["bakiye"+page] != value {
+			t.Errorf("page %q: got %q, want %q", page, info["bakiye"+page], value)
+		}
+	}
+	if provenance := parser.Provenance()["bakiye"+PageLast]; provenance.Page != 3 || provenance.BlockID != "l3" {
+		t.Errorf("provenance %+v", provenance)
+	}
+}
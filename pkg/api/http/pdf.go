@@ -0,0 +1,90 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	PDFPassword = "pdfPassword"
+
+	ErrCodePDFPasswordRequired = "PDF_PASSWORD_REQUIRED"
+	ErrCodePDFPasswordInvalid  = "PDF_PASSWORD_INVALID"
+	ErrCodePDFUnreadable       = "PDF_UNREADABLE"
+)
+
+var (
+	errPDFPasswordRequired = errors.New("pdf is password protected")
+	errPDFPasswordInvalid  = errors.New("pdf password is invalid")
+	errPDFUnreadable       = errors.New("pdf is corrupt or unreadable")
+)
+
+// qpdf exit codes, see qpdf --help=exit-status
+const (
+	qpdfExitError   = 2
+	qpdfExitWarning = 3
+)
+
+const defaultQpdfPath = "qpdf"
+
+func isPDF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF-"))
+}
+
+// isEncryptedPDF reports whether the trailer references an encryption dictionary
+func isEncryptedPDF(data []byte) bool {
+	return isPDF(data) && bytes.Contains(data, []byte("/Encrypt"))
+}
+
+// decryptPDF tries the empty password and then each password in order with qpdf and
+// returns the decrypted document. PDFs with only an owner password open with the empty
+// one, the others need a password from the request or the config.
+func decryptPDF(ctx context.Context, qpdfPath string, data []byte, passwords []string) ([]byte, error) {
+	if qpdfPath == "" {
+		qpdfPath = defaultQpdfPath
+	}
+
+	dir, err := os.MkdirTemp("", "cbomdekont-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := dir + "/in.pdf"
+	out := dir + "/out.pdf"
+	if err := os.WriteFile(in, data, 0600); err != nil {
+		return nil, err
+	}
+
+	for _, password := range append([]string{""}, passwords...) {
+		// the password is passed on stdin so it never shows up in the process list
+		cmd := exec.CommandContext(ctx, qpdfPath, "--password-file=-", "--decrypt", in, out)
+		cmd.Stdin = strings.NewReader(password)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil, errors.As(err, &exitErr) && exitErr.ExitCode() == qpdfExitWarning:
+			return os.ReadFile(out)
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == qpdfExitError && strings.Contains(stderr.String(), "invalid password"):
+			continue
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == qpdfExitError:
+			// qpdf also exits with 2 for damaged files and unsupported encryption
+			return nil, fmt.Errorf("%w: %s", errPDFUnreadable, strings.TrimSpace(stderr.String()))
+		default:
+			return nil, fmt.Errorf("qpdf failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	if len(passwords) == 0 {
+		return nil, errPDFPasswordRequired
+	}
+	return nil, errPDFPasswordInvalid
+}
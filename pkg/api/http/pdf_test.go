@@ -0,0 +1,66 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeQpdf stands in for qpdf --password-file=- --decrypt in out. MODE picks the document:
+// owner has no user password, damaged can't be parsed, the default opens with "gizli".
+const fakeQpdf = `#!/bin/sh
+password=$(cat)
+case "$MODE" in
+owner) cp "$3" "$4" ;;
+damaged) echo "qpdf: $3: unable to find trailer dictionary while recovering damaged file" >&2; exit 2 ;;
+*)
+	if [ "$password" != "gizli" ]; then
+		echo "qpdf: $3: invalid password" >&2
+		exit 2
+	fi
+	cp "$3" "$4"
+	;;
+esac
+`
+
+// writeFakeQpdf writes fakeQpdf to a temporary directory and returns its path
+func writeFakeQpdf(t *testing.T) string {
+	t.Helper()
+	qpdf := filepath.Join(t.TempDir(), "qpdf")
+	if err := os.WriteFile(qpdf, []byte(fakeQpdf), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return qpdf
+}
+
+func TestDecryptPDF(t *testing.T) {
+	qpdf := writeFakeQpdf(t)
+	document := []byte("%PDF-1.7 /Encrypt")
+
+	tests := []struct {
+		name      string
+		mode      string
+		passwords []string
+		want      error
+	}{
+		{name: "owner password only", mode: "owner"},
+		{name: "user password", passwords: []string{"yanlis", "gizli"}},
+		{name: "no password", want: errPDFPasswordRequired},
+		{name: "wrong password", passwords: []string{"yanlis"}, want: errPDFPasswordInvalid},
+		{name: "damaged", mode: "damaged", passwords: []string{"gizli"}, want: errPDFUnreadable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MODE", tt.mode)
+			got, err := decryptPDF(context.Background(), qpdf, document, tt.passwords)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && string(got) != string(document) {
+				t.Errorf("got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	PIIIBAN  = "iban"
+	PIITCKN  = "tckn"
+	PIIPhone = "phone"
+	PIIEmail = "email"
+
+	// PIIMask and PIIKeep are the values of the pii setting of a schema field
+	PIIMask = "mask"
+	PIIKeep = "keep"
+)
+
+// PIIConfig controls the masking of personal data in extracted values before they are
+// returned or cached
+type PIIConfig struct {
+	// Mask masks the detected values of every field; schema fields override it with
+	// "pii": "mask" or "keep"
+	Mask bool `mapstructure:"mask"`
+	// Detectors limits detection to these kinds (iban, tckn, phone, email), all when empty
+	Detectors []string `mapstructure:"detectors"`
+}
+
+type piiDetector struct {
+	kind    string
+	pattern *regexp.Regexp
+	// valid filters out matches that only look like the kind, nil accepts every match
+	valid func(match string) bool
+}
+
+var piiDetectors = []piiDetector{
+	{kind: PIIIBAN, pattern: regexp.MustCompile(`(?i)\bTR\s?\d{2}(?:\s?[0-9]){22}\b`)},
+	{kind: PIITCKN, pattern: regexp.MustCompile(`\b[1-9]\d{10}\b`), valid: validTCKN},
+	{kind: PIIPhone, pattern: regexp.MustCompile(`(?:\+90\s?|\b0\s?|\b)5\d{2}\s?\d{3}\s?\d{2}\s?\d{2}\b`)},
+	{kind: PIIEmail, pattern: regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.-]+`)},
+}
+
+// validTCKN checks the two check digits of a Turkish national id
+func validTCKN(id string) bool {
+	d := make([]int, len(id))
+	for i, r := range id {
+		d[i] = int(r - '0')
+	}
+	odd := d[0] + d[2] + d[4] + d[6] + d[8]
+	even := d[1] + d[3] + d[5] + d[7]
+	if ((odd*7-even)%10+10)%10 != d[9] {
+		return false
+	}
+	sum := 0
+	for _, digit := range d[:10] {
+		sum += digit
+	}
+	return sum%10 == d[10]
+}
+
+// enabledDetectors returns the detectors of the configured kinds
+func (cfg PIIConfig) enabledDetectors() []piiDetector {
+	if len(cfg.Detectors) == 0 {
+		return piiDetectors
+	}
+	var detectors []piiDetector
+	for _, detector := range piiDetectors {
+		for _, kind := range cfg.Detectors {
+			if strings.EqualFold(kind, detector.kind) {
+				detectors = append(detectors, detector)
+			}
+		}
+	}
+	return detectors
+}
+
+// detectPII returns the kinds of personal data found in text and text with every
+// occurrence masked
+func detectPII(text string, detectors []piiDetector) ([]string, string) {
+	var kinds []string
+	for _, detector := range detectors {
+		found := false
+		text = detector.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if detector.valid != nil && !detector.valid(match) {
+				return match
+			}
+			found = true
+			return maskValue(detector.kind, match)
+		})
+		if found {
+			kinds = append(kinds, detector.kind)
+		}
+	}
+	return kinds, text
+}
+
+// maskValue hides match but the last four digits, or for e-mail addresses all but the
+// first letter and the domain, so users can still tell which of their values it was
+func maskValue(kind, match string) string {
+	if kind == PIIEmail {
+		at := strings.LastIndex(match, "@")
+		return match[:1] + strings.Repeat("*", at-1) + match[at:]
+	}
+	keep := 4
+	runes := []rune(match)
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] < '0' || runes[i] > '9' {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// maskPII masks the personal data in extractedInfo according to the pii config and the
+// pii setting of each schema field, and records the detected kinds in the provenance
+func (s *Server) maskPII(extractedInfo ExtractedInfo, parser *ReceiptParser) {
+	detectors := s.config.PII.enabledDetectors()
+	provenance := parser.Provenance()
+	for field, value := range extractedInfo {
+		kinds, masked := detectPII(value, detectors)
+		if len(kinds) == 0 {
+			continue
+		}
+		sort.Strings(kinds)
+		if p, ok := provenance[field]; ok {
+			p.PII = kinds
+			provenance[field] = p
+		}
+
+		mask := s.config.PII.Mask
+		switch parser.schema.Fields[field].PII {
+		case PIIMask:
+			mask = true
+		case PIIKeep:
+			mask = false
+		}
+		if mask {
+			extractedInfo[field] = masked
+		}
+	}
+}
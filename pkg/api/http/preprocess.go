@@ -0,0 +1,124 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+const (
+	defaultImageMaxDimension = 4000
+	defaultJPEGQuality       = 90
+	defaultHeifConvertPath   = "heif-convert"
+)
+
+// heifBrands are the ISO BMFF major brands used by HEIC/HEIF images
+var heifBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+func isHEIF(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	brand := string(data[8:12])
+	for _, b := range heifBrands {
+		if brand == b {
+			return true
+		}
+	}
+	return false
+}
+
+// preprocessDocument converts image formats Textract rejects into a bounded JPEG.
+// Formats Textract accepts natively are returned unchanged.
+func (s *Server) preprocessDocument(ctx context.Context, data []byte) ([]byte, error) {
+	switch {
+	case isWebP(data):
+		img, err := webp.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode webp image: %w", err)
+		}
+		return s.encodeJPEG(img)
+	case isHEIF(data):
+		jpg, err := s.convertHEIF(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		img, err := jpeg.Decode(bytes.NewReader(jpg))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode converted heif image: %w", err)
+		}
+		return s.encodeJPEG(img)
+	default:
+		return data, nil
+	}
+}
+
+// convertHEIF shells out to libheif since there is no pure Go HEVC decoder
+func (s *Server) convertHEIF(ctx context.Context, data []byte) ([]byte, error) {
+	convertPath := s.config.HeifConvertPath
+	if convertPath == "" {
+		convertPath = defaultHeifConvertPath
+	}
+
+	dir, err := os.MkdirTemp("", "cbomdekont-heif-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := dir + "/in.heic"
+	out := dir + "/out.jpg"
+	if err := os.WriteFile(in, data, 0600); err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, convertPath, "-q", fmt.Sprint(defaultJPEGQuality), in, out)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("heif-convert failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return os.ReadFile(out)
+}
+
+// encodeJPEG downscales the image to the configured maximum dimension and encodes it as JPEG
+func (s *Server) encodeJPEG(img image.Image) ([]byte, error) {
+	maxDim := s.config.ImageMaxDimension
+	if maxDim <= 0 {
+		maxDim = defaultImageMaxDimension
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxDim || height > maxDim {
+		if width >= height {
+			height = height * maxDim / width
+			width = maxDim
+		} else {
+			width = width * maxDim / height
+			height = maxDim
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+		img = dst
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: defaultJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,156 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// HeaderPriority selects the concurrency pool and Textract rate budget of a request
+	HeaderPriority = "X-Priority"
+
+	PriorityInteractive = "interactive"
+	PriorityBulk        = "bulk"
+)
+
+// PriorityPool bounds the Textract work of one priority class
+type PriorityPool struct {
+	// Concurrency is the number of analyses running at once, 0 is unlimited
+	Concurrency int `mapstructure:"concurrency"`
+	// Rate is the number of Textract calls per second, 0 is unlimited
+	Rate float64 `mapstructure:"rate"`
+	// Burst is the number of calls allowed at once after an idle period, default 1
+	Burst int `mapstructure:"burst"`
+}
+
+// dashboard traffic is unlimited by default, bulk imports get a small share
+var defaultPriorityPools = map[string]PriorityPool{
+	PriorityInteractive: {},
+	PriorityBulk:        {Concurrency: 2, Rate: 1},
+}
+
+var priorityWaitingGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Subsystem: "priority",
+	Name:      "waiting_requests",
+	Help:      "The number of requests waiting for a Textract slot per priority.",
+}, []string{"priority"})
+
+func init() {
+	prometheus.MustRegister(priorityWaitingGauge)
+}
+
+type priorityPool struct {
+	name     string
+	slots    chan struct{}
+	interval time.Duration
+	burst    int
+	waiting  atomic.Int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newPriorityPools applies the configured pools over the defaults
+func newPriorityPools(configured map[string]PriorityPool) (map[string]*priorityPool, error) {
+	configs := make(map[string]PriorityPool, len(defaultPriorityPools))
+	for name, cfg := range defaultPriorityPools {
+		configs[name] = cfg
+	}
+	for name, cfg := range configured {
+		name = strings.ToLower(name)
+		if _, ok := defaultPriorityPools[name]; !ok {
+			return nil, fmt.Errorf("unknown priority %q, must be %s or %s", name, PriorityInteractive, PriorityBulk)
+		}
+		configs[name] = cfg
+	}
+
+	pools := make(map[string]*priorityPool, len(configs))
+	for name, cfg := range configs {
+		pool := &priorityPool{name: name, burst: max(cfg.Burst, 1)}
+		if cfg.Concurrency > 0 {
+			pool.slots = make(chan struct{}, cfg.Concurrency)
+		}
+		if cfg.Rate > 0 {
+			pool.interval = time.Duration(float64(time.Second) / cfg.Rate)
+		}
+		pools[name] = pool
+	}
+	return pools, nil
+}
+
+// requestPriority returns the pool selected by the X-Priority header, interactive if unset
+func (s *Server) requestPriority(c fiber.Ctx) (*priorityPool, error) {
+	priority := strings.ToLower(strings.TrimSpace(c.Get(HeaderPriority)))
+	if priority == "" {
+		priority = PriorityInteractive
+	}
+	pool, ok := s.priorities[priority]
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "X-Priority must be interactive or bulk")
+	}
+	return pool, nil
+}
+
+// acquire waits for a free slot and the rate budget of the pool; call release once the
+// Textract call finished
+func (p *priorityPool) acquire(ctx context.Context) (func(), error) {
+	p.waiting.Add(1)
+	priorityWaitingGauge.WithLabelValues(p.name).Inc()
+	defer func() {
+		p.waiting.Add(-1)
+		priorityWaitingGauge.WithLabelValues(p.name).Dec()
+	}()
+
+	release := func() {}
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		release = func() { <-p.slots }
+	}
+
+	if err := p.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// wait reserves the next call of the rate budget and sleeps until it is due
+func (p *priorityPool) wait(ctx context.Context) error {
+	if p.interval == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	// an idle pool may spend up to burst calls at once
+	if earliest := now.Add(-time.Duration(p.burst-1) * p.interval); p.next.Before(earliest) {
+		p.next = earliest
+	}
+	at := p.next
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+)
+
+// ErrCodeReadOnly is returned by the analyze and upload routes while the service is read-only
+const ErrCodeReadOnly = "READ_ONLY"
+
+// writable rejects requests that start analyses or change uploads while read-only mode is
+// on, used during storage migrations and incident response. Retrieval routes don't use it.
+func (s *Server) writable(c fiber.Ctx) error {
+	if !s.readOnly.Load() {
+		return c.Next()
+	}
+	return c.Status(fiber.StatusServiceUnavailable).JSON(BaseResponse{
+		Success: false,
+		Message: "Service is in read-only mode",
+		Code:    ErrCodeReadOnly,
+	})
+}
+
+// ReadOnly godoc
+// @Summary Show read-only mode
+// @Tags Admin
+// @Produce json
+// @Router /api/v1/admin/read-only [get]
+// @Success 200 {object} BaseResponse
+func (s *Server) readOnlyHandler(c fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(BaseResponse{
+		Success: true,
+		Message: "Read-only mode",
+		Data:    fiber.Map{"readOnly": s.readOnly.Load()},
+	})
+}
+
+// SetReadOnly godoc
+// @Summary Toggle read-only mode
+// @Description while enabled analyze and upload routes return 503, retrieval routes keep working
+// @Tags Admin
+// @Produce json
+// @Param enabled query bool true "turn read-only mode on or off"
+// @Router /api/v1/admin/read-only [put]
+// @Success 200 {object} BaseResponse
+func (s *Server) setReadOnlyHandler(c fiber.Ctx) error {
+	enabled, err := strconv.ParseBool(c.Query("enabled"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "enabled must be true or false")
+	}
+	s.readOnly.Store(enabled)
+	s.requestLogger(c).Warn("Read-only mode changed", zap.Bool("readOnly", enabled))
+
+	return s.readOnlyHandler(c)
+}
@@ -1,181 +1,607 @@
 package http
 
 import (
-	"strings"
 	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/textract/types"
 )
 
+const (
+	StrategyKeyValueSet = "keyValueSet"
+	StrategyNextLine    = "nextLine"
+	StrategySameLine    = "sameLine"
+	StrategyTable       = "table"
+	StrategyCheckbox    = "checkbox"
+	StrategyCEL         = "cel"
+	// StrategyComputed marks the provenance of a computed field; it is not a search strategy
+	StrategyComputed = "computed"
+)
+
+const (
+	// ParseMode is the form field selecting the parse mode for a request
+	ParseMode = "parseMode"
+	// ParseModeLenient skips malformed blocks and reports them as warnings
+	ParseModeLenient = "lenient"
+	// ParseModeStrict fails the whole document on the first malformed block
+	ParseModeStrict = "strict"
+)
+
+// strategies lists every strategy name a schema field may reference
+var strategies = []string{
+	StrategyKeyValueSet,
+	StrategyNextLine,
+	StrategySameLine,
+	StrategyTable,
+	StrategyCheckbox,
+	StrategyCEL,
+}
+
 type FieldStrategy struct {
 	Key      string `json:"key"`
 	Strategy string `json:"strategy"`
+	// Column selects the table column by header text; without it the table strategy
+	// returns the cell right of the one containing Key
+	Column string `json:"column,omitempty"`
+	// Table restricts the table strategy to tables whose title contains it
+	Table string `json:"table,omitempty"`
+	// MinConfidence overrides the global minimum confidence for this field
+	MinConfidence float32 `json:"minConfidence,omitempty"`
+	// Optional marks fields that only some documents of the type carry; their absence is
+	// reported as not applicable rather than missing
+	Optional bool `json:"optional,omitempty"`
+	// PII is mask or keep and overrides the global pii.mask setting for this field
+	PII string `json:"pii,omitempty"`
+	// Expression is the CEL expression of the cel strategy, see cel.go
+	Expression string `json:"expression,omitempty"`
+	// Page restricts the search to first, last or a page number, for multi-page
+	// documents repeating a key on a summary page
+	Page string `json:"page,omitempty"`
+	// IgnoreCase compares the key with Turkish casing, İ/i and I/ı, for banks whose scans
+	// differ in the casing of their keys
+	IgnoreCase bool `json:"ignoreCase,omitempty"`
+	// IgnoreDiacritics compares the key without marks, ş/s, ğ/g, ü/u, ö/o, ç/c and ı/i
+	IgnoreDiacritics bool `json:"ignoreDiacritics,omitempty"`
 }
 
 type DocumentSchema struct {
 	Type   string                   `json:"type"`
 	Fields map[string]FieldStrategy `json:"fields"`
+	// Aliases are other docTypes clients may send for this schema, e.g. garanti-havale;
+	// responses carry the docType the alias resolved to
+	Aliases []string `json:"aliases,omitempty"`
+	// ReconstructLines rebuilds the lines from WORD geometry before the strategies run,
+	// for documents whose lines Textract splits mid-field
+	ReconstructLines bool `json:"reconstructLines,omitempty"`
+	// LineTolerance is the baseline distance, as a fraction of the page height, for
+	// words on the same line and blocks on the same row; 0 uses the default
+	LineTolerance float32 `json:"lineTolerance,omitempty"`
+	// NormalizeKeys compares keys and text with whitespace collapsed, dashes unified and
+	// trailing colons and dots removed, so "Gönderen :" matches the key "Gönderen:"
+	NormalizeKeys bool `json:"normalizeKeys,omitempty"`
+	// Computed maps field names to expressions over the extracted fields, e.g.
+	// "netTutar": "tutar - masraf"; they are evaluated after extraction
+	Computed map[string]string `json:"computed,omitempty"`
+	// Assertions are consistency checks evaluated after the computed fields
+	Assertions []Assertion `json:"assertions,omitempty"`
+	// Currency converts foreign currency amounts to TRY when fx is enabled
+	Currency *CurrencyConversion `json:"currency,omitempty"`
+	// TaxBreakdown reads the VAT lines of invoices into kdvTutari, kdvOrani and the
+	// taxBreakdown of the response, before the computed fields
+	TaxBreakdown bool `json:"taxBreakdown,omitempty"`
+}
+
+// ErrCodeMalformedBlocks is returned when a strict parse rejects the Textract output
+const ErrCodeMalformedBlocks = "MALFORMED_TEXTRACT_OUTPUT"
+
+// MalformedBlocksError lists the blocks a strict parse rejected
+type MalformedBlocksError struct {
+	Problems []string
+}
+
+func (e *MalformedBlocksError) Error() string {
+	return fmt.Sprintf("malformed textract output: %s", strings.Join(e.Problems, "; "))
+}
+
+// ParseOptions tune how strictly a document is parsed
+type ParseOptions struct {
+	// Mode is ParseModeLenient or ParseModeStrict, empty means lenient
+	Mode string
+	// MinConfidence is the Textract confidence (0-100) a value needs to be returned
+	MinConfidence float32
+	// Explain records the blocks each strategy considered, see Explanation
+	Explain bool
+}
+
+// FieldProvenance tells which block and strategy a value was read from
+type FieldProvenance struct {
+	Strategy    string             `json:"strategy"`
+	Key         string             `json:"key"`
+	Confidence  float32            `json:"confidence"`
+	BlockID     string             `json:"blockId"`
+	Page        int32              `json:"page"`
+	BoundingBox *types.BoundingBox `json:"boundingBox,omitempty"`
+	// PII lists the kinds of personal data detected in the value
+	PII []string `json:"pii,omitempty"`
+}
+
+// LowConfidenceValue is a value that was found but scored below the minimum confidence
+type LowConfidenceValue struct {
+	Value         string  `json:"value"`
+	Confidence    float32 `json:"confidence"`
+	MinConfidence float32 `json:"minConfidence"`
 }
 
 type ReceiptParser struct {
-	blocks []types.Block
-	schema DocumentSchema
+	blocks        []types.Block
+	schema        DocumentSchema
+	options       ParseOptions
+	warnings      []Warning
+	violations    []Violation
+	missing       []string
+	notApplicable []string
+	lowConfidence map[string]LowConfidenceValue
+	provenance    map[string]FieldProvenance
+	taxBreakdown  *TaxBreakdown
+	explanation   map[string]*FieldExplanation
+	trace         []string
+	// field is the field being searched, explaining its explanation in explain parses
+	field      string
+	explaining *FieldExplanation
+	// fuzzy makes the strategies ignore case and Turkish characters in keys
+	fuzzy bool
+	// keyMatch compares the keys as the field being searched asks, see keymatch.go
+	keyMatch keyMatcher
+	// index maps block ids to blocks, built on first lookup
+	index map[string]*types.Block
+	// tables is the table grid, built on first use by the table strategy
+	tables []*table
 }
 
-func NewReceiptParser(blocks []types.Block, schema DocumentSchema) *ReceiptParser {
+func NewReceiptParser(blocks []types.Block, schema DocumentSchema, options ParseOptions) *ReceiptParser {
+	if options.Mode == "" {
+		options.Mode = ParseModeLenient
+	}
 	return &ReceiptParser{
-		blocks: blocks,
-		schema: schema,
+		blocks:   blocks,
+		schema:   schema,
+		options:  options,
+		keyMatch: keyMatcher{normalize: schema.NormalizeKeys},
 	}
 }
 
-func (p *ReceiptParser) Parse() ExtractedInfo {
+// Warnings returns the soft issues of the parse: skipped blocks, held back values,
+// fuzzy key matches and duplicate keys
+func (p *ReceiptParser) Warnings() []Warning {
+	return p.warnings
+}
+
+// Violations returns the assertions the extracted fields failed
+func (p *ReceiptParser) Violations() []Violation {
+	return p.violations
+}
+
+// Missing returns the required fields that were not found
+func (p *ReceiptParser) Missing() []string {
+	return p.missing
+}
+
+// NotApplicable returns the optional fields the document does not carry
+func (p *ReceiptParser) NotApplicable() []string {
+	return p.notApplicable
+}
+
+// TaxBreakdown returns the VAT per rate for schemas with taxBreakdown, nil when the
+// document has no VAT lines
+func (p *ReceiptParser) TaxBreakdown() *TaxBreakdown {
+	return p.taxBreakdown
+}
+
+// LowConfidence returns the fields held back from the result because their value
+// scored below the minimum confidence
+func (p *ReceiptParser) LowConfidence() map[string]LowConfidenceValue {
+	return p.lowConfidence
+}
+
+// Provenance returns where each extracted value was read from
+func (p *ReceiptParser) Provenance() map[string]FieldProvenance {
+	return p.provenance
+}
+
+// Trace returns the steps of the last parse, for debugging schemas
+func (p *ReceiptParser) Trace() []string {
+	return p.trace
+}
+
+// UnmatchedLines returns the text of the lines no extracted value was read from
+func (p *ReceiptParser) UnmatchedLines() []string {
+	used := make(map[string]bool, len(p.provenance))
+	for _, provenance := range p.provenance {
+		used[provenance.BlockID] = true
+	}
+
+	var lines []string
+	for _, block := range p.blocks {
+		if block.BlockType == types.BlockTypeLine && !used[blockID(block)] {
+			lines = append(lines, blockText(block))
+		}
+	}
+	return lines
+}
+
+func (p *ReceiptParser) tracef(format string, args ...any) {
+	p.trace = append(p.trace, fmt.Sprintf(format, args...))
+}
+
+func (p *ReceiptParser) Parse() (ExtractedInfo, error) {
+	valid, problems := checkBlocks(p.blocks)
+	if len(problems) > 0 {
+		if p.options.Mode == ParseModeStrict {
+			return nil, &MalformedBlocksError{Problems: problems}
+		}
+		p.blocks = valid
+		for _, problem := range problems {
+			p.warn(WarnMalformedBlock, "", "%s", problem)
+		}
+	}
+	if p.schema.ReconstructLines {
+		p.blocks = reconstructLines(p.blocks, p.schema.LineTolerance)
+	}
+	p.blocks = sortReadingOrder(p.blocks, p.schema.LineTolerance)
+
 	extractedInfo := make(ExtractedInfo)
-	fmt.Println("Parsing document with schema:", p.schema)
-	fmt.Println("Total blocks:", len(p.blocks))
-	
+	p.provenance = make(map[string]FieldProvenance)
+	p.tracef("Parsing %s document with %d fields, %d blocks", p.schema.Type, len(p.schema.Fields), len(p.blocks))
+
 	for field, strategy := range p.schema.Fields {
-		fmt.Printf("Searching for field: %s with key: %s and strategy: %s\n", field, strategy.Key, strategy.Strategy)
-		value := p.findFieldValue(strategy)
-		if value != "" {
+		p.tracef("Searching for field: %s with key: %s and strategy: %s", field, strategy.Key, strategy.Strategy)
+		p.field = field
+		p.beginExplain(field, strategy)
+		restore := p.scopeToPage(strategy.Page)
+		p.keyMatch.set(strategy)
+		value, source := p.findFieldValue(strategy)
+		if value == "" {
+			value, source = p.findFuzzy(field, strategy)
+		}
+		restore()
+		var confidence float32
+		if source != nil {
+			confidence = blockConfidence(*source)
+		}
+		minConfidence := p.options.MinConfidence
+		if strategy.MinConfidence > 0 {
+			minConfidence = strategy.MinConfidence
+		}
+		switch {
+		case value != "" && confidence < minConfidence:
+			if p.lowConfidence == nil {
+				p.lowConfidence = make(map[string]LowConfidenceValue)
+			}
+			p.lowConfidence[field] = LowConfidenceValue{Value: value, Confidence: confidence, MinConfidence: minConfidence}
+			p.tracef("Low confidence value for %s: %s (%.1f)", field, value, confidence)
+			p.warn(WarnLowConfidence, field, "value held back, confidence %.1f is below %.1f", confidence, minConfidence)
+			p.endExplain(source, value, OutcomeLowConfidence, fmt.Sprintf("confidence %.1f is below %.1f", confidence, minConfidence))
+		case value != "":
 			extractedInfo[field] = value
-			fmt.Printf("Found value for %s: %s\n", field, value)
-		} else {
-			fmt.Printf("Could not find value for field: %s\n", field)
+			p.provenance[field] = provenanceOf(strategy, source)
+			p.tracef("Found value for %s: %s", field, value)
+			p.endExplain(source, value, OutcomeFound, "")
+		case strategy.Optional:
+			p.notApplicable = append(p.notApplicable, field)
+			p.tracef("Optional field not present: %s", field)
+			p.endExplain(nil, "", OutcomeNotApplicable, "")
+		default:
+			p.missing = append(p.missing, field)
+			p.tracef("Could not find value for field: %s", field)
+			p.endExplain(nil, "", OutcomeMissing, "")
 		}
 	}
-	
+	sort.Strings(p.missing)
+	sort.Strings(p.notApplicable)
+
+	if p.schema.TaxBreakdown {
+		p.parseTaxBreakdown(extractedInfo)
+	}
+	p.compute(extractedInfo)
+
 	if len(extractedInfo) == 0 {
-		fmt.Println("No information extracted. Printing all blocks:")
-		for _, block := range p.blocks {
-			if block.Text != nil {
-				fmt.Printf("BlockType: %s, Text: %s\n", block.BlockType, *block.Text)
+		p.tracef("No information extracted")
+	}
+
+	if err := p.checkAssertions(extractedInfo); err != nil {
+		return extractedInfo, err
+	}
+	return extractedInfo, nil
+}
+
+// compute evaluates the computed fields of the schema over extractedInfo. A field whose
+// operands were not extracted, or do not evaluate, is left out.
+func (p *ReceiptParser) compute(extractedInfo ExtractedInfo) {
+	if len(p.schema.Computed) == 0 {
+		return
+	}
+	pending := make(map[string]expr, len(p.schema.Computed))
+	for field, src := range p.schema.Computed {
+		e, err := parseExpr(src)
+		if err != nil {
+			p.tracef("Invalid expression for computed field %s: %s", field, err)
+			continue
+		}
+		pending[field] = e
+	}
+
+	env := &parserEnv{parser: p, extractedInfo: extractedInfo}
+
+	// computed fields may depend on each other, so evaluate them in rounds until no
+	// more can be resolved; validateSchemas rejects cycles
+	for len(pending) > 0 {
+		progress := false
+		for field, e := range pending {
+			ready := true
+			e.fields(func(name string) {
+				if _, ok := pending[name]; ok {
+					ready = false
+				}
+			})
+			if !ready {
+				continue
+			}
+			delete(pending, field)
+			progress = true
+
+			value, err := e.eval(env)
+			if err != nil {
+				p.tracef("Could not compute field %s: %s", field, err)
+				continue
+			}
+			extractedInfo[field] = value.String()
+
+			provenance := FieldProvenance{Strategy: StrategyComputed, Key: p.schema.Computed[field], Confidence: 100}
+			e.fields(func(name string) {
+				if operand, ok := p.provenance[name]; ok {
+					provenance.Confidence = min(provenance.Confidence, operand.Confidence)
+				}
+			})
+			p.provenance[field] = provenance
+			p.tracef("Computed value for %s: %s", field, extractedInfo[field])
+		}
+		if !progress {
+			break
+		}
+	}
+}
+
+func provenanceOf(strategy FieldStrategy, source *types.Block) FieldProvenance {
+	provenance := FieldProvenance{
+		Strategy:   strategy.Strategy,
+		Key:        strategy.Key,
+		Confidence: blockConfidence(*source),
+		BlockID:    blockID(*source),
+		Page:       blockPage(*source),
+	}
+	if source.Geometry != nil {
+		provenance.BoundingBox = source.Geometry.BoundingBox
+	}
+	return provenance
+}
+
+// checkBlocks separates the blocks the strategies can rely on from malformed ones
+// and describes every problem found
+func checkBlocks(blocks []types.Block) ([]types.Block, []string) {
+	ids := make(map[string]int, len(blocks))
+	for _, block := range blocks {
+		if id := blockID(block); id != "" {
+			ids[id]++
+		}
+	}
+
+	var problems []string
+	valid := make([]types.Block, 0, len(blocks))
+	for i, block := range blocks {
+		problem := ""
+		switch {
+		case blockID(block) == "":
+			problem = "has no Id"
+		case ids[blockID(block)] > 1:
+			problem = "has a duplicate Id"
+		case block.BlockType == "":
+			problem = "has no BlockType"
+		case (block.BlockType == types.BlockTypeLine || block.BlockType == types.BlockTypeWord) && block.Text == nil:
+			problem = "has no Text"
+		case block.BlockType == types.BlockTypeCell && (block.RowIndex == nil || block.ColumnIndex == nil):
+			problem = "has no RowIndex or ColumnIndex"
+		case (block.BlockType == types.BlockTypeCell || block.BlockType == types.BlockTypeMergedCell) &&
+			(block.RowIndex != nil || block.ColumnIndex != nil) &&
+			(!validTableIndex(block.RowIndex) || !validTableIndex(block.ColumnIndex)):
+			problem = fmt.Sprintf("has a RowIndex or ColumnIndex outside 1..%d", maxTableIndex)
+		case block.BlockType == types.BlockTypeMergedCell && (aws.ToInt32(block.RowSpan) > maxTableIndex || aws.ToInt32(block.ColumnSpan) > maxTableIndex):
+			problem = fmt.Sprintf("has a RowSpan or ColumnSpan over %d", maxTableIndex)
+		default:
+			problem = checkRelationships(block, ids)
+		}
+
+		if problem != "" {
+			problems = append(problems, fmt.Sprintf("block %d (%s %s) %s", i, block.BlockType, blockID(block), problem))
+			continue
+		}
+		valid = append(valid, block)
+	}
+	sort.Strings(problems)
+	return valid, problems
+}
+
+func checkRelationships(block types.Block, ids map[string]int) string {
+	for _, relationship := range block.Relationships {
+		for _, id := range relationship.Ids {
+			if ids[id] == 0 {
+				return fmt.Sprintf("references missing block %s", id)
 			}
 		}
 	}
-	
-	return extractedInfo
+	return ""
+}
+
+// blockText and blockID read the optional block fields, returning "" when unset
+func blockText(block types.Block) string {
+	return aws.ToString(block.Text)
+}
+
+func blockID(block types.Block) string {
+	return aws.ToString(block.Id)
 }
 
-func (p *ReceiptParser) findFieldValue(strategy FieldStrategy) string {
+// blockPage returns the page of a block; single page documents leave it unset
+func blockPage(block types.Block) int32 {
+	return max(aws.ToInt32(block.Page), 1)
+}
+
+// blockConfidence returns the Textract confidence of a block, 0 when unset
+func blockConfidence(block types.Block) float32 {
+	return aws.ToFloat32(block.Confidence)
+}
+
+// findFieldValue returns the value for a field and the block it was read from
+func (p *ReceiptParser) findFieldValue(strategy FieldStrategy) (string, *types.Block) {
 	switch strategy.Strategy {
-	case "keyValueSet":
+	case StrategyKeyValueSet:
 		return p.findKeyValueSet(strategy.Key)
-	case "nextLine":
+	case StrategyNextLine:
 		return p.findNextLine(strategy.Key)
-	case "sameLine":
+	case StrategySameLine:
 		return p.findSameLine(strategy.Key)
-	case "table":
-		return p.findInTable(strategy.Key)
+	case StrategyTable:
+		return p.findInTable(strategy)
+	case StrategyCheckbox:
+		return p.findCheckbox(strategy.Key)
+	case StrategyCEL:
+		return p.findCEL(strategy.Expression)
 	default:
-		return ""
+		return "", nil
 	}
 }
 
-func (p *ReceiptParser) findKeyValueSet(key string) string {
-	fmt.Printf("Searching for key: %s in KEY_VALUE_SET\n", key)
-	for _, block := range p.blocks {
-		if block.BlockType == types.BlockTypeKeyValueSet && len(block.EntityTypes) > 0 && block.EntityTypes[0] == types.EntityTypeKey {
-			if block.Text != nil {
-				fmt.Printf("Found KEY block with text: %s\n", *block.Text)
-				if *block.Text == key {
-					fmt.Printf("Key match found for: %s\n", key)
-					for _, relationship := range block.Relationships {
-						if relationship.Type == types.RelationshipTypeValue {
-							for _, valueId := range relationship.Ids {
-								valueBlock := p.findBlockById(valueId)
-								if valueBlock != nil && valueBlock.Text != nil {
-									fmt.Printf("Found VALUE for %s: %s\n", key, *valueBlock.Text)
-									return *valueBlock.Text
-								}
-							}
-						}
-					}
-				}
+// findKeyValueSet follows the Textract form graph: the KEY block whose words read key,
+// its VALUE relationship, and the words below the VALUE block
+func (p *ReceiptParser) findKeyValueSet(key string) (string, *types.Block) {
+	for i, block := range p.blocks {
+		if p.isKeyValueSet(block, key) {
+			p.tracef("Key match found for: %s", key)
+			if value, source := p.getValueFromKeyValueSet(block); value != "" {
+				p.checkDuplicateKeys(i+1, key, value)
+				return value, source
 			}
+			p.reject(&p.blocks[i], p.text(block), "key has no value")
+		} else if p.explaining != nil && block.BlockType == types.BlockTypeKeyValueSet && nearMiss(p.text(block), key) {
+			p.reject(&p.blocks[i], p.text(block), "key does not match %q exactly", key)
 		}
 	}
-	fmt.Printf("No value found for key: %s\n", key)
-	return ""
+	return "", nil
 }
 
 func (p *ReceiptParser) isKeyValueSet(block types.Block, key string) bool {
 	return block.BlockType == types.BlockTypeKeyValueSet &&
-		block.EntityTypes != nil &&
 		len(block.EntityTypes) > 0 &&
 		block.EntityTypes[0] == types.EntityTypeKey &&
-		block.Text != nil &&
-		*block.Text == key
+		p.keyIs(normalizeKey(p.text(block)), normalizeKey(key))
 }
 
-func (p *ReceiptParser) getValueFromKeyValueSet(block types.Block) string {
+// getValueFromKeyValueSet returns the text of the first non-empty VALUE block of a KEY
+// block, together with that VALUE block
+func (p *ReceiptParser) getValueFromKeyValueSet(block types.Block) (string, *types.Block) {
 	for _, relationship := range block.Relationships {
-		if relationship.Type == types.RelationshipTypeValue {
-			for _, valueId := range relationship.Ids {
-				valueBlock := p.findBlockById(valueId)
-				if valueBlock != nil && valueBlock.Text != nil {
-					return *valueBlock.Text
-				}
+		if relationship.Type != types.RelationshipTypeValue {
+			continue
+		}
+		for _, valueId := range relationship.Ids {
+			valueBlock := p.findBlockById(valueId)
+			if valueBlock == nil {
+				continue
+			}
+			if value := p.text(*valueBlock); value != "" {
+				return value, valueBlock
 			}
 		}
 	}
-	return ""
+	return "", nil
 }
 
-func (p *ReceiptParser) findNextLine(key string) string {
-	for i, block := range p.blocks {
-		if block.BlockType == types.BlockTypeLine && block.Text != nil && *block.Text == key {
-			if i+1 < len(p.blocks) {
-				nextBlock := p.blocks[i+1]
-				if nextBlock.BlockType == types.BlockTypeLine && nextBlock.Text != nil {
-					return *nextBlock.Text
-				}
-			}
-		}
+// text returns the text of a block. KEY, VALUE and CELL blocks usually carry no Text of
+// their own; theirs is the words of their CHILD relationships, joined in order.
+func (p *ReceiptParser) text(block types.Block) string {
+	if block.Text != nil {
+		return blockText(block)
 	}
-	return ""
-}
 
-func (p *ReceiptParser) findSameLine(key string) string {
-	for _, block := range p.blocks {
-		if block.BlockType == types.BlockTypeLine && block.Text != nil && strings.Contains(*block.Text, key) {
-			parts := strings.SplitN(*block.Text, ":", 2)
-			if len(parts) == 2 {
-				return strings.TrimSpace(parts[1])
+	var words []string
+	for _, relationship := range block.Relationships {
+		if relationship.Type != types.RelationshipTypeChild {
+			continue
+		}
+		for _, childId := range relationship.Ids {
+			child := p.findBlockById(childId)
+			if child != nil && child.BlockType == types.BlockTypeWord && child.Text != nil {
+				words = append(words, blockText(*child))
 			}
 		}
 	}
-	return ""
+	return strings.Join(words, " ")
 }
 
-func (p *ReceiptParser) findInTable(key string) string {
-	for _, block := range p.blocks {
-		if block.BlockType == types.BlockTypeCell && block.Text != nil && strings.Contains(*block.Text, key) {
-			if block.RowIndex != nil && block.ColumnIndex != nil {
-				return p.getValueFromNextCell(*block.RowIndex, *block.ColumnIndex)
+// normalizeKey lets "Tarih", "Tarih:" and " Tarih " match the same key
+func normalizeKey(key string) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(key), ":"))
+}
+
+func (p *ReceiptParser) findNextLine(key string) (string, *types.Block) {
+	for i, block := range p.blocks {
+		if block.BlockType != types.BlockTypeLine || block.Text == nil {
+			continue
+		}
+		if p.keyIs(blockText(block), key) {
+			if i+1 < len(p.blocks) {
+				nextBlock := &p.blocks[i+1]
+				if nextBlock.BlockType == types.BlockTypeLine && nextBlock.Text != nil {
+					return blockText(*nextBlock), nextBlock
+				}
 			}
+			p.reject(&p.blocks[i], blockText(block), "no line follows the key")
+		} else if p.explaining != nil && nearMiss(blockText(block), key) {
+			p.reject(&p.blocks[i], blockText(block), "line is not exactly %q", key)
 		}
 	}
-	return ""
+	return "", nil
 }
 
-func (p *ReceiptParser) findBlockById(id string) *types.Block {
-	for _, block := range p.blocks {
-		if block.Id != nil && *block.Id == id {
-			return &block
+func (p *ReceiptParser) findSameLine(key string) (string, *types.Block) {
+	for i, block := range p.blocks {
+		if block.BlockType != types.BlockTypeLine || block.Text == nil {
+			continue
+		}
+		if p.keyIn(blockText(block), key) {
+			parts := strings.SplitN(blockText(block), ":", 2)
+			if len(parts) == 2 {
+				value := strings.TrimSpace(parts[1])
+				p.checkDuplicateLines(i+1, key, value)
+				return value, &p.blocks[i]
+			}
+			p.reject(&p.blocks[i], blockText(block), "no colon separates the value")
+		} else if p.explaining != nil && nearMiss(blockText(block), key) {
+			p.reject(&p.blocks[i], blockText(block), "line contains %q only when case and colons are ignored", key)
 		}
 	}
-	return nil
+	return "", nil
 }
 
-func (p *ReceiptParser) getValueFromNextCell(rowIndex, columnIndex int32) string {
-	for _, block := range p.blocks {
-		if block.BlockType == types.BlockTypeCell &&
-			block.RowIndex != nil && *block.RowIndex == rowIndex &&
-			block.ColumnIndex != nil && *block.ColumnIndex == columnIndex+1 &&
-			block.Text != nil {
-			return *block.Text
+func (p *ReceiptParser) findBlockById(id string) *types.Block {
+	if p.index == nil {
+		p.index = make(map[string]*types.Block, len(p.blocks))
+		for i := range p.blocks {
+			if block := &p.blocks[i]; block.Id != nil {
+				p.index[blockID(*block)] = block
+			}
 		}
 	}
-	return ""
+	return p.index[id]
 }
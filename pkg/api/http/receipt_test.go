@@ -0,0 +1,200 @@
+package http
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+// textBlock returns a block with text and a confidence of 99
+func textBlock(blockType types.BlockType, id, text string) types.Block {
+	return types.Block{BlockType: blockType, Id: aws.String(id), Text: aws.String(text), Confidence: aws.Float32(99)}
+}
+
+// at places a block on the page with its top left corner at left, top
+func at(block types.Block, left, top float32) types.Block {
+	block.Geometry = &types.Geometry{BoundingBox: &types.BoundingBox{Left: left, Top: top, Width: 0.1, Height: 0.02}}
+	return block
+}
+
+// related adds a relationship of the given type to block
+func related(block types.Block, relationshipType types.RelationshipType, ids ...string) types.Block {
+	block.Relationships = append(block.Relationships, types.Relationship{Type: relationshipType, Ids: ids})
+	return block
+}
+
+// parseField parses blocks with a schema of the single field "alan"
+func parseField(t *testing.T, blocks []types.Block, strategy FieldStrategy, options ParseOptions) (string, *ReceiptParser) {
+	t.Helper()
+	parser := NewReceiptParser(blocks, DocumentSchema{Type: "test", Fields: map[string]FieldStrategy{"alan": strategy}}, options)
+	info, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info["alan"], parser
+}
+
+func TestParseMalformedBlocks(t *testing.T) {
+	valid := []types.Block{
+		textBlock(types.BlockTypeLine, "l1", "Tutar: 10,00 TL"),
+		textBlock(types.BlockTypeWord, "w1", "Tutar"),
+	}
+	tests := []struct {
+		name    string
+		block   types.Block
+		problem string
+	}{
+		{"no id", types.Block{BlockType: types.BlockTypeLine, Text: aws.String("x")}, "has no Id"},
+		{"duplicate id", textBlock(types.BlockTypeWord, "w1", "Tutar"), "has a duplicate Id"},
+		{"no block type", types.Block{Id: aws.String("b"), Text: aws.String("x")}, "has no BlockType"},
+		{"line without text", types.Block{BlockType: types.BlockTypeLine, Id: aws.String("b")}, "has no Text"},
+		{"word without text", types.Block{BlockType: types.BlockTypeWord, Id: aws.String("b")}, "has no Text"},
+		{"cell without indexes", types.Block{BlockType: types.BlockTypeCell, Id: aws.String("b"), RowIndex: aws.Int32(1)}, "has no RowIndex or ColumnIndex"},
+		{"cell index zero", types.Block{BlockType: types.BlockTypeCell, Id: aws.String("b"), RowIndex: aws.Int32(0), ColumnIndex: aws.Int32(1)}, "outside 1..1000"},
+		{"cell index too large", types.Block{BlockType: types.BlockTypeCell, Id: aws.String("b"), RowIndex: aws.Int32(1), ColumnIndex: aws.Int32(2147483647)}, "outside 1..1000"},
+		{"merged cell span too large", types.Block{BlockType: types.BlockTypeMergedCell, Id: aws.String("b"), RowIndex: aws.Int32(1), ColumnIndex: aws.Int32(1), RowSpan: aws.Int32(1001)}, "RowSpan or ColumnSpan over 1000"},
+		{"missing relationship", related(textBlock(types.BlockTypeLine, "b", "x"), types.RelationshipTypeChild, "w1", "yok"), "references missing block yok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := append([]types.Block{tt.block}, valid...)
+			strategy := FieldStrategy{Key: "Tutar", Strategy: StrategySameLine}
+
+			value, parser := parseField(t, blocks, strategy, ParseOptions{Mode: ParseModeLenient})
+			if value != "10,00 TL" {
+				t.Errorf("lenient parse returned %q", value)
+			}
+			if len(parser.Warnings()) == 0 || parser.Warnings()[0].Code != WarnMalformedBlock ||
+				!strings.Contains(parser.Warnings()[0].Message, tt.problem) {
+				t.Errorf("lenient parse warned %+v, want %s", parser.Warnings(), tt.problem)
+			}
+
+			schema := DocumentSchema{Type: "test", Fields: map[string]FieldStrategy{"alan": strategy}}
+			_, err := NewReceiptParser(blocks, schema, ParseOptions{Mode: ParseModeStrict}).Parse()
+			var malformed *MalformedBlocksError
+			if !errors.As(err, &malformed) || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("strict parse returned %v, want %s", err, tt.problem)
+			}
+		})
+	}
+}
+
+func TestParseNilFields(t *testing.T) {
+	// blocks with only a type and id must not panic any strategy
+	blocks := []types.Block{}
+	for i, blockType := range []types.BlockType{
+		types.BlockTypeKeyValueSet, types.BlockTypeTable, types.BlockTypeCell, types.BlockTypeMergedCell,
+		types.BlockTypeSelectionElement, types.BlockTypeTableTitle, types.BlockTypePage,
+	} {
+		blocks = append(blocks, types.Block{BlockType: blockType, Id: aws.String(string(rune('a' + i)))})
+	}
+	for _, strategy := range strategies {
+		t.Run(strategy, func(t *testing.T) {
+			field := FieldStrategy{Key: "Tutar", Strategy: strategy, Column: "Tutar", Expression: `"x"`}
+			if strategy == StrategyCEL {
+				field.Key = ""
+			}
+			for _, mode := range []string{ParseModeLenient, ParseModeStrict} {
+				schema := DocumentSchema{Type: "test", Fields: map[string]FieldStrategy{"alan": field}, ReconstructLines: true}
+				_, _ = NewReceiptParser(blocks, schema, ParseOptions{Mode: mode}).Parse()
+			}
+		})
+	}
+}
+
+func TestParseMinConfidence(t *testing.T) {
+	line := textBlock(types.BlockTypeLine, "l1", "Tutar: 10,00 TL")
+	line.Confidence = aws.Float32(80)
+	blocks := []types.Block{line}
+
+	tests := []struct {
+		name          string
+		global, field float32
+		held          bool
+	}{
+		{"no minimum", 0, 0, false},
+		{"above the global minimum", 70, 0, false},
+		{"equal to the global minimum", 80, 0, false},
+		{"below the global minimum", 90, 0, true},
+		{"field lowers the minimum", 90, 50, false},
+		{"field raises the minimum", 50, 85, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := FieldStrategy{Key: "Tutar", Strategy: StrategySameLine, MinConfidence: tt.field}
+			value, parser := parseField(t, blocks, strategy, ParseOptions{MinConfidence: tt.global})
+			held, ok := parser.LowConfidence()["alan"]
+			if ok != tt.held || (value == "") != tt.held {
+				t.Fatalf("value %q, held back %+v", value, held)
+			}
+			if tt.held && (held.Value != "10,00 TL" || held.Confidence != 80 || len(parser.Warnings()) != 1 || parser.Warnings()[0].Code != WarnLowConfidence) {
+				t.Errorf("held back %+v, warnings %+v", held, parser.Warnings())
+			}
+			if !tt.held && parser.Provenance()["alan"].Confidence != 80 {
+				t.Errorf("provenance %+v", parser.Provenance()["alan"])
+			}
+		})
+	}
+}
+
+// keyValueBlocks is a form pair whose KEY and VALUE blocks carry no text of their own,
+// as Textract returns them
+func keyValueBlocks(prefix, key, value string) []types.Block {
+	keyBlock := related(types.Block{
+		BlockType: types.BlockTypeKeyValueSet, Id: aws.String(prefix + "k"), EntityTypes: []types.EntityType{types.EntityTypeKey},
+	}, types.RelationshipTypeChild, prefix+"kw")
+	keyBlock = related(keyBlock, types.RelationshipTypeValue, prefix+"v")
+	valueBlock := related(types.Block{
+		BlockType: types.BlockTypeKeyValueSet, Id: aws.String(prefix + "v"), EntityTypes: []types.EntityType{types.EntityTypeValue},
+		Confidence: aws.Float32(91),
+	}, types.RelationshipTypeChild, prefix+"vw1", prefix+"vw2")
+
+	valueWords := strings.SplitN(value, " ", 2)
+	return []types.Block{
+		keyBlock,
+		valueBlock,
+		textBlock(types.BlockTypeWord, prefix+"kw", key),
+		textBlock(types.BlockTypeWord, prefix+"vw1", valueWords[0]),
+		textBlock(types.BlockTypeWord, prefix+"vw2", valueWords[1]),
+	}
+}
+
+func TestParseKeyValueSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []types.Block
+		key    string
+		want   string
+	}{
+		{"child words", keyValueBlocks("a", "Alıcı", "Ayşe Yılmaz"), "Alıcı", "Ayşe Yılmaz"},
+		{"trailing colon in the key", keyValueBlocks("a", "Alıcı:", "Ayşe Yılmaz"), "Alıcı", "Ayşe Yılmaz"},
+		{"trailing colon in the schema", keyValueBlocks("a", "Alıcı", "Ayşe Yılmaz"), " Alıcı: ", "Ayşe Yılmaz"},
+		{"other key", keyValueBlocks("a", "Gönderen", "Ayşe Yılmaz"), "Alıcı", ""},
+		{"first of several pairs", append(keyValueBlocks("a", "Gönderen", "Ali Demir"), keyValueBlocks("b", "Alıcı", "Ayşe Yılmaz")...), "Alıcı", "Ayşe Yılmaz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, parser := parseField(t, tt.blocks, FieldStrategy{Key: tt.key, Strategy: StrategyKeyValueSet}, ParseOptions{Mode: ParseModeStrict})
+			if value != tt.want {
+				t.Fatalf("got %q, want %q", value, tt.want)
+			}
+			if provenance := parser.Provenance()["alan"]; tt.want != "" && (provenance.Confidence != 91 || !strings.HasSuffix(provenance.BlockID, "v")) {
+				t.Errorf("provenance %+v, want the VALUE block", provenance)
+			}
+		})
+	}
+}
+
+func TestParseKeyValueSetValueWithoutWords(t *testing.T) {
+	// a VALUE without words is skipped for the next VALUE of the key
+	blocks := keyValueBlocks("a", "Alıcı", "Ayşe Yılmaz")
+	blocks[0].Relationships[1].Ids = []string{"bos", "av"}
+	blocks = append(blocks, types.Block{BlockType: types.BlockTypeKeyValueSet, Id: aws.String("bos"), EntityTypes: []types.EntityType{types.EntityTypeValue}})
+
+	if value, _ := parseField(t, blocks, FieldStrategy{Key: "Alıcı", Strategy: StrategyKeyValueSet}, ParseOptions{}); value != "Ayşe Yılmaz" {
+		t.Errorf("got %q", value)
+	}
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"time"
+
+	"github.com/mehmetsafabenli/cbomdekont/pkg/fscache"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var (
+	configReloadsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "config",
+		Name:      "reloads_total",
+		Help:      "The number of live config reloads by config and result: success or failure.",
+	}, []string{"config", "result"})
+	configReloadTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "config",
+		Name:      "last_reload_success_timestamp_seconds",
+		Help:      "Unix time of the last successful live reload by config.",
+	}, []string{"config"})
+)
+
+func init() {
+	prometheus.MustRegister(configReloadsCounter)
+	prometheus.MustRegister(configReloadTimestamp)
+}
+
+// watchReloads re-applies a config read from the directory of w on every reload of the
+// watcher. apply reports whether the config changed, other files of the directory do
+// not count as a reload; on an error the current config is kept.
+func watchReloads(w *fscache.Watcher, config string, logger *zap.Logger, apply func() (bool, error)) {
+	w.OnReload(func(err error) {
+		changed := false
+		if err == nil {
+			changed, err = apply()
+		}
+		if err != nil {
+			configReloadsCounter.WithLabelValues(config, "failure").Inc()
+			logger.Error("Invalid config change, keeping the previous one", zap.String("config", config), zap.Error(err))
+			return
+		}
+		if changed {
+			configReloadsCounter.WithLabelValues(config, "success").Inc()
+			configReloadTimestamp.WithLabelValues(config).Set(float64(time.Now().Unix()))
+			logger.Info("Config reloaded", zap.String("config", config))
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	SampleReasonNothingExtracted = "nothing-extracted"
+	SampleReasonMalformed        = "malformed"
+	SampleReasonValidation       = "validation"
+
+	defaultSamplesMaxAge   = 7 * 24 * time.Hour
+	defaultSamplesMaxCount = 1000
+)
+
+// SamplesConfig enables keeping anonymized copies of failed extractions for schema
+// developers. Only the Textract output is kept, never the document image, so faces and
+// signatures are not stored; IBANs, national ids, phone numbers and e-mail addresses in
+// the text are masked.
+type SamplesConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Dir receives one <docType>/<time>-<reason>.textract.json file per sample, in the
+	// format of the golden fixtures
+	Dir      string        `mapstructure:"dir"`
+	MaxAge   time.Duration `mapstructure:"max-age"`
+	MaxCount int           `mapstructure:"max-count"`
+}
+
+var samplesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "samples",
+	Name:      "captured_total",
+	Help:      "The number of anonymized failed extractions stored for schema debugging.",
+}, []string{"docType", "reason"})
+
+func init() {
+	prometheus.MustRegister(samplesCounter)
+}
+
+// digitRunPattern catches account numbers and other long numbers the PII detectors miss
+var digitRunPattern = regexp.MustCompile(`\+?\d[\d\s-]{8,}\d`)
+
+// anonymizeText masks the personal data and long numbers in text completely, keeping its
+// length and layout so the schema strategies still see the same lines
+func anonymizeText(text string) string {
+	maskAll := func(match string) string {
+		return strings.Map(func(r rune) rune {
+			switch {
+			case r >= '0' && r <= '9':
+				return '0'
+			case r == '@' || r == '.' || r == ' ':
+				return r
+			default:
+				return 'x'
+			}
+		}, match)
+	}
+	for _, detector := range piiDetectors {
+		text = detector.pattern.ReplaceAllStringFunc(text, maskAll)
+	}
+	return digitRunPattern.ReplaceAllStringFunc(text, maskAll)
+}
+
+type sampleStore struct {
+	cfg SamplesConfig
+	mu  sync.Mutex
+}
+
+func newSampleStore(cfg SamplesConfig) (*sampleStore, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("samples.dir is required when samples are enabled")
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = defaultSamplesMaxAge
+	}
+	if cfg.MaxCount <= 0 {
+		cfg.MaxCount = defaultSamplesMaxCount
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+	return &sampleStore{cfg: cfg}, nil
+}
+
+// save writes an anonymized copy of blocks and then enforces the retention limits
+func (st *sampleStore) save(docType, reason string, blocks []types.Block, now time.Time) error {
+	anonymized := make([]types.Block, len(blocks))
+	for i, block := range blocks {
+		anonymized[i] = block
+		if block.Text != nil {
+			text := anonymizeText(*block.Text)
+			anonymized[i].Text = &text
+		}
+	}
+	data, err := json.Marshal(textract.AnalyzeDocumentOutput{Blocks: anonymized})
+	if err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	dir := filepath.Join(st.cfg.Dir, filepath.Base(docType))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s%s", now.UTC().Format("20060102T150405.000000000"), reason, textractFixtureSuffix)
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		return err
+	}
+	st.purge(now)
+	return nil
+}
+
+// purge removes samples older than max-age and the oldest ones beyond max-count and
+// returns how many were removed; the caller holds mu
+func (st *sampleStore) purge(now time.Time) int {
+	files, err := filepath.Glob(filepath.Join(st.cfg.Dir, "*", "*"+textractFixtureSuffix))
+	if err != nil {
+		return 0
+	}
+
+	type sample struct {
+		path    string
+		modTime time.Time
+	}
+	samples := make([]sample, 0, len(files))
+	purged := 0
+	for _, file := range files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if now.Sub(stat.ModTime()) > st.cfg.MaxAge {
+			if os.Remove(file) == nil {
+				purged++
+			}
+			continue
+		}
+		samples = append(samples, sample{path: file, modTime: stat.ModTime()})
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].modTime.After(samples[j].modTime) })
+	for _, old := range samples[min(len(samples), st.cfg.MaxCount):] {
+		if os.Remove(old.path) == nil {
+			purged++
+		}
+	}
+	return purged
+}
+
+// captureSample stores an anonymized copy of a failed extraction in the background
+func (s *Server) captureSample(docType, reason string, blocks []types.Block) {
+	if s.samples == nil {
+		return
+	}
+	go func() {
+		if err := s.samples.save(docType, reason, blocks, time.Now()); err != nil {
+			s.logger.Error("Failed to store sample", zap.Error(err), zap.String("docType", docType))
+			return
+		}
+		samplesCounter.WithLabelValues(docType, reason).Inc()
+	}()
+}
+
+func (s *Server) startSampleJanitor() {
+	if s.samples == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.samples.mu.Lock()
+			purged := s.samples.purge(time.Now())
+			s.samples.mu.Unlock()
+			if purged > 0 {
+				s.logger.Info("purged expired samples", zap.Int("count", purged))
+			}
+		}
+	}()
+}
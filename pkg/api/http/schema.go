@@ -0,0 +1,354 @@
+package http
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// defaultSchemas holds one schema per docType, named <docType>.json
+//
+//go:embed schemas/*.json
+var defaultSchemas embed.FS
+
+var (
+	schemaDocTypesGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "schema",
+		Name:      "doc_types_loaded",
+		Help:      "The number of document types loaded from the schema file.",
+	})
+	schemaFieldsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "schema",
+		Name:      "fields",
+		Help:      "The number of fields declared per document type.",
+	}, []string{"docType"})
+	schemaLoadTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "schema",
+		Name:      "last_load_timestamp_seconds",
+		Help:      "Unix time of the last successful schema load.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(schemaDocTypesGauge)
+	prometheus.MustRegister(schemaFieldsGauge)
+	prometheus.MustRegister(schemaLoadTimestamp)
+}
+
+// schemaSet is an immutable snapshot of the loaded schemas. Reloads build a new set
+// and swap the pointer, so readers never hold a lock and never see a partial update.
+type schemaSet struct {
+	schemas map[string]DocumentSchema
+	// aliases maps every alias to its docType
+	aliases  map[string]string
+	loadedAt time.Time
+}
+
+// SchemaStatus summarizes a loaded document type
+type SchemaStatus struct {
+	DocType string   `json:"docType"`
+	Type    string   `json:"type"`
+	Fields  int      `json:"fields"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+func loadEmbeddedSchemas() (map[string]DocumentSchema, error) {
+	files, err := fs.Glob(defaultSchemas, "schemas/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := make(map[string]DocumentSchema, len(files))
+	for _, file := range files {
+		data, err := defaultSchemas.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var schema DocumentSchema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return nil, fmt.Errorf("embedded schema %s: %w", file, err)
+		}
+		schemas[strings.TrimSuffix(path.Base(file), ".json")] = schema
+	}
+	return schemas, nil
+}
+
+// validateSchemas checks that every field references a known strategy
+func validateSchemas(schemas map[string]DocumentSchema) error {
+	var problems []string
+	for docType, schema := range schemas {
+		if schema.LineTolerance < 0 || schema.LineTolerance >= 1 {
+			problems = append(problems, fmt.Sprintf("%s: lineTolerance must be between 0 and 1", docType))
+		}
+		for field, strategy := range schema.Fields {
+			if !slices.Contains(strategies, strategy.Strategy) {
+				problems = append(problems, fmt.Sprintf("%s.%s: unknown strategy %q", docType, field, strategy.Strategy))
+			}
+			if strategy.PII != "" && strategy.PII != PIIMask && strategy.PII != PIIKeep {
+				problems = append(problems, fmt.Sprintf("%s.%s: pii must be mask or keep", docType, field))
+			}
+			if err := validatePage(strategy.Page); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.%s: %s", docType, field, err))
+			}
+			if strategy.Strategy == StrategyCEL {
+				if _, err := compileCEL(strategy.Expression); err != nil {
+					problems = append(problems, fmt.Sprintf("%s.%s: invalid CEL expression: %s", docType, field, err))
+				}
+			}
+		}
+		for _, alias := range schema.Aliases {
+			if _, ok := schemas[alias]; ok || alias == "" {
+				problems = append(problems, fmt.Sprintf("%s: alias %q is empty or a docType", docType, alias))
+			}
+		}
+		problems = append(problems, validateComputed(docType, schema)...)
+		problems = append(problems, validateAssertions(docType, schema)...)
+		problems = append(problems, validateTaxBreakdown(docType, schema)...)
+		if schema.Currency != nil && (schema.Currency.Amount == "" || schema.Currency.Date == "") {
+			problems = append(problems, fmt.Sprintf("%s: currency needs the amount and date fields", docType))
+		}
+	}
+	problems = append(problems, duplicateAliases(schemas)...)
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid schema: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// duplicateAliases reports aliases claimed by more than one schema
+func duplicateAliases(schemas map[string]DocumentSchema) []string {
+	claimed := make(map[string][]string)
+	for docType, schema := range schemas {
+		for _, alias := range schema.Aliases {
+			if !slices.Contains(claimed[alias], docType) {
+				claimed[alias] = append(claimed[alias], docType)
+			}
+		}
+	}
+	var problems []string
+	for alias, docTypes := range claimed {
+		if len(docTypes) > 1 {
+			sort.Strings(docTypes)
+			problems = append(problems, fmt.Sprintf("alias %q is used by %s", alias, strings.Join(docTypes, ", ")))
+		}
+	}
+	return problems
+}
+
+// aliasTable maps the aliases of schemas to their docType; the schemas are validated, so
+// every alias is unique
+func aliasTable(schemas map[string]DocumentSchema) map[string]string {
+	aliases := make(map[string]string)
+	for docType, schema := range schemas {
+		for _, alias := range schema.Aliases {
+			aliases[alias] = docType
+		}
+	}
+	return aliases
+}
+
+// validateComputed checks that the computed fields of a schema parse, do not shadow an
+// extracted field and do not depend on each other in a cycle
+func validateComputed(docType string, schema DocumentSchema) []string {
+	var problems []string
+	deps := make(map[string][]string, len(schema.Computed))
+	for field, src := range schema.Computed {
+		if _, ok := schema.Fields[field]; ok {
+			problems = append(problems, fmt.Sprintf("%s.%s: computed field shadows an extracted field", docType, field))
+		}
+		e, err := parseExpr(src)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s.%s: invalid expression: %s", docType, field, err))
+			continue
+		}
+		e.fields(func(name string) {
+			if _, ok := schema.Computed[name]; ok {
+				deps[field] = append(deps[field], name)
+			}
+		})
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(deps))
+	var visit func(field string) bool
+	visit = func(field string) bool {
+		switch state[field] {
+		case visiting:
+			return false
+		case done:
+			return true
+		}
+		state[field] = visiting
+		for _, dep := range deps[field] {
+			if !visit(dep) {
+				return false
+			}
+		}
+		state[field] = done
+		return true
+	}
+	for field := range deps {
+		if state[field] == 0 && !visit(field) {
+			problems = append(problems, fmt.Sprintf("%s.%s: computed fields depend on each other in a cycle", docType, field))
+		}
+	}
+	return problems
+}
+
+// setSchemas swaps in a freshly loaded schema set, then logs and exports a summary of it
+func (s *AWSService) setSchemas(schemas map[string]DocumentSchema) {
+	loadedAt := time.Now()
+
+	s.schemas.Store(&schemaSet{schemas: schemas, aliases: aliasTable(schemas), loadedAt: loadedAt})
+
+	schemaFieldsGauge.Reset()
+	docTypes := make([]string, 0, len(schemas))
+	for docType, schema := range schemas {
+		docTypes = append(docTypes, docType)
+		schemaFieldsGauge.WithLabelValues(docType).Set(float64(len(schema.Fields)))
+	}
+	sort.Strings(docTypes)
+	schemaDocTypesGauge.Set(float64(len(schemas)))
+	schemaLoadTimestamp.Set(float64(loadedAt.Unix()))
+
+	s.logger.Info("Schemas loaded", zap.Int("count", len(schemas)), zap.Strings("docTypes", docTypes))
+}
+
+// reloadSchemas re-reads the schema file; the current schemas are kept if the file is invalid.
+// Schemas from the ConfigMap replace the file, reloading re-applies them.
+func (s *AWSService) reloadSchemas() error {
+	if data := s.schemaData.Load(); data != nil {
+		return s.setSchemaData(*data)
+	}
+	schemas, err := loadSchemas(s.schemaFile)
+	if err != nil {
+		return err
+	}
+	s.setSchemas(schemas)
+	return nil
+}
+
+// setSchemaData merges a schema file received from the ConfigMap over the embedded
+// schemas and swaps in the set if it validates
+func (s *AWSService) setSchemaData(data []byte) error {
+	schemas, err := loadEmbeddedSchemas()
+	if err != nil {
+		return err
+	}
+	if err := mergeSchemaFile(schemas, data); err != nil {
+		return err
+	}
+	if err := validateSchemas(schemas); err != nil {
+		return err
+	}
+	s.schemaData.Store(&data)
+	s.setSchemas(schemas)
+	return nil
+}
+
+func (s *AWSService) schema(docType string) (DocumentSchema, bool) {
+	schema, ok := s.schemas.Load().schemas[docType]
+	return schema, ok
+}
+
+// resolveDocType returns the docType of the schema docType names, itself or an alias
+func (s *AWSService) resolveDocType(docType string) (string, bool) {
+	set := s.schemas.Load()
+	if _, ok := set.schemas[docType]; ok {
+		return docType, true
+	}
+	canonical, ok := set.aliases[docType]
+	return canonical, ok
+}
+
+func (s *AWSService) schemaStatus() (time.Time, []SchemaStatus) {
+	set := s.schemas.Load()
+
+	status := make([]SchemaStatus, 0, len(set.schemas))
+	for docType, schema := range set.schemas {
+		status = append(status, SchemaStatus{
+			DocType: docType,
+			Type:    schema.Type,
+			Fields:  len(schema.Fields),
+			Aliases: schema.Aliases,
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].DocType < status[j].DocType
+	})
+	return set.loadedAt, status
+}
+
+// docTypes returns the loaded docTypes, sorted, and the alias table
+func (s *AWSService) docTypes() ([]string, map[string]string) {
+	set := s.schemas.Load()
+	docTypes := make([]string, 0, len(set.schemas))
+	for docType := range set.schemas {
+		docTypes = append(docTypes, docType)
+	}
+	sort.Strings(docTypes)
+	return docTypes, set.aliases
+}
+
+// unknownDocType rejects a request for a docType without schema, listing the valid ones
+func (s *Server) unknownDocType(c fiber.Ctx, docType string) error {
+	docTypes, _ := s.awsService.docTypes()
+	return c.Status(fiber.StatusBadRequest).JSON(BaseResponse{
+		Success: false,
+		Message: fmt.Sprintf("Unknown document type %s", docType),
+		Code:    ErrCodeUnknownDocType,
+		Data:    fiber.Map{"docTypes": docTypes},
+	})
+}
+
+// DocTypes godoc
+// @Summary Document types
+// @Description lists the docTypes requests may send, for the frontend's document type selection
+// @Tags Schemas
+// @Produce json
+// @Router /api/v1/doc-types [get]
+// @Success 200 {object} BaseResponse
+func (s *Server) docTypesHandler(c fiber.Ctx) error {
+	docTypes, aliases := s.awsService.docTypes()
+	return c.Status(fiber.StatusOK).JSON(BaseResponse{
+		Success: true,
+		Message: "Document types",
+		Data: fiber.Map{
+			"docTypes": docTypes,
+			"aliases":  aliases,
+		},
+	})
+}
+
+// SchemaStatus godoc
+// @Summary Loaded schemas
+// @Description lists the loaded document types with their field counts
+// @Tags Schemas
+// @Produce json
+// @Router /api/v1/schemas/status [get]
+// @Success 200 {object} BaseResponse
+func (s *Server) schemaStatusHandler(c fiber.Ctx) error {
+	loadedAt, status := s.awsService.schemaStatus()
+	return c.Status(fiber.StatusOK).JSON(BaseResponse{
+		Success: true,
+		Message: "Schemas loaded",
+		Data: fiber.Map{
+			"loadedAt": loadedAt,
+			"docTypes": status,
+		},
+	})
+}
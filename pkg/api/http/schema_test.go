@@ -0,0 +1,88 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract"
+	"go.uber.org/zap"
+)
+
+// readFixture decodes a saved AnalyzeDocument response from testdata
+func readFixture(t testing.TB, path string) textract.AnalyzeDocumentOutput {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output textract.AnalyzeDocumentOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return output
+}
+
+// newTestAWSService returns a service with the embedded schemas and no Textract client
+func newTestAWSService(t testing.TB) *AWSService {
+	t.Helper()
+	schemas, err := loadSchemas("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &AWSService{logger: zap.NewNop(), parserLogger: zap.NewNop()}
+	service.setSchemas(schemas)
+	return service
+}
+
+// TestParseDuringSchemaReload parses while the schemas are reloaded from the file and
+// replaced from the ConfigMap; run with -race
+func TestParseDuringSchemaReload(t *testing.T) {
+	service := newTestAWSService(t)
+	output := readFixture(t, "testdata/papara/eft-receipt.textract.json")
+	schemaData, err := json.Marshal(map[string]DocumentSchema{"papara": service.schemas.Load().schemas["papara"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				info, _, err := service.extractInfo(context.Background(), output.Blocks, "papara", ParseOptions{Mode: ParseModeLenient})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(info) == 0 {
+					t.Error("nothing extracted")
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			if err := service.reloadSchemas(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			if err := service.setSchemaData(schemaData); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mehmetsafabenli/cbomdekont/pkg/fscache"
+)
+
+// secretRefreshInterval bounds how long rotated AWS keys take to be picked up
+const secretRefreshInterval = time.Minute
+
+var (
+	secretWatchersMu sync.Mutex
+	secretWatchers   = make(map[string]*fscache.Watcher)
+)
+
+// SecretFile is a mounted secret whose content is kept current by an fscache watcher
+type SecretFile struct {
+	path    string
+	watcher *fscache.Watcher
+}
+
+// NewSecretFile starts watching the directory of path, sharing one watcher per directory
+func NewSecretFile(path string) (*SecretFile, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	w, err := watchDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	return &SecretFile{path: path, watcher: w}, nil
+}
+
+// watchDir returns the running watcher of dir, starting one on first use
+func watchDir(dir string) (*fscache.Watcher, error) {
+	secretWatchersMu.Lock()
+	defer secretWatchersMu.Unlock()
+
+	w, ok := secretWatchers[dir]
+	if !ok {
+		var err error
+		w, err = fscache.NewWatch(dir)
+		if err != nil {
+			return nil, err
+		}
+		w.Watch()
+		secretWatchers[dir] = w
+	}
+	return w, nil
+}
+
+// Value returns the current secret with surrounding whitespace removed
+func (f *SecretFile) Value() string {
+	if v, ok := f.watcher.Cache.Load(filepath.Base(f.path)); ok {
+		return strings.TrimSpace(v.(string))
+	}
+	return ""
+}
+
+// secretFileCredentials reads AWS keys from mounted secret files on every refresh
+type secretFileCredentials struct {
+	accessKeyID     *SecretFile
+	secretAccessKey *SecretFile
+}
+
+func (p *secretFileCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	accessKeyID := p.accessKeyID.Value()
+	secretAccessKey := p.secretAccessKey.Value()
+	if accessKeyID == "" || secretAccessKey == "" {
+		return aws.Credentials{}, fmt.Errorf("aws secret files %s and %s must not be empty", p.accessKeyID.path, p.secretAccessKey.path)
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Source:          "SecretFiles",
+		CanExpire:       true,
+		Expires:         time.Now().Add(secretRefreshInterval),
+	}, nil
+}
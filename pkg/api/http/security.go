@@ -0,0 +1,81 @@
+package http
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	defaultFrameOptions   = "DENY"
+	defaultReferrerPolicy = "no-referrer"
+	defaultHSTSMaxAge     = 31536000
+	defaultAPICSP         = "default-src 'none'; frame-ancestors 'none'"
+	defaultSwaggerCSP     = "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'"
+	swaggerPathPrefix     = "/swagger"
+	// the admin UI previews the uploaded document from a blob URL
+	defaultAdminUICSP = "default-src 'self'; img-src 'self' blob: data:; frame-ancestors 'none'"
+)
+
+// SecurityHeadersConfig controls the headers set by securityHeaders, empty values use the defaults
+type SecurityHeadersConfig struct {
+	Disabled              bool   `mapstructure:"disabled"`
+	FrameOptions          string `mapstructure:"frame-options"`
+	ReferrerPolicy        string `mapstructure:"referrer-policy"`
+	HSTSMaxAge            int    `mapstructure:"hsts-max-age"`
+	HSTSIncludeSubdomains bool   `mapstructure:"hsts-include-subdomains"`
+	ContentSecurityPolicy string `mapstructure:"content-security-policy"`
+	SwaggerCSP            string `mapstructure:"swagger-content-security-policy"`
+	AdminUICSP            string `mapstructure:"admin-ui-content-security-policy"`
+}
+
+func withDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// securityHeaders returns a middleware adding standard security headers to every response.
+// HSTS is only sent on requests that arrived over TLS, directly or via a proxy.
+func (s *Server) securityHeaders() fiber.Handler {
+	cfg := s.config.SecurityHeaders
+	frameOptions := withDefault(cfg.FrameOptions, defaultFrameOptions)
+	referrerPolicy := withDefault(cfg.ReferrerPolicy, defaultReferrerPolicy)
+	apiCSP := withDefault(cfg.ContentSecurityPolicy, defaultAPICSP)
+	swaggerCSP := withDefault(cfg.SwaggerCSP, defaultSwaggerCSP)
+	adminUICSP := withDefault(cfg.AdminUICSP, defaultAdminUICSP)
+
+	maxAge := cfg.HSTSMaxAge
+	if maxAge == 0 {
+		maxAge = defaultHSTSMaxAge
+	}
+	hsts := "max-age=" + strconv.Itoa(maxAge)
+	if cfg.HSTSIncludeSubdomains {
+		hsts += "; includeSubDomains"
+	}
+
+	return func(c fiber.Ctx) error {
+		if cfg.Disabled {
+			return c.Next()
+		}
+
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		c.Set(fiber.HeaderXFrameOptions, frameOptions)
+		c.Set(fiber.HeaderReferrerPolicy, referrerPolicy)
+		switch {
+		case strings.HasPrefix(c.Path(), swaggerPathPrefix):
+			c.Set(fiber.HeaderContentSecurityPolicy, swaggerCSP)
+		case strings.HasPrefix(c.Path(), adminUIPrefix):
+			c.Set(fiber.HeaderContentSecurityPolicy, adminUICSP)
+		default:
+			c.Set(fiber.HeaderContentSecurityPolicy, apiCSP)
+		}
+		if c.Secure() && maxAge > 0 {
+			c.Set(fiber.HeaderStrictTransportSecurity, hsts)
+		}
+
+		return c.Next()
+	}
+}
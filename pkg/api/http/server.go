@@ -2,15 +2,22 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/adaptor"
 	"github.com/gofiber/fiber/v3/middleware/cors" // Yeni import
+	"github.com/gofiber/fiber/v3/middleware/recover"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
 	"github.com/gomodule/redigo/redis"
 	"github.com/mehmetsafabenli/cbomdekont/pkg/fscache"
+	"github.com/mehmetsafabenli/cbomdekont/pkg/sentry"
+	"github.com/mehmetsafabenli/cbomdekont/pkg/version"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"net"
 	"net/http"
 	"os"
 	"sync/atomic"
@@ -28,18 +35,69 @@ var (
 )
 
 type Config struct {
-	HttpClientTimeout     time.Duration `mapstructure:"http-client-timeout"`
-	HttpServerTimeout     time.Duration `mapstructure:"http-server-timeout"`
-	ServerShutdownTimeout time.Duration `mapstructure:"server-shutdown-timeout"`
-	ConfigPath            string        `mapstructure:"config-path"`
-	PortMetrics           int           `mapstructure:"port-metrics"`
-	Hostname              string        `mapstructure:"hostname"`
-	Host                  string        `mapstructure:"host"`
-	Port                  string        `mapstructure:"port"`
-	H2C                   bool          `mapstructure:"h2c"`
-	Unhealthy             bool          `mapstructure:"unhealthy"`
-	Unready               bool          `mapstructure:"unready"`
-	CacheServer           string        `mapstructure:"cache-server"`
+	HttpClientTimeout     time.Duration              `mapstructure:"http-client-timeout"`
+	TextractTimeouts      TextractTimeoutsConfig     `mapstructure:"textract-timeouts"`
+	HttpServerTimeout     time.Duration              `mapstructure:"http-server-timeout"`
+	ServerShutdownTimeout time.Duration              `mapstructure:"server-shutdown-timeout"`
+	ServerPreStopDelay    time.Duration              `mapstructure:"server-pre-stop-delay"`
+	ReusePort             bool                       `mapstructure:"reuse-port"`
+	ConfigPath            string                     `mapstructure:"config-path"`
+	PortMetrics           int                        `mapstructure:"port-metrics"`
+	PortAdmin             string                     `mapstructure:"port-admin"`
+	AdminHost             string                     `mapstructure:"admin-host"`
+	Hostname              string                     `mapstructure:"hostname"`
+	Host                  string                     `mapstructure:"host"`
+	Port                  string                     `mapstructure:"port"`
+	H2C                   bool                       `mapstructure:"h2c"`
+	Unhealthy             bool                       `mapstructure:"unhealthy"`
+	Unready               bool                       `mapstructure:"unready"`
+	CacheServer           string                     `mapstructure:"cache-server"`
+	CacheDB               int                        `mapstructure:"cache-db"`
+	CacheDialTimeout      time.Duration              `mapstructure:"cache-dial-timeout"`
+	CacheReadTimeout      time.Duration              `mapstructure:"cache-read-timeout"`
+	CacheWriteTimeout     time.Duration              `mapstructure:"cache-write-timeout"`
+	CacheTLSSkipVerify    bool                       `mapstructure:"cache-tls-skip-verify"`
+	CacheSentinelAddrs    []string                   `mapstructure:"cache-sentinel-addrs"`
+	CacheSentinelMaster   string                     `mapstructure:"cache-sentinel-master"`
+	CacheSentinelPassword string                     `mapstructure:"cache-sentinel-password"`
+	CacheBatchSize        int                        `mapstructure:"cache-batch-size"`
+	CacheBatchInterval    time.Duration              `mapstructure:"cache-batch-interval"`
+	PDFPasswords          []string                   `mapstructure:"pdf-passwords"`
+	QpdfPath              string                     `mapstructure:"qpdf-path"`
+	HeifConvertPath       string                     `mapstructure:"heif-convert-path"`
+	ImageMaxDimension     int                        `mapstructure:"image-max-dimension"`
+	UploadDir             string                     `mapstructure:"upload-dir"`
+	UploadExpiry          time.Duration              `mapstructure:"upload-expiry"`
+	UploadMaxSize         int64                      `mapstructure:"upload-max-size"`
+	ResultCacheTTL        time.Duration              `mapstructure:"result-cache-ttl"`
+	ParseMode             string                     `mapstructure:"parse-mode"`
+	MinConfidence         float32                    `mapstructure:"min-confidence"`
+	Verbosity             string                     `mapstructure:"verbosity"`
+	ReadOnly              bool                       `mapstructure:"read-only"`
+	Maintenance           MaintenanceConfig          `mapstructure:"maintenance"`
+	Priorities            map[string]PriorityPool    `mapstructure:"priorities"`
+	Histograms            map[string]HistogramConfig `mapstructure:"histograms"`
+	AccessLog             AccessLogConfig            `mapstructure:"access-log"`
+	Admission             AdmissionConfig            `mapstructure:"admission"`
+	Samples               SamplesConfig              `mapstructure:"samples"`
+	PII                   PIIConfig                  `mapstructure:"pii"`
+	FX                    FXConfig                   `mapstructure:"fx"`
+	Accuracy              AccuracyConfig             `mapstructure:"accuracy"`
+	Notifications         []NotificationRule         `mapstructure:"notifications"`
+	Egress                EgressConfig               `mapstructure:"egress"`
+	WarmUp                WarmUpConfig               `mapstructure:"warm-up"`
+	ConfigMap             ConfigMapConfig            `mapstructure:"configmap"`
+	Signing               SigningConfig              `mapstructure:"signing"`
+	CORS                  CORSConfig                 `mapstructure:"cors"`
+	MTLS                  MTLSConfig                 `mapstructure:"mtls"`
+	AdminToken            string                     `mapstructure:"admin-token"`
+	AdminTokenFile        string                     `mapstructure:"admin-token-file"`
+	SentryDSN             string                     `mapstructure:"sentry-dsn"`
+	SentryEnvironment     string                     `mapstructure:"sentry-environment"`
+	SecurityHeaders       SecurityHeadersConfig      `mapstructure:"security-headers"`
+	BodyLimit             int                        `mapstructure:"body-limit"`
+	HeaderLimit           int                        `mapstructure:"header-limit"`
+	RouteLimits           map[string]RouteLimit      `mapstructure:"route-limits"`
 }
 
 type Server struct {
@@ -47,20 +105,116 @@ type Server struct {
 	logger         *zap.Logger
 	config         *Config
 	pool           *redis.Pool
+	cacheWrites    *cacheBatcher
 	awsService     *AWSService
+	uploads        *uploadStore
+	samples        *sampleStore
+	fx             *fxService
+	accuracy       *accuracyJob
+	notifier       *notifier
+	adminToken     *SecretFile
+	signingKeys    *signingKeys
+	corsOrigins    *corsOrigins
+	readOnly       atomic.Bool
+	slowThreshold  atomic.Int64
+	inFlight       atomic.Int64
+	maintenance    []maintenanceWindow
+	priorities     map[string]*priorityPool
+	stageDurations *prometheus.HistogramVec
+	documentSizes  *prometheus.HistogramVec
+	documentPages  *prometheus.HistogramVec
+	tlsConfig      *tls.Config
+	sentry         *sentry.Client
 	tracer         trace.Tracer
 	tracerProvider *sdktrace.TracerProvider
+
+	// configMapAdminToken is the admin token of the ConfigMap, preferred over adminToken
+	configMapAdminToken atomic.Pointer[string]
 }
 
 func NewServer(config *Config, logger *zap.Logger, aws *AWSService) (*Server, error) {
-	app := fiber.New(fiber.Config{
-		IdleTimeout: 2 * config.HttpServerTimeout,
-	})
+	uploads, err := newUploadStore(config.UploadDir, config.UploadExpiry)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := newSampleStore(config.Samples)
+	if err != nil {
+		return nil, err
+	}
 	srv := &Server{
-		app:        app,
-		logger:     logger,
+		logger:     logger.Named("http"),
 		config:     config,
 		awsService: aws,
+		uploads:    uploads,
+		samples:    samples,
+	}
+	transport, err := config.Egress.transport()
+	if err != nil {
+		return nil, err
+	}
+	srv.fx, err = newFXService(config.FX, transport, func() *redis.Pool { return srv.pool }, srv.logger.Named("fx"))
+	if err != nil {
+		return nil, err
+	}
+	srv.accuracy, err = newAccuracyJob(config.Accuracy, transport, func() map[string]DocumentSchema {
+		return aws.schemas.Load().schemas
+	}, srv.logger.Named("accuracy"))
+	if err != nil {
+		return nil, err
+	}
+	srv.notifier, err = newNotifier(config.Notifications, transport, srv.logger.Named("notifications"))
+	if err != nil {
+		return nil, err
+	}
+	srv.readOnly.Store(config.ReadOnly)
+	srv.slowThreshold.Store(int64(config.AccessLog.SlowThreshold))
+	srv.app = srv.newApp()
+	if config.SentryDSN != "" {
+		srv.sentry, err = sentry.New(config.SentryDSN, config.SentryEnvironment, version.VERSION, transport)
+		if err != nil {
+			return nil, err
+		}
+	}
+	srv.corsOrigins, err = newCORSOrigins(config.CORS, srv.logger.Named("cors"))
+	if err != nil {
+		return nil, err
+	}
+	if config.AdminTokenFile != "" {
+		srv.adminToken, err = NewSecretFile(config.AdminTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("admin token file: %w", err)
+		}
+	}
+	srv.signingKeys, err = newSigningKeys(config.Signing, srv.logger.Named("signing"))
+	if err != nil {
+		return nil, err
+	}
+	if (srv.signingKeys.enabled() || config.Signing.KeysDir != "") && config.CacheServer == "" {
+		return nil, fmt.Errorf("request signing needs cache-server for replay protection")
+	}
+	if err := validateHistograms(config.Histograms); err != nil {
+		return nil, err
+	}
+	if err := validateAccessLog(config.AccessLog); err != nil {
+		return nil, err
+	}
+	if err := config.TextractTimeouts.validate(); err != nil {
+		return nil, err
+	}
+	config.TextractTimeouts = config.TextractTimeouts.withDefaults(config.HttpClientTimeout)
+	srv.priorities, err = newPriorityPools(config.Priorities)
+	if err != nil {
+		return nil, err
+	}
+	srv.maintenance, err = parseMaintenanceWindows(config.Maintenance.Windows)
+	if err != nil {
+		return nil, err
+	}
+	if config.MTLS.Enabled {
+		srv.tlsConfig, err = mtlsConfig(config.MTLS)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return srv, nil
 }
@@ -69,8 +223,8 @@ func (s *Server) ListenAndServe() (*fiber.App, *int32, *int32) {
 	ctx := context.Background()
 
 	go s.startMetricsServer()
-	s.registerMiddlewares()
 	s.initTracer(ctx)
+	s.registerMiddlewares()
 	s.registerHandlers()
 
 	// load configs in memory and start watching for changes in the config dir
@@ -88,9 +242,25 @@ func (s *Server) ListenAndServe() (*fiber.App, *int32, *int32) {
 	ticker := time.NewTicker(30 * time.Second)
 	s.startCachePool(ticker)
 
+	// purge abandoned resumable uploads
+	s.startUploadJanitor()
+	s.startSampleJanitor()
+	s.startAccuracyJob()
+	s.logHooks()
+
+	// take the schemas and keys of the ConfigMap before taking traffic
+	s.startConfigMapWatcher(ctx)
+
+	// the admin routes share the histograms, pools and stores set up above, so the admin
+	// listener starts with the main one
+	go s.startAdminServer()
+
 	// create the http server
 	srv := s.startServer()
 
+	// open the AWS and redis connections before taking traffic
+	s.warmUp(ctx)
+
 	// signal Kubernetes the server is ready to receive traffic
 	if !s.config.Unhealthy {
 		atomic.StoreInt32(&healthy, 1)
@@ -98,6 +268,7 @@ func (s *Server) ListenAndServe() (*fiber.App, *int32, *int32) {
 	if !s.config.Unready {
 		atomic.StoreInt32(&ready, 1)
 	}
+	s.startMaintenanceWatcher()
 
 	return srv, &healthy, &ready
 }
@@ -109,17 +280,44 @@ func (s *Server) startServer() *fiber.App {
 		return nil
 	}
 
+	// mTLS without a dedicated port applies to the main listener
+	if s.tlsConfig != nil && s.config.MTLS.Port == "" {
+		s.serveMTLS(s.config.Port)
+		return s.app
+	}
+
+	ln, err := s.listen(fiber.NetworkTCP4, fmt.Sprintf(":%s", s.config.Port))
+	if err != nil {
+		s.logger.Fatal("HTTP listener failed", zap.Error(err))
+	}
+
 	// start the server in the background
 	go func() {
-		if err := s.app.Listen(fmt.Sprintf(":%s", s.config.Port)); err != nil {
+		if err := s.app.Listener(ln); err != nil {
 			s.logger.Fatal("HTTP server crashed", zap.Error(err))
 		}
 	}()
 
+	if s.tlsConfig != nil {
+		s.serveMTLS(s.config.MTLS.Port)
+	}
+
 	// return the server and routine
 	return s.app
 }
 
+// listen opens the listener of addr. With reuse-port set the port can be bound by
+// several processes at once: on hosts without a load balancer a new process is started
+// next to the old one and, once ready, the old one is sent SIGTERM and drains its
+// requests while the new one accepts the connections.
+func (s *Server) listen(network, addr string) (net.Listener, error) {
+	var lc net.ListenConfig
+	if s.config.ReusePort {
+		lc.Control = reusePort
+	}
+	return lc.Listen(context.Background(), network, addr)
+}
+
 func (s *Server) registerHandlers() {
 	// Root path handler
 	s.app.Get("/", func(c fiber.Ctx) error {
@@ -131,21 +329,75 @@ func (s *Server) registerHandlers() {
 	v1.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 	//s.app.Get("/debug/pprof/", pprof.New())
 	v1.Get("/healthz", s.healthzHandler)
+	v1.Get("/readyz", adaptor.HTTPHandlerFunc(s.readyzHandler))
+	v1.Get("/version", s.versionHandler)
+	v1.Get("/openapi.yaml", s.openAPIHandler)
+
+	v1.Post("/test", s.testTextractorHandler, s.writable, s.maintenanceGate, s.requestSigning, s.attribution, s.admission)
+	v1.Get("/schemas/status", s.schemaStatusHandler)
+	v1.Get("/doc-types", s.docTypesHandler)
+
+	// resumable uploads (tus 1.0.0 core with creation, expiration and termination)
+	v1.Options("/uploads", s.uploadOptionsHandler)
+	v1.Post("/uploads", s.createUploadHandler, s.writable, s.requestSigning)
+	v1.Head("/uploads/:id", s.headUploadHandler, s.requestSigning)
+	v1.Patch("/uploads/:id", s.patchUploadHandler, s.writable, s.requestSigning)
+	v1.Delete("/uploads/:id", s.deleteUploadHandler, s.writable, s.requestSigning)
+	v1.Post("/uploads/:id/analyze", s.finalizeUploadHandler, s.writable, s.maintenanceGate, s.requestSigning, s.attribution, s.admission)
+
+	// with port-admin the admin API moves to its own listener
+	if s.config.PortAdmin == "" {
+		s.registerAdminHandlers(s.app)
+	}
+}
 
-	v1.Post("/test", s.testTextractorHandler)
+// newApp returns a fiber app with the body limits and streaming of the main listener,
+// the admin listener serves the same analyze endpoint
+func (s *Server) newApp() *fiber.App {
+	bodyLimit, headerLimit := s.maxRequestLimits()
+	return fiber.New(fiber.Config{
+		IdleTimeout:       2 * s.config.HttpServerTimeout,
+		ErrorHandler:      s.errorHandler,
+		BodyLimit:         bodyLimit,
+		ReadBufferSize:    headerLimit,
+		StreamRequestBody: true,
+	})
+}
+
+// useBaseMiddlewares adds the middlewares every listener runs, in front of the routes
+func (s *Server) useBaseMiddlewares(app *fiber.App) {
+	app.Use(requestid.New())
+	app.Use(s.requestLogging)
+	if s.tracerProvider != nil {
+		app.Use(s.tracing)
+	}
+	if s.config.AccessLog.Enabled {
+		app.Use(s.accessLog)
+	}
+	app.Use(recover.New(recover.Config{
+		EnableStackTrace:  true,
+		StackTraceHandler: s.handlePanic,
+	}))
+	app.Use(s.securityHeaders())
+	app.Use(s.requestLimits())
 }
 
 func (s *Server) registerMiddlewares() {
+	s.useBaseMiddlewares(s.app)
+
 	s.app.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://57.129.41.91:9091", "https://backend.pixelpickle.net", "https://pixelpickle.net", "http://localhost:5173"},
+		AllowOriginsFunc: s.corsOrigins.allow,
 		AllowMethods:     []string{"GET", "POST", "HEAD", "PUT", "DELETE", "PATCH", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", HeaderSignatureKeyID, HeaderSignatureTimestamp, HeaderSignatureNonce, HeaderContentSHA256, HeaderSignature, HeaderPriority, HeaderChannel, "traceparent", "tracestate"},
+		ExposeHeaders:    []string{"X-Request-ID", HeaderTraceID, "traceparent", "Location", "Tus-Resumable", "Upload-Offset", "Upload-Length", "Upload-Expires"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
-	prom := NewPrometheusMiddleware()
+	prom := NewPrometheusMiddleware(s.histogramOpts)
 	s.app.Use(prom.Handler)
+	s.stageDurations = s.newStageDurationHistogram()
+	s.documentSizes, s.documentPages = s.newDocumentHistograms()
 	//otel := NewOpenTelemetryMiddleware()
 	//s.app.Use(otel)
 	//httpLogger := NewLoggingMiddleware(s.logger)
@@ -153,6 +405,18 @@ func (s *Server) registerMiddlewares() {
 	//s.app.Use(versionMiddleware)
 }
 
+// FlushErrorReports sends pending error reports, used during shutdown
+func (s *Server) FlushErrorReports(timeout time.Duration) {
+	s.sentry.Flush(timeout)
+}
+
+// FlushCacheWrites sends the batched cache writes, used during shutdown
+func (s *Server) FlushCacheWrites(timeout time.Duration) {
+	if s.cacheWrites != nil {
+		s.cacheWrites.close(timeout)
+	}
+}
+
 func (s *Server) startMetricsServer() {
 	if s.config.PortMetrics > 0 {
 		mux := http.DefaultServeMux
@@ -170,7 +434,11 @@ func (s *Server) startMetricsServer() {
 			Handler: mux,
 		}
 
-		err := srv.ListenAndServe()
+		ln, err := s.listen("tcp", srv.Addr)
+		if err != nil {
+			return
+		}
+		err = srv.Serve(ln)
 		if err != nil {
 			return
 		}
@@ -179,7 +447,9 @@ func (s *Server) startMetricsServer() {
 
 // BaseResponse, tüm API yanıtları için temel yapıyı tanımlar
 type BaseResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Success   bool        `json:"success"`
+	Message   string      `json:"message"`
+	Code      string      `json:"code,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
 }
@@ -0,0 +1,237 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mehmetsafabenli/cbomdekont/pkg/fscache"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderSignatureKeyID     = "X-Signature-Key-Id"
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+	HeaderSignatureNonce     = "X-Signature-Nonce"
+	HeaderContentSHA256      = "X-Content-SHA256"
+	HeaderSignature          = "X-Signature"
+
+	defaultSigningWindow = 5 * time.Minute
+	signingNoncePrefix   = "nonce:"
+)
+
+// SigningConfig enables HMAC-SHA256 request signing for service callers. A request is
+// signed over "METHOD\nPATH?QUERY\nTIMESTAMP\nNONCE\nHEX(SHA256(BODY))" with the secret
+// of its key id. Key ids are case-insensitive.
+type SigningConfig struct {
+	// Required rejects unsigned requests on the document routes; otherwise only
+	// requests carrying a signature are verified
+	Required bool              `mapstructure:"required"`
+	Keys     map[string]string `mapstructure:"keys"`
+	KeyFiles map[string]string `mapstructure:"key-files"`
+	// KeysDir holds one file per key, named by its key id, e.g. a mounted Secret; added,
+	// rotated and removed keys apply without a restart
+	KeysDir string `mapstructure:"keys-dir"`
+	// Window is how far the timestamp may be from now; nonces are kept for twice as long
+	Window time.Duration `mapstructure:"window"`
+}
+
+// signingKeys resolves the key secrets, preferring keys from the ConfigMap, then the keys
+// directory, then mounted files, then inline keys
+type signingKeys struct {
+	keys  map[string]string
+	files map[string]*SecretFile
+	// pushed are the keys of the ConfigMap, replaced as a whole on every change
+	pushed atomic.Pointer[map[string]string]
+	// dir are the keys of the keys directory, replaced as a whole on every reload
+	dir atomic.Pointer[map[string]string]
+}
+
+func newSigningKeys(cfg SigningConfig, logger *zap.Logger) (*signingKeys, error) {
+	keys := &signingKeys{keys: make(map[string]string), files: make(map[string]*SecretFile)}
+	for id, secret := range cfg.Keys {
+		keys.keys[strings.ToLower(id)] = secret
+	}
+	for id, path := range cfg.KeyFiles {
+		file, err := NewSecretFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", id, err)
+		}
+		keys.files[strings.ToLower(id)] = file
+	}
+	if cfg.KeysDir != "" {
+		w, err := watchDir(cfg.KeysDir)
+		if err != nil {
+			return nil, fmt.Errorf("signing keys dir: %w", err)
+		}
+		if _, err := keys.loadDir(w); err != nil {
+			return nil, fmt.Errorf("signing keys dir: %w", err)
+		}
+		watchReloads(w, "signing-keys", logger, func() (bool, error) {
+			return keys.loadDir(w)
+		})
+	}
+	return keys, nil
+}
+
+// loadDir swaps the keys of the keys directory if they changed. An empty key file fails
+// the whole reload, it is likely still being written.
+func (k *signingKeys) loadDir(w *fscache.Watcher) (bool, error) {
+	dir := make(map[string]string)
+	var err error
+	w.Cache.Range(func(name, content any) bool {
+		secret := strings.TrimSpace(content.(string))
+		if secret == "" {
+			err = fmt.Errorf("key %s is empty", name)
+			return false
+		}
+		dir[strings.ToLower(name.(string))] = secret
+		return true
+	})
+	if err != nil {
+		return false, err
+	}
+	if current := k.dir.Load(); current != nil && maps.Equal(*current, dir) {
+		return false, nil
+	}
+	k.dir.Store(&dir)
+	return true, nil
+}
+
+func (k *signingKeys) enabled() bool {
+	if pushed := k.pushed.Load(); pushed != nil && len(*pushed) > 0 {
+		return true
+	}
+	if dir := k.dir.Load(); dir != nil && len(*dir) > 0 {
+		return true
+	}
+	return len(k.keys) > 0 || len(k.files) > 0
+}
+
+func (k *signingKeys) setPushed(keys map[string]string) {
+	k.pushed.Store(&keys)
+}
+
+func (k *signingKeys) secret(id string) string {
+	id = strings.ToLower(id)
+	if pushed := k.pushed.Load(); pushed != nil {
+		if secret, ok := (*pushed)[id]; ok {
+			return secret
+		}
+	}
+	if dir := k.dir.Load(); dir != nil {
+		if secret, ok := (*dir)[id]; ok {
+			return secret
+		}
+	}
+	if file, ok := k.files[id]; ok {
+		return file.Value()
+	}
+	return k.keys[id]
+}
+
+// requestSigning verifies signed requests and, when signing is required, rejects unsigned ones
+func (s *Server) requestSigning(c fiber.Ctx) error {
+	if s.signingKeys == nil || !s.signingKeys.enabled() {
+		return c.Next()
+	}
+	if c.Get(HeaderSignature) == "" {
+		if s.config.Signing.Required {
+			return fiber.NewError(fiber.StatusUnauthorized, "Request signature is required")
+		}
+		return c.Next()
+	}
+
+	// the body hash needs the whole body
+	if err := readBody(c); err != nil {
+		return s.abortedUpload(c, err)
+	}
+
+	if err := s.verifySignature(c); errors.Is(err, errNonceStore) {
+		s.requestLogger(c).Error("Could not check the request nonce", zap.Error(err), zap.String("keyId", c.Get(HeaderSignatureKeyID)))
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Request signature can't be verified right now")
+	} else if err != nil {
+		s.requestLogger(c).Warn("Rejected request signature", zap.Error(err), zap.String("keyId", c.Get(HeaderSignatureKeyID)))
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid request signature")
+	}
+	c.Locals("signingKeyID", c.Get(HeaderSignatureKeyID))
+	return c.Next()
+}
+
+func (s *Server) verifySignature(c fiber.Ctx) error {
+	keyID, nonce := c.Get(HeaderSignatureKeyID), c.Get(HeaderSignatureNonce)
+	secret := s.signingKeys.secret(keyID)
+	if secret == "" {
+		return fmt.Errorf("unknown key id %q", keyID)
+	}
+	if nonce == "" || len(nonce) > 128 {
+		return errors.New("missing or oversized nonce")
+	}
+
+	timestamp, err := strconv.ParseInt(c.Get(HeaderSignatureTimestamp), 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+	window := s.signingWindow()
+	if skew := time.Since(time.Unix(timestamp, 0)); skew > window || skew < -window {
+		return fmt.Errorf("timestamp outside the %s window", window)
+	}
+
+	bodySum := sha256.Sum256(c.Body())
+	bodyHash := hex.EncodeToString(bodySum[:])
+	if !strings.EqualFold(c.Get(HeaderContentSHA256), bodyHash) {
+		return errors.New("body hash mismatch")
+	}
+
+	canonical := strings.Join([]string{c.Method(), c.OriginalURL(), c.Get(HeaderSignatureTimestamp), nonce, bodyHash}, "\n")
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	signature, err := hex.DecodeString(c.Get(HeaderSignature))
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+
+	// only a valid signature may claim a nonce, so forged requests can't burn them
+	return s.claimNonce(keyID, nonce, 2*window)
+}
+
+func (s *Server) signingWindow() time.Duration {
+	if s.config.Signing.Window > 0 {
+		return s.config.Signing.Window
+	}
+	return defaultSigningWindow
+}
+
+var (
+	errNonceReplayed = errors.New("nonce was already used")
+	// errNonceStore is a failure on our side, the request may be retried
+	errNonceStore = errors.New("nonce store")
+)
+
+// claimNonce records the nonce in Redis and fails if it was already used
+func (s *Server) claimNonce(keyID, nonce string, ttl time.Duration) error {
+	if s.pool == nil {
+		return fmt.Errorf("%w: replay protection is unavailable without redis", errNonceStore)
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	key := signingNoncePrefix + strings.ToLower(keyID) + ":" + nonce
+	_, err := redis.String(conn.Do("SET", key, 1, "NX", "EX", int(ttl.Seconds())))
+	switch {
+	case errors.Is(err, redis.ErrNil):
+		return errNonceReplayed
+	case err != nil:
+		return fmt.Errorf("%w: %w", errNonceStore, err)
+	}
+	return nil
+}
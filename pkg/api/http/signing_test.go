@@ -0,0 +1,231 @@
+package http
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// nonceStore is the part of Redis claimNonce uses, SET NX. A non-nil err fails every
+// command the way an unreachable Redis does.
+type nonceStore struct {
+	mu   sync.Mutex
+	keys map[string]bool
+	err  error
+}
+
+type nonceConn struct{ store *nonceStore }
+
+func (c nonceConn) Do(command string, args ...any) (any, error) {
+	switch {
+	case command == "":
+		return nil, nil
+	case command != "SET" || len(args) < 3 || args[2] != "NX":
+		return nil, errors.New("unsupported command " + command)
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	if c.store.err != nil {
+		return nil, c.store.err
+	}
+	key := args[0].(string)
+	if c.store.keys[key] {
+		return nil, nil
+	}
+	c.store.keys[key] = true
+	return "OK", nil
+}
+
+func (nonceConn) Close() error              { return nil }
+func (nonceConn) Err() error                { return nil }
+func (nonceConn) Send(string, ...any) error { return nil }
+func (nonceConn) Flush() error              { return nil }
+func (nonceConn) Receive() (any, error)     { return nil, nil }
+
+const testSigningSecret = "s3cret"
+
+func newSigningTestApp(t *testing.T, required bool) *fiber.App {
+	return newSigningTestAppWithStore(t, required, &nonceStore{keys: make(map[string]bool)})
+}
+
+// newSigningTestAppWithStore claims nonces in store, a nil store runs without Redis
+func newSigningTestAppWithStore(t *testing.T, required bool, store *nonceStore) *fiber.App {
+	t.Helper()
+	s := &Server{
+		logger: zap.NewNop(),
+		config: &Config{Signing: SigningConfig{Required: required, Keys: map[string]string{"Billing": testSigningSecret}}},
+	}
+	if store != nil {
+		s.pool = &redis.Pool{Dial: func() (redis.Conn, error) { return nonceConn{store}, nil }}
+	}
+	var err error
+	if s.signingKeys, err = newSigningKeys(s.config.Signing, s.logger); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Post("/api/v1/analyze", func(c fiber.Ctx) error {
+		keyID, _ := c.Locals("signingKeyID").(string)
+		return c.SendString(keyID)
+	}, s.requestSigning)
+	return app
+}
+
+// signedRequest is a request signed the way clients sign them
+type signedRequest struct {
+	keyID, secret, nonce, query string
+	timestamp                   time.Time
+	body                        []byte
+	// bodyHash overrides the X-Content-SHA256 header
+	bodyHash string
+}
+
+func (r signedRequest) build() *http.Request {
+	sum := sha256.Sum256(r.body)
+	bodyHash := hex.EncodeToString(sum[:])
+	timestamp := strconv.FormatInt(r.timestamp.Unix(), 10)
+	path := "/api/v1/analyze" + r.query
+
+	mac := hmac.New(sha256.New, []byte(r.secret))
+	mac.Write([]byte(strings.Join([]string{http.MethodPost, path, timestamp, r.nonce, bodyHash}, "\n")))
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(r.body))
+	req.Header.Set(HeaderSignatureKeyID, r.keyID)
+	req.Header.Set(HeaderSignatureTimestamp, timestamp)
+	req.Header.Set(HeaderSignatureNonce, r.nonce)
+	req.Header.Set(HeaderContentSHA256, bodyHash)
+	if r.bodyHash != "" {
+		req.Header.Set(HeaderContentSHA256, r.bodyHash)
+	}
+	req.Header.Set(HeaderSignature, hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func validSignedRequest() signedRequest {
+	return signedRequest{
+		keyID: "billing", secret: testSigningSecret, nonce: "n-1", query: "?docType=papara",
+		timestamp: time.Now(), body: []byte("dekont"),
+	}
+}
+
+func TestRequestSigning(t *testing.T) {
+	tests := []struct {
+		name string
+		// sign changes what the client signs, tamper the request after signing
+		sign   func(*signedRequest)
+		tamper func(*http.Request)
+		status int
+	}{
+		{name: "valid", status: fiber.StatusOK},
+		{name: "key id in other case", sign: func(r *signedRequest) { r.keyID = "BILLING" }, status: fiber.StatusOK},
+		{name: "unknown key id", sign: func(r *signedRequest) { r.keyID = "other" }, status: fiber.StatusUnauthorized},
+		{name: "wrong secret", sign: func(r *signedRequest) { r.secret = "other" }, status: fiber.StatusUnauthorized},
+		{name: "missing nonce", sign: func(r *signedRequest) { r.nonce = "" }, status: fiber.StatusUnauthorized},
+		{name: "oversized nonce", sign: func(r *signedRequest) { r.nonce = strings.Repeat("n", 129) }, status: fiber.StatusUnauthorized},
+		{name: "expired timestamp", sign: func(r *signedRequest) { r.timestamp = time.Now().Add(-6 * time.Minute) }, status: fiber.StatusUnauthorized},
+		{name: "future timestamp", sign: func(r *signedRequest) { r.timestamp = time.Now().Add(6 * time.Minute) }, status: fiber.StatusUnauthorized},
+		{name: "body hash mismatch", sign: func(r *signedRequest) { r.bodyHash = strings.Repeat("0", 64) }, status: fiber.StatusUnauthorized},
+		{name: "invalid timestamp", tamper: func(req *http.Request) { req.Header.Set(HeaderSignatureTimestamp, "dün") }, status: fiber.StatusUnauthorized},
+		{name: "signature not hex", tamper: func(req *http.Request) { req.Header.Set(HeaderSignature, "zz") }, status: fiber.StatusUnauthorized},
+		{name: "other query", tamper: func(req *http.Request) { req.RequestURI = "/api/v1/analyze?docType=halkbank" }, status: fiber.StatusUnauthorized},
+		{name: "other body", tamper: func(req *http.Request) { req.Body = io.NopCloser(strings.NewReader("DEKONT")) }, status: fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newSigningTestApp(t, false)
+			r := validSignedRequest()
+			if tt.sign != nil {
+				tt.sign(&r)
+			}
+			req := r.build()
+			if tt.tamper != nil {
+				tt.tamper(req)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestRequestSigningReplay(t *testing.T) {
+	app := newSigningTestApp(t, false)
+	for i, want := range []int{fiber.StatusOK, fiber.StatusUnauthorized} {
+		resp, err := app.Test(validSignedRequest().build())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("request %d: got status %d, want %d", i+1, resp.StatusCode, want)
+		}
+	}
+
+	// the nonce is claimed per key id, and only by a valid signature
+	forged := validSignedRequest()
+	forged.nonce, forged.secret = "n-2", "other"
+	resp, err := app.Test(forged.build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("forged request: got status %d", resp.StatusCode)
+	}
+	valid := validSignedRequest()
+	valid.nonce = "n-2"
+	if resp, err := app.Test(valid.build()); err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Errorf("nonce burned by a forged request: %v, %v", resp, err)
+	}
+}
+
+// TestRequestSigningNonceStore checks that a nonce store failure is not reported as a
+// bad signature, the client can retry it
+func TestRequestSigningNonceStore(t *testing.T) {
+	stores := map[string]*nonceStore{
+		"redis down": {keys: make(map[string]bool), err: errors.New("dial tcp: connection refused")},
+		"no redis":   nil,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			resp, err := newSigningTestAppWithStore(t, false, store).Test(validSignedRequest().build())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusServiceUnavailable {
+				t.Errorf("got status %d, want %d", resp.StatusCode, fiber.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+func TestRequestSigningRequired(t *testing.T) {
+	for _, required := range []bool{false, true} {
+		app := newSigningTestApp(t, required)
+		resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/analyze", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[bool]int{false: fiber.StatusOK, true: fiber.StatusUnauthorized}[required]
+		if resp.StatusCode != want {
+			t.Errorf("required %v: got status %d, want %d", required, resp.StatusCode, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/textract"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+// SimulatorConfig replaces Textract with saved responses, for load tests and capacity
+// planning without AWS calls. It must never be enabled in production.
+type SimulatorConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Fixtures is laid out like the golden fixtures, <docType>/<name>.textract.json; the
+	// fixtures of the requested docType are returned in turn
+	Fixtures string `mapstructure:"fixtures"`
+	// Latency is the mean duration of a call, Jitter the most a call differs from it
+	Latency time.Duration `mapstructure:"latency"`
+	Jitter  time.Duration `mapstructure:"jitter"`
+	// ErrorRate is the fraction of calls failing with a throttling error, 0 to 1
+	ErrorRate float64 `mapstructure:"error-rate"`
+}
+
+type textractSimulator struct {
+	cfg SimulatorConfig
+	// fixtures holds the raw responses, decoded per call so that parses never share
+	// blocks and the decoding cost of real responses is kept
+	fixtures map[string][][]byte
+	next     atomic.Uint64
+}
+
+func newTextractSimulator(cfg SimulatorConfig) (*textractSimulator, error) {
+	if cfg.ErrorRate < 0 || cfg.ErrorRate > 1 {
+		return nil, fmt.Errorf("textract-simulator.error-rate must be between 0 and 1, got %g", cfg.ErrorRate)
+	}
+	if cfg.Jitter > cfg.Latency {
+		return nil, fmt.Errorf("textract-simulator.jitter %s exceeds the latency %s", cfg.Jitter, cfg.Latency)
+	}
+	files, err := filepath.Glob(filepath.Join(cfg.Fixtures, "*", "*"+textractFixtureSuffix))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no fixtures found in %s", cfg.Fixtures)
+	}
+
+	fixtures := make(map[string][][]byte)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("%s: invalid JSON", file)
+		}
+		docType := filepath.Base(filepath.Dir(file))
+		fixtures[docType] = append(fixtures[docType], data)
+	}
+	return &textractSimulator{cfg: cfg, fixtures: fixtures}, nil
+}
+
+// analyze waits for the simulated latency and returns the next fixture of docType
+func (t *textractSimulator) analyze(ctx context.Context, docType string) (*textract.AnalyzeDocumentOutput, error) {
+	latency := t.cfg.Latency
+	if t.cfg.Jitter > 0 {
+		latency += rand.N(2*t.cfg.Jitter) - t.cfg.Jitter
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+
+	if rand.Float64() < t.cfg.ErrorRate {
+		return nil, &types.ThrottlingException{Message: aws.String("simulated throttling")}
+	}
+	fixtures := t.fixtures[docType]
+	if len(fixtures) == 0 {
+		return nil, &types.InvalidParameterException{Message: aws.String("simulator has no fixture for " + docType)}
+	}
+	var output textract.AnalyzeDocumentOutput
+	if err := json.Unmarshal(fixtures[t.next.Add(1)%uint64(len(fixtures))], &output); err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	OutcomeFound         = "found"
+	OutcomeLowConfidence = "low_confidence"
+	OutcomeMissing       = "missing"
+	// OutcomeNotApplicable is an optional field the document does not carry
+	OutcomeNotApplicable = "not_applicable"
+)
+
+var fieldStrategyCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "parser",
+	Name:      "field_strategy_total",
+	Help:      "The number of schema field lookups by strategy and outcome.",
+}, []string{"docType", "field", "strategy", "outcome"})
+
+func init() {
+	prometheus.MustRegister(fieldStrategyCounter)
+}
+
+// observeFieldStrategies counts the outcome of every schema field of a finished parse, to
+// show which strategies actually win for a bank and which schemas can be simplified
+func observeFieldStrategies(docType string, parser *ReceiptParser) {
+	provenance := parser.Provenance()
+	lowConfidence := parser.LowConfidence()
+	for field, strategy := range parser.schema.Fields {
+		outcome := OutcomeMissing
+		if _, ok := provenance[field]; ok {
+			outcome = OutcomeFound
+		} else if _, ok := lowConfidence[field]; ok {
+			outcome = OutcomeLowConfidence
+		} else if strategy.Optional {
+			outcome = OutcomeNotApplicable
+		}
+		fieldStrategyCounter.WithLabelValues(docType, field, strategy.Strategy, outcome).Inc()
+	}
+}
@@ -0,0 +1,234 @@
+package http
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+// maxTableIndex caps the row and column indexes and spans taken from Textract output;
+// the output, not the schema, decides them and tables are sized by them
+const maxTableIndex = 1000
+
+// validTableIndex reports whether a RowIndex or ColumnIndex is set and within 1..maxTableIndex
+func validTableIndex(index *int32) bool {
+	return index != nil && *index >= 1 && *index <= maxTableIndex
+}
+
+// cellPosition is a 1-based row and column index as used by Textract
+type cellPosition struct {
+	row, column int32
+}
+
+// tableCell is a resolved cell. Cells covered by a MERGED_CELL share its text.
+type tableCell struct {
+	text   string
+	block  *types.Block
+	header bool
+	// columnEnd is the last column covered by the cell, so the cell to its right is found
+	// even when the cell spans several columns
+	columnEnd int32
+}
+
+// table is a Textract table with its title and cells indexed by position
+type table struct {
+	title string
+	cells map[cellPosition]*tableCell
+}
+
+// findInTable looks a field up in the tables of the document. With a Column it returns
+// the cell under the header containing Column in the row with a cell containing Key;
+// without one it returns the cell right of the cell containing Key.
+func (p *ReceiptParser) findInTable(strategy FieldStrategy) (string, *types.Block) {
+	for _, t := range p.documentTables() {
+		if strategy.Table != "" && !strings.Contains(t.title, strategy.Table) {
+			p.reject(nil, t.title, "table title does not contain %q", strategy.Table)
+			continue
+		}
+
+		if strategy.Column == "" {
+			for _, pos := range t.positions() {
+				if cell := t.cells[pos]; p.keyIn(cell.text, strategy.Key) {
+					if next, ok := t.cells[cellPosition{pos.row, cell.columnEnd + 1}]; ok && next.text != "" {
+						return next.text, next.block
+					}
+					p.reject(cell.block, cell.text, "the cell right of the key is empty")
+				}
+			}
+			continue
+		}
+
+		column, ok := t.headerColumn(strategy.Column)
+		if !ok {
+			p.reject(nil, t.title, "no header of the table contains %q", strategy.Column)
+			continue
+		}
+		for _, pos := range t.positions() {
+			if cell := t.cells[pos]; cell.header || !p.keyIn(cell.text, strategy.Key) {
+				continue
+			}
+			if target, ok := t.cells[cellPosition{pos.row, column}]; ok && target.text != "" {
+				return target.text, target.block
+			}
+			p.reject(t.cells[pos].block, t.cells[pos].text, "the cell under %q in the key's row is empty", strategy.Column)
+		}
+	}
+	return "", nil
+}
+
+// documentTables builds the table grids from the TABLE blocks, or a single grid from all
+// CELL blocks for output without TABLE blocks
+func (p *ReceiptParser) documentTables() []*table {
+	if p.tables != nil {
+		return p.tables
+	}
+
+	for _, block := range p.blocks {
+		if block.BlockType == types.BlockTypeTable {
+			p.tables = append(p.tables, p.buildTable(block))
+		}
+	}
+	if len(p.tables) == 0 {
+		var cells []string
+		for _, block := range p.blocks {
+			if block.BlockType == types.BlockTypeCell {
+				cells = append(cells, blockID(block))
+			}
+		}
+		p.tables = append(p.tables, p.buildTable(types.Block{
+			Relationships: []types.Relationship{{Type: types.RelationshipTypeChild, Ids: cells}},
+		}))
+	}
+	return p.tables
+}
+
+func (p *ReceiptParser) buildTable(block types.Block) *table {
+	t := &table{cells: make(map[cellPosition]*tableCell)}
+
+	for _, relationship := range block.Relationships {
+		for _, id := range relationship.Ids {
+			child := p.findBlockById(id)
+			if child == nil {
+				continue
+			}
+			switch relationship.Type {
+			case types.RelationshipTypeChild:
+				if child.BlockType == types.BlockTypeCell && validTableIndex(child.RowIndex) && validTableIndex(child.ColumnIndex) {
+					pos := cellPosition{aws.ToInt32(child.RowIndex), aws.ToInt32(child.ColumnIndex)}
+					t.cells[pos] = &tableCell{
+						text:      p.text(*child),
+						block:     child,
+						header:    slices.Contains(child.EntityTypes, types.EntityTypeColumnHeader),
+						columnEnd: pos.column,
+					}
+				}
+			case types.RelationshipTypeTableTitle:
+				t.title = strings.TrimSpace(t.title + " " + p.text(*child))
+			}
+		}
+	}
+
+	// merged cells come after the plain cells so every covered position is known
+	for _, relationship := range block.Relationships {
+		if relationship.Type != types.RelationshipTypeMergedCell {
+			continue
+		}
+		for _, id := range relationship.Ids {
+			if merged := p.findBlockById(id); merged != nil {
+				t.merge(p, merged)
+			}
+		}
+	}
+
+	return t
+}
+
+// merge gives every cell covered by a MERGED_CELL block the text of the merged cell
+func (t *table) merge(p *ReceiptParser, merged *types.Block) {
+	if !validTableIndex(merged.RowIndex) || !validTableIndex(merged.ColumnIndex) {
+		return
+	}
+	row, column := aws.ToInt32(merged.RowIndex), aws.ToInt32(merged.ColumnIndex)
+	// spans past maxTableIndex are cut there
+	rowSpan := min(max(aws.ToInt32(merged.RowSpan), 1), maxTableIndex-row+1)
+	columnSpan := min(max(aws.ToInt32(merged.ColumnSpan), 1), maxTableIndex-column+1)
+
+	// the merged text is the text of its child cells in reading order
+	var texts []string
+	for r := row; r < row+rowSpan; r++ {
+		for c := column; c < column+columnSpan; c++ {
+			if cell, ok := t.cells[cellPosition{r, c}]; ok && cell.text != "" {
+				texts = append(texts, cell.text)
+			}
+		}
+	}
+	text := strings.Join(texts, " ")
+	if merged.Text != nil {
+		text = blockText(*merged)
+	}
+
+	for r := row; r < row+rowSpan; r++ {
+		for c := column; c < column+columnSpan; c++ {
+			t.cells[cellPosition{r, c}] = &tableCell{
+				text:      text,
+				block:     merged,
+				header:    slices.Contains(merged.EntityTypes, types.EntityTypeColumnHeader),
+				columnEnd: column + columnSpan - 1,
+			}
+		}
+	}
+}
+
+// headerColumn finds the column whose header contains text. Tables without
+// COLUMN_HEADER cells use their first row as the header.
+func (t *table) headerColumn(text string) (int32, bool) {
+	hasHeaders := false
+	for _, cell := range t.cells {
+		if cell.header {
+			hasHeaders = true
+			break
+		}
+	}
+
+	best := int32(0)
+	for pos, cell := range t.cells {
+		isHeader := cell.header || (!hasHeaders && pos.row == 1)
+		if isHeader && strings.Contains(cell.text, text) && (best == 0 || pos.column < best) {
+			best = pos.column
+		}
+	}
+	if best == 0 {
+		return 0, false
+	}
+	if !hasHeaders {
+		t.markHeaderRow()
+	}
+	return best, true
+}
+
+// markHeaderRow flags the first row as header so it isn't matched as a data row
+func (t *table) markHeaderRow() {
+	for pos, cell := range t.cells {
+		if pos.row == 1 {
+			cell.header = true
+		}
+	}
+}
+
+// positions returns the cell positions row by row, left to right
+func (t *table) positions() []cellPosition {
+	positions := make([]cellPosition, 0, len(t.cells))
+	for pos := range t.cells {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].row != positions[j].row {
+			return positions[i].row < positions[j].row
+		}
+		return positions[i].column < positions[j].column
+	})
+	return positions
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+func cellBlock(id, text string, row, column int32) types.Block {
+	cell := textBlock(types.BlockTypeCell, id, text)
+	cell.RowIndex, cell.ColumnIndex = aws.Int32(row), aws.Int32(column)
+	return cell
+}
+
+func headerCell(id, text string, column int32) types.Block {
+	cell := cellBlock(id, text, 1, column)
+	cell.EntityTypes = []types.EntityType{types.EntityTypeColumnHeader}
+	return cell
+}
+
+// tableBlocks is a transfer table titled "Dekont Detayı" with marked headers and a
+// total row whose label spans two columns, followed by a fee table without headers
+func tableBlocks() []types.Block {
+	merged := types.Block{
+		BlockType: types.BlockTypeMergedCell, Id: aws.String("m"), Confidence: aws.Float32(95),
+		RowIndex: aws.Int32(4), ColumnIndex: aws.Int32(1), RowSpan: aws.Int32(1), ColumnSpan: aws.Int32(2),
+	}
+	return []types.Block{
+		related(related(related(types.Block{BlockType: types.BlockTypeTable, Id: aws.String("t1")},
+			types.RelationshipTypeChild, "h1", "h2", "h3", "a1", "a2", "a3", "b1", "b2", "b3", "c1", "c2", "c3"),
+			types.RelationshipTypeMergedCell, "m"),
+			types.RelationshipTypeTableTitle, "title"),
+		textBlock(types.BlockTypeTableTitle, "title", "Dekont Detayı"),
+		headerCell("h1", "Açıklama", 1), headerCell("h2", "Adet", 2), headerCell("h3", "Tutar (TL)", 3),
+		cellBlock("a1", "Havale", 2, 1), cellBlock("a2", "1", 2, 2), cellBlock("a3", "100,00", 2, 3),
+		cellBlock("b1", "Masraf", 3, 1), cellBlock("b2", "", 3, 2), cellBlock("b3", "5,00", 3, 3),
+		cellBlock("c1", "Toplam", 4, 1), cellBlock("c2", "", 4, 2), cellBlock("c3", "105,00", 4, 3),
+		merged,
+
+		related(types.Block{BlockType: types.BlockTypeTable, Id: aws.String("t2")},
+			types.RelationshipTypeChild, "d1", "d2", "e1", "e2"),
+		cellBlock("d1", "Kalem", 1, 1), cellBlock("d2", "Ücret", 1, 2),
+		cellBlock("e1", "EFT", 2, 1), cellBlock("e2", "2,50", 2, 2),
+	}
+}
+
+func TestParseTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy FieldStrategy
+		want     string
+	}{
+		{"cell right of the key", FieldStrategy{Key: "Havale"}, "1"},
+		{"empty cell right of the key", FieldStrategy{Key: "Masraf"}, ""},
+		{"right of a merged cell", FieldStrategy{Key: "Toplam"}, "105,00"},
+		{"column", FieldStrategy{Key: "Masraf", Column: "Tutar"}, "5,00"},
+		{"column of a merged row", FieldStrategy{Key: "Toplam", Column: "Tutar"}, "105,00"},
+		{"header is not a data row", FieldStrategy{Key: "Tutar", Column: "Tutar"}, ""},
+		{"unknown column", FieldStrategy{Key: "Havale", Column: "Kur"}, ""},
+		{"table title", FieldStrategy{Key: "Havale", Column: "Tutar", Table: "Dekont"}, "100,00"},
+		{"other table title", FieldStrategy{Key: "Havale", Column: "Tutar", Table: "Fatura"}, ""},
+		{"first row as header", FieldStrategy{Key: "EFT", Column: "Ücret"}, "2,50"},
+		{"first row is not a data row", FieldStrategy{Key: "Kalem", Column: "Ücret"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.strategy.Strategy = StrategyTable
+			value, _ := parseField(t, tableBlocks(), tt.strategy, ParseOptions{Mode: ParseModeStrict})
+			if value != tt.want {
+				t.Errorf("got %q, want %q", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergedCellText(t *testing.T) {
+	parser := NewReceiptParser(tableBlocks(), DocumentSchema{}, ParseOptions{})
+	tables := parser.documentTables()
+	if len(tables) != 2 || tables[0].title != "Dekont Detayı" {
+		t.Fatalf("got %d tables, first titled %q", len(tables), tables[0].title)
+	}
+	for _, pos := range []cellPosition{{4, 1}, {4, 2}} {
+		if cell := tables[0].cells[pos]; cell.text != "Toplam" || blockID(*cell.block) != "m" || cell.columnEnd != 2 {
+			t.Errorf("cell %v: got %q from %s ending at column %d", pos, cell.text, blockID(*cell.block), cell.columnEnd)
+		}
+	}
+}
+
+func TestLooseCells(t *testing.T) {
+	// output without TABLE blocks is read as one table of all cells
+	blocks := []types.Block{cellBlock("a1", "Havale", 1, 1), cellBlock("a2", "100,00", 1, 2)}
+	value, _ := parseField(t, blocks, FieldStrategy{Key: "Havale", Strategy: StrategyTable}, ParseOptions{Mode: ParseModeStrict})
+	if value != "100,00" {
+		t.Errorf("got %q", value)
+	}
+}
+
+func TestMergedCellSpanCapped(t *testing.T) {
+	merged := types.Block{
+		BlockType: types.BlockTypeMergedCell, Id: aws.String("m"),
+		RowIndex: aws.Int32(maxTableIndex - 1), ColumnIndex: aws.Int32(1), RowSpan: aws.Int32(maxTableIndex), ColumnSpan: aws.Int32(2),
+	}
+	table := &table{cells: make(map[cellPosition]*tableCell)}
+	table.merge(NewReceiptParser(nil, DocumentSchema{}, ParseOptions{}), &merged)
+	if len(table.cells) != 4 {
+		t.Errorf("got %d cells, want the span cut at row %d", len(table.cells), maxTableIndex)
+	}
+}
@@ -0,0 +1,200 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+const (
+	// StrategyTaxBreakdown marks the provenance of the VAT fields; it is not a search strategy
+	StrategyTaxBreakdown = "taxBreakdown"
+
+	// FieldVATAmount and FieldVATRate are the fields a tax breakdown adds to the result
+	FieldVATAmount = "kdvTutari"
+	FieldVATRate   = "kdvOrani"
+)
+
+// TaxLine is the VAT of one rate
+type TaxLine struct {
+	// Rate is the percentage, e.g. 20
+	Rate   float64 `json:"rate"`
+	Amount float64 `json:"amount"`
+	// Base is the taxable amount the VAT was calculated on, Amount / Rate * 100
+	Base float64 `json:"base,omitempty"`
+}
+
+// TaxBreakdown is the VAT of an invoice per rate
+type TaxBreakdown struct {
+	Lines []TaxLine `json:"lines"`
+	// Total is the sum of the lines, or the total VAT line of invoices that print no
+	// rates
+	Total float64 `json:"total"`
+}
+
+var (
+	vatKeyPattern  = regexp.MustCompile(`(?i)\bK\.?D\.?V\b`)
+	vatRatePattern = regexp.MustCompile(`%\s*(\d{1,2}(?:[.,]\d+)?)|(\d{1,2}(?:[.,]\d+)?)\s*%`)
+	// amounts carry decimals, which tells them apart from rates and table indexes
+	vatAmountPattern = regexp.MustCompile(`\d{1,3}(?:[.,]\d{3})*[.,]\d{2}\b`)
+	// KDV dahil/hariç totals, matrah and tevkifat lines name the VAT without being one
+	vatExcludedWords = []string{"dahil", "hariç", "matrah", "tevkifat", "muaf", "istisna"}
+)
+
+// isVATLine reports whether line names a VAT amount, and whether it is the total
+func isVATLine(line string) (vat, total bool) {
+	if !vatKeyPattern.MatchString(line) {
+		return false, false
+	}
+	lower := strings.ToLowerSpecial(unicode.TurkishCase, line)
+	for _, word := range vatExcludedWords {
+		if strings.Contains(lower, word) {
+			return false, false
+		}
+	}
+	return true, strings.Contains(lower, "toplam")
+}
+
+// lastAmount returns the last amount in text
+func lastAmount(text string) (float64, bool) {
+	matches := vatAmountPattern.FindAllString(text, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	return parseNumber(matches[len(matches)-1])
+}
+
+// amountOnly returns the amount of a line holding nothing else
+func amountOnly(text string) (float64, bool) {
+	text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "TL"))
+	if text == "" || vatAmountPattern.FindString(text) != text {
+		return 0, false
+	}
+	return parseNumber(text)
+}
+
+// parseTaxBreakdown reads the VAT lines of an invoice, e.g. "KDV (%20) : 200,00" or
+// "Hesaplanan KDV %10 50,00 TL". An amount printed on the line below its label, as in
+// two column layouts, is used too. Each rate is counted once, since invoices often
+// repeat the summary on every page.
+func (p *ReceiptParser) parseTaxBreakdown(extractedInfo ExtractedInfo) {
+	type vatLine struct {
+		text  string
+		block *types.Block
+	}
+	var lines []vatLine
+	for i, block := range p.blocks {
+		if block.BlockType == types.BlockTypeLine && block.Text != nil {
+			lines = append(lines, vatLine{text: blockText(block), block: &p.blocks[i]})
+		}
+	}
+
+	breakdown := &TaxBreakdown{}
+	var sources []*types.Block
+	var totalLine *vatLine
+	var total float64
+	seen := make(map[float64]bool)
+	for i, line := range lines {
+		vat, isTotal := isVATLine(line.text)
+		if !vat {
+			continue
+		}
+		text := line.text
+		rate, hasRate := 0.0, false
+		if m := vatRatePattern.FindStringSubmatchIndex(text); m != nil {
+			group := m[2:4]
+			if group[0] < 0 {
+				group = m[4:6]
+			}
+			rate, hasRate = parseNumber(text[group[0]:group[1]])
+			text = text[m[1]:]
+		}
+		amount, ok := lastAmount(text)
+		if !ok && i+1 < len(lines) {
+			amount, ok = amountOnly(lines[i+1].text)
+		}
+		if !ok {
+			continue
+		}
+
+		switch {
+		case hasRate && !isTotal:
+			if seen[rate] {
+				continue
+			}
+			seen[rate] = true
+			taxLine := TaxLine{Rate: rate, Amount: amount}
+			if rate > 0 {
+				taxLine.Base = math.Round(amount/rate*100*100) / 100
+			}
+			breakdown.Lines = append(breakdown.Lines, taxLine)
+			sources = append(sources, line.block)
+			p.tracef("VAT line: %%%g %.2f", rate, amount)
+		case totalLine == nil:
+			totalLine = &lines[i]
+			total = amount
+			p.tracef("VAT total line: %.2f", amount)
+		}
+	}
+
+	switch {
+	case len(breakdown.Lines) > 0:
+		sort.Slice(breakdown.Lines, func(i, j int) bool { return breakdown.Lines[i].Rate < breakdown.Lines[j].Rate })
+		for _, line := range breakdown.Lines {
+			breakdown.Total += line.Amount
+		}
+		breakdown.Total = math.Round(breakdown.Total*100) / 100
+		if totalLine != nil && math.Abs(total-breakdown.Total) >= 0.01 {
+			p.warn(WarnVATTotalMismatch, FieldVATAmount, "VAT lines add up to %.2f but the total VAT line reads %.2f", breakdown.Total, total)
+		}
+	case totalLine != nil:
+		breakdown.Total = total
+		sources = append(sources, totalLine.block)
+	default:
+		p.tracef("No VAT lines found")
+		return
+	}
+	p.taxBreakdown = breakdown
+
+	source := sources[0]
+	confidence := blockConfidence(*source)
+	for _, block := range sources[1:] {
+		confidence = min(confidence, blockConfidence(*block))
+	}
+	provenance := provenanceOf(FieldStrategy{Strategy: StrategyTaxBreakdown, Key: "KDV"}, source)
+	provenance.Confidence = confidence
+
+	extractedInfo[FieldVATAmount] = strconv.FormatFloat(breakdown.Total, 'f', 2, 64)
+	p.provenance[FieldVATAmount] = provenance
+	if len(breakdown.Lines) > 0 {
+		rates := make([]string, len(breakdown.Lines))
+		for i, line := range breakdown.Lines {
+			rates[i] = strconv.FormatFloat(line.Rate, 'f', -1, 64)
+		}
+		extractedInfo[FieldVATRate] = strings.Join(rates, ", ")
+		p.provenance[FieldVATRate] = provenance
+	}
+}
+
+// validateTaxBreakdown checks that the fields a tax breakdown adds are not declared by
+// the schema itself
+func validateTaxBreakdown(docType string, schema DocumentSchema) []string {
+	if !schema.TaxBreakdown {
+		return nil
+	}
+	var problems []string
+	for _, field := range []string{FieldVATAmount, FieldVATRate} {
+		_, extracted := schema.Fields[field]
+		_, computed := schema.Computed[field]
+		if extracted || computed {
+			problems = append(problems, fmt.Sprintf("%s.%s: field is set by the tax breakdown", docType, field))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,69 @@
+package http
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultTextractSyncTimeout bounds AnalyzeDocument when neither textract-timeouts.sync
+// nor http-client-timeout is set
+const defaultTextractSyncTimeout = 30 * time.Second
+
+var textractTimeoutsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "textract",
+	Name:      "timeouts_total",
+	Help:      "The number of Textract calls cancelled by their timeout by docType.",
+}, []string{"docType"})
+
+func init() {
+	prometheus.MustRegister(textractTimeoutsCounter)
+}
+
+// TextractTimeouts bound the Textract calls of a document, retries included
+type TextractTimeouts struct {
+	// Sync bounds a synchronous AnalyzeDocument call
+	Sync time.Duration `mapstructure:"sync"`
+}
+
+// TextractTimeoutsConfig sets the Textract timeouts; DocTypes overrides them per docType,
+// a zero value keeps the general one
+type TextractTimeoutsConfig struct {
+	Sync     time.Duration               `mapstructure:"sync"`
+	DocTypes map[string]TextractTimeouts `mapstructure:"doc-types"`
+}
+
+// withDefaults falls back to http-client-timeout, so configs setting only it keep their
+// Textract timeout
+func (c TextractTimeoutsConfig) withDefaults(httpClientTimeout time.Duration) TextractTimeoutsConfig {
+	if c.Sync == 0 {
+		c.Sync = httpClientTimeout
+	}
+	if c.Sync == 0 {
+		c.Sync = defaultTextractSyncTimeout
+	}
+	return c
+}
+
+func (c TextractTimeoutsConfig) validate() error {
+	if c.Sync < 0 {
+		return fmt.Errorf("textract-timeouts.sync must not be negative")
+	}
+	for docType, timeouts := range c.DocTypes {
+		if timeouts.Sync < 0 {
+			return fmt.Errorf("textract-timeouts.doc-types.%s.sync must not be negative", docType)
+		}
+	}
+	return nil
+}
+
+// forDocType returns the timeouts of docType; aliases are resolved before, overrides are
+// keyed by the schema name
+func (c TextractTimeoutsConfig) forDocType(docType string) TextractTimeouts {
+	timeouts := TextractTimeouts{Sync: c.Sync}
+	if override := c.DocTypes[docType]; override.Sync > 0 {
+		timeouts.Sync = override.Sync
+	}
+	return timeouts
+}
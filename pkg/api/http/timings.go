@@ -0,0 +1,65 @@
+package http
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	StageUploadRead = "uploadRead"
+	StagePreprocess = "preprocess"
+	StageQueue      = "queue"
+	StageTextract   = "textract"
+	StageParse      = "parse"
+	StagePersist    = "persist"
+	StageTotal      = "total"
+)
+
+// newStageDurationHistogram registers the per-stage histogram, buckets come from
+// histograms.pipeline_stage_duration_seconds
+func (s *Server) newStageDurationHistogram() *prometheus.HistogramVec {
+	histogram := prometheus.NewHistogramVec(s.histogramOpts(prometheus.HistogramOpts{
+		Subsystem: "pipeline",
+		Name:      "stage_duration_seconds",
+		Help:      "The time spent in each stage of the document pipeline in seconds.",
+	}), []string{"stage"})
+	prometheus.MustRegister(histogram)
+	return histogram
+}
+
+// pipelineTimings records how long each stage of a document request took
+type pipelineTimings struct {
+	start     time.Time
+	stages    map[string]time.Duration
+	histogram *prometheus.HistogramVec
+}
+
+func newPipelineTimings(histogram *prometheus.HistogramVec) *pipelineTimings {
+	return &pipelineTimings{start: time.Now(), stages: make(map[string]time.Duration), histogram: histogram}
+}
+
+// track records the time since begin for stage; use it as defer t.track(stage, time.Now())
+// or call it right after the stage finished
+func (t *pipelineTimings) track(stage string, begin time.Time) {
+	elapsed := time.Since(begin)
+	t.stages[stage] += elapsed
+	t.histogram.WithLabelValues(stage).Observe(elapsed.Seconds())
+}
+
+// report returns the stage durations in milliseconds, including the total so far
+func (t *pipelineTimings) report() map[string]float64 {
+	total := time.Since(t.start)
+	t.histogram.WithLabelValues(StageTotal).Observe(total.Seconds())
+
+	report := make(map[string]float64, len(t.stages)+1)
+	for stage, elapsed := range t.stages {
+		report[stage] = milliseconds(elapsed)
+	}
+	report[StageTotal] = milliseconds(total)
+	return report
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
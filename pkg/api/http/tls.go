@@ -0,0 +1,113 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+)
+
+// MTLSConfig requires client certificates signed by ClientCAFile. Without Port the main
+// listener is served over mTLS; with Port it stays plain HTTP and a dedicated internal
+// listener is started on Port serving the same routes.
+type MTLSConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	Port         string `mapstructure:"port"`
+	CertFile     string `mapstructure:"cert-file"`
+	KeyFile      string `mapstructure:"key-file"`
+	ClientCAFile string `mapstructure:"client-ca-file"`
+	// AllowedSubjects limits accepted clients by certificate common name or DNS/URI SAN;
+	// empty accepts every certificate the CA bundle verifies
+	AllowedSubjects []string `mapstructure:"allowed-subjects"`
+}
+
+// mtlsConfig builds the server side tls.Config for MTLSConfig
+func mtlsConfig(cfg MTLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" || cfg.ClientCAFile == "" {
+		return nil, errors.New("mtls requires cert-file, key-file and client-ca-file")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("mtls server certificate: %w", err)
+	}
+	bundle, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("mtls client ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("mtls client ca: no certificates in %s", cfg.ClientCAFile)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	if len(cfg.AllowedSubjects) > 0 {
+		allowed := make(map[string]bool, len(cfg.AllowedSubjects))
+		for _, subject := range cfg.AllowedSubjects {
+			allowed[strings.ToLower(subject)] = true
+		}
+		// runs after chain verification, so the leaf is known to be signed by the bundle
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("client certificate required")
+			}
+			leaf := state.PeerCertificates[0]
+			for _, subject := range certificateSubjects(leaf) {
+				if allowed[strings.ToLower(subject)] {
+					return nil
+				}
+			}
+			return fmt.Errorf("client certificate %q is not allowed", leaf.Subject.CommonName)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// certificateSubjects lists the names a client certificate can be allowed by
+func certificateSubjects(cert *x509.Certificate) []string {
+	subjects := []string{cert.Subject.CommonName}
+	subjects = append(subjects, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+	return subjects
+}
+
+// mtlsListener opens the listener requests are served from with client certificates
+// required; port is the main port or the dedicated internal one
+func (s *Server) mtlsListener(port string) (net.Listener, error) {
+	ln, err := s.listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("Client certificates required",
+		zap.String("port", port),
+		zap.Strings("allowedSubjects", s.config.MTLS.AllowedSubjects),
+	)
+	return tls.NewListener(ln, s.tlsConfig), nil
+}
+
+// serveMTLS serves the app in the background from an mTLS listener on port
+func (s *Server) serveMTLS(port string) {
+	ln, err := s.mtlsListener(port)
+	if err != nil {
+		s.logger.Fatal("mTLS listener failed", zap.Error(err))
+	}
+	go func() {
+		// the main listener already printed the startup banner
+		cfg := fiber.ListenConfig{DisableStartupMessage: port != s.config.Port}
+		if err := s.app.Listener(ln, cfg); err != nil {
+			s.logger.Fatal("HTTP server crashed", zap.Error(err))
+		}
+	}()
+}
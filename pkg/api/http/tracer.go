@@ -2,6 +2,9 @@ package http
 
 import (
 	"context"
+	"net/http"
+
+	"github.com/gofiber/fiber/v3"
 	"github.com/mehmetsafabenli/cbomdekont/pkg/version"
 
 	"github.com/spf13/viper"
@@ -10,6 +13,8 @@ import (
 	"go.opentelemetry.io/contrib/propagators/jaeger"
 	"go.opentelemetry.io/contrib/propagators/ot"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
@@ -22,6 +27,9 @@ import (
 
 const (
 	instrumentationName = "github.com/stefanprodan/podinfo/pkg/api"
+
+	// HeaderTraceID carries the trace id of the request in every traced response
+	HeaderTraceID = "X-Trace-ID"
 )
 
 func (s *Server) initTracer(ctx context.Context) {
@@ -62,3 +70,39 @@ func (s *Server) initTracer(ctx context.Context) {
 		trace.WithSchemaURL(semconv.SchemaURL),
 	)
 }
+
+// tracing starts a server span for every request, continuing the caller's trace if it sent
+// one. The trace id is returned as X-Trace-ID and traceparent and added to the request
+// logger, so support can jump from a user-reported request straight to the trace.
+func (s *Server) tracing(c fiber.Ctx) error {
+	carrier := propagation.HeaderCarrier(http.Header(c.GetReqHeaders()))
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), carrier)
+	ctx, span := s.tracer.Start(ctx, c.Method(), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	c.SetUserContext(ctx)
+
+	spanContext := span.SpanContext()
+	traceID := spanContext.TraceID().String()
+	c.Set(HeaderTraceID, traceID)
+	response := propagation.HeaderCarrier(http.Header{})
+	propagation.TraceContext{}.Inject(ctx, response)
+	c.Set("traceparent", response.Get("traceparent"))
+	s.addLogFields(c, zap.String("traceId", traceID), zap.String("spanId", spanContext.SpanID().String()))
+
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = errorStatus(err)
+	}
+	span.SetName(c.Method() + " " + c.Route().Path)
+	span.SetAttributes(
+		attribute.String("http.method", c.Method()),
+		attribute.String("http.route", c.Route().Path),
+		attribute.Int("http.status_code", status),
+	)
+	if status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	return err
+}
@@ -0,0 +1,460 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	TusVersion   = "1.0.0"
+	TusExtension = "creation,expiration,termination"
+
+	defaultUploadExpiry  = 24 * time.Hour
+	defaultUploadMaxSize = 20 << 20
+)
+
+// defaultUploadDir is where uploads are kept without upload-dir
+func defaultUploadDir() string {
+	return filepath.Join(os.TempDir(), "cbomdekont-uploads")
+}
+
+var (
+	errUploadNotFound       = errors.New("upload not found")
+	errUploadOffsetMismatch = errors.New("upload offset mismatch")
+	errUploadTooLarge       = errors.New("upload exceeds declared length")
+	errUploadLocked         = errors.New("upload is being written by another request")
+
+	uploadIDPattern = regexp.MustCompile(`^[a-f0-9]{32}$`)
+)
+
+// UploadInfo is the sidecar metadata persisted next to every partial upload
+type UploadInfo struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Expires  time.Time         `json:"expires"`
+}
+
+// uploadStore keeps partial uploads on local disk until they are finalized or expire.
+// Replicas only see each other's uploads when dir is a shared volume; busy marks are per
+// replica, so concurrent PATCHes of one upload must reach the same replica.
+// mu guards the sidecar files only; a chunk is written outside of it while its upload is
+// marked busy, so a slow client holds up its own upload and no other.
+type uploadStore struct {
+	dir    string
+	expiry time.Duration
+	mu     sync.Mutex
+	busy   map[string]bool
+}
+
+func newUploadStore(dir string, expiry time.Duration) (*uploadStore, error) {
+	if dir == "" {
+		dir = defaultUploadDir()
+	}
+	if expiry <= 0 {
+		expiry = defaultUploadExpiry
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &uploadStore{dir: dir, expiry: expiry, busy: make(map[string]bool)}, nil
+}
+
+func (u *uploadStore) dataPath(id string) string {
+	return filepath.Join(u.dir, id+".bin")
+}
+
+func (u *uploadStore) infoPath(id string) string {
+	return filepath.Join(u.dir, id+".json")
+}
+
+func (u *uploadStore) create(length int64, metadata map[string]string) (*UploadInfo, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	info := &UploadInfo{
+		ID:       hex.EncodeToString(b),
+		Length:   length,
+		Metadata: metadata,
+		Expires:  time.Now().Add(u.expiry),
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := os.WriteFile(u.dataPath(info.ID), nil, 0600); err != nil {
+		return nil, err
+	}
+	return info, u.writeInfo(info)
+}
+
+func (u *uploadStore) get(id string) (*UploadInfo, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.readInfo(id)
+}
+
+// appendChunk writes a chunk at the given offset and returns the updated upload
+func (u *uploadStore) appendChunk(id string, offset int64, r io.Reader) (*UploadInfo, error) {
+	info, err := u.acquire(id, offset)
+	if err != nil {
+		return info, err
+	}
+	defer u.release(id)
+
+	f, err := os.OpenFile(u.dataPath(id), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// read one byte past the remaining length to detect oversized chunks
+	n, err := io.Copy(f, io.LimitReader(r, info.Length-info.Offset+1))
+	switch {
+	case errors.Is(err, errClientAborted) && info.Offset+n <= info.Length:
+		// keep what arrived so the client can resume from the new offset
+		info.Offset += n
+		if werr := u.lockedWriteInfo(info); werr != nil {
+			return nil, werr
+		}
+		return info, err
+	case err != nil:
+		_ = f.Truncate(info.Offset)
+		return nil, err
+	}
+	if info.Offset+n > info.Length {
+		_ = f.Truncate(info.Offset)
+		return info, errUploadTooLarge
+	}
+
+	info.Offset += n
+	return info, u.lockedWriteInfo(info)
+}
+
+// acquire marks the upload busy for a chunk at offset; call release when the chunk is written
+func (u *uploadStore) acquire(id string, offset int64) (*UploadInfo, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	info, err := u.readInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.busy[id] {
+		return nil, errUploadLocked
+	}
+	if info.Offset != offset {
+		return info, errUploadOffsetMismatch
+	}
+	u.busy[id] = true
+	return info, nil
+}
+
+func (u *uploadStore) release(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.busy, id)
+}
+
+func (u *uploadStore) lockedWriteInfo(info *UploadInfo) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.writeInfo(info)
+}
+
+// read returns the upload data in a pooled buffer; call the returned func when done with
+// it
+func (u *uploadStore) read(id string) ([]byte, func(), error) {
+	u.mu.Lock()
+	f, err := os.Open(u.dataPath(id))
+	u.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	return readPooled(f, stat.Size())
+}
+
+// remove deletes the upload unless a chunk is being written to it
+func (u *uploadStore) remove(id string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.busy[id] {
+		return errUploadLocked
+	}
+	_ = os.Remove(u.dataPath(id))
+	_ = os.Remove(u.infoPath(id))
+	return nil
+}
+
+// purgeExpired deletes uploads past their expiry and returns how many were removed
+func (u *uploadStore) purgeExpired(now time.Time) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(u.dir, "*.json"))
+	if err != nil {
+		return 0
+	}
+
+	purged := 0
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".json")
+		if u.busy[id] {
+			continue
+		}
+		info, err := u.readInfo(id)
+		if err != nil || now.After(info.Expires) {
+			_ = os.Remove(u.dataPath(id))
+			_ = os.Remove(u.infoPath(id))
+			purged++
+		}
+	}
+	return purged
+}
+
+func (u *uploadStore) readInfo(id string) (*UploadInfo, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return nil, errUploadNotFound
+	}
+	b, err := os.ReadFile(u.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var info UploadInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		return nil, err
+	}
+	if time.Now().After(info.Expires) {
+		return nil, errUploadNotFound
+	}
+	return &info, nil
+}
+
+func (u *uploadStore) writeInfo(info *UploadInfo) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(u.infoPath(info.ID), b, 0600)
+}
+
+// parseUploadMetadata decodes the tus Upload-Metadata header ("key base64value,key2 base64value2")
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if header == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid metadata value for %s", parts[0])
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("invalid metadata pair %q", pair)
+		}
+	}
+	return metadata, nil
+}
+
+func (s *Server) startUploadJanitor() {
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if purged := s.uploads.purgeExpired(time.Now()); purged > 0 {
+				s.logger.Info("purged expired uploads", zap.Int("count", purged))
+			}
+		}
+	}()
+}
+
+func (s *Server) uploadMaxSize() int64 {
+	if s.config.UploadMaxSize > 0 {
+		return s.config.UploadMaxSize
+	}
+	return defaultUploadMaxSize
+}
+
+func (s *Server) uploadOptionsHandler(c fiber.Ctx) error {
+	c.Set("Tus-Resumable", TusVersion)
+	c.Set("Tus-Version", TusVersion)
+	c.Set("Tus-Extension", TusExtension)
+	c.Set("Tus-Max-Size", strconv.FormatInt(s.uploadMaxSize(), 10))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) createUploadHandler(c fiber.Ctx) error {
+	c.Set("Tus-Resumable", TusVersion)
+
+	length, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Upload-Length header is required")
+	}
+	if length > s.uploadMaxSize() {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Upload exceeds maximum size")
+	}
+
+	metadata, err := parseUploadMetadata(c.Get("Upload-Metadata"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	info, err := s.uploads.create(length, metadata)
+	if err != nil {
+		s.requestLogger(c).Error("Failed to create upload", zap.Error(err))
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create upload")
+	}
+
+	c.Set("Location", fmt.Sprintf("%s/%s", c.Path(), info.ID))
+	c.Set("Upload-Expires", info.Expires.UTC().Format(time.RFC1123))
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+func (s *Server) headUploadHandler(c fiber.Ctx) error {
+	c.Set("Tus-Resumable", TusVersion)
+	c.Set("Cache-Control", "no-store")
+
+	info, err := s.uploads.get(c.Params("id"))
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+
+	c.Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	c.Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	c.Set("Upload-Expires", info.Expires.UTC().Format(time.RFC1123))
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *Server) patchUploadHandler(c fiber.Ctx) error {
+	c.Set("Tus-Resumable", TusVersion)
+
+	if c.Get(fiber.HeaderContentType) != "application/offset+octet-stream" {
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+	}
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Upload-Offset header is required")
+	}
+
+	info, err := s.uploads.appendChunk(c.Params("id"), offset, bodyReader(c))
+	if errors.Is(err, errClientAborted) {
+		return s.abortedUpload(c, err)
+	}
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+
+	c.Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	c.Set("Upload-Expires", info.Expires.UTC().Format(time.RFC1123))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) deleteUploadHandler(c fiber.Ctx) error {
+	c.Set("Tus-Resumable", TusVersion)
+
+	if _, err := s.uploads.get(c.Params("id")); err != nil {
+		return s.uploadError(c, err)
+	}
+	if err := s.uploads.remove(c.Params("id")); err != nil {
+		return s.uploadError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// finalizeUploadHandler runs the analysis on a completed upload. The upload is discarded
+// once the document is settled; errors the client can fix, like a missing PDF password or
+// an unknown docType, and server errors keep it for another try until it expires.
+func (s *Server) finalizeUploadHandler(c fiber.Ctx) error {
+	timings := newPipelineTimings(s.stageDurations)
+	id := c.Params("id")
+	info, err := s.uploads.get(id)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	if info.Offset != info.Length {
+		return fiber.NewError(fiber.StatusConflict, "Upload is not complete")
+	}
+
+	docType := c.FormValue("docType")
+	if docType == "" {
+		docType = info.Metadata["docType"]
+	}
+	if docType == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Document type not provided")
+	}
+
+	fileBytes, release, err := s.uploads.read(id)
+	if err != nil {
+		s.requestLogger(c).Error("Failed to read upload", zap.Error(err))
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to read upload")
+	}
+	defer release()
+	timings.track(StageUploadRead, timings.start)
+
+	err = s.analyzeDocument(c, fileBytes, docType, timings)
+	if documentSettled(c) {
+		// a stray PATCH still writing keeps the upload until the janitor purges it
+		_ = s.uploads.remove(id)
+	}
+	return err
+}
+
+// settleDocument records that the document of the request got its final answer: it was
+// analyzed, served from the cache or can't be read at all. Another try with the same
+// document would end the same way.
+func settleDocument(c fiber.Ctx) {
+	c.Locals("documentSettled", true)
+}
+
+func documentSettled(c fiber.Ctx) bool {
+	settled, _ := c.Locals("documentSettled").(bool)
+	return settled
+}
+
+func (s *Server) uploadError(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errUploadNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Upload not found")
+	case errors.Is(err, errUploadOffsetMismatch):
+		return fiber.NewError(fiber.StatusConflict, "Upload-Offset does not match current offset")
+	case errors.Is(err, errUploadTooLarge):
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Chunk exceeds declared Upload-Length")
+	case errors.Is(err, errUploadLocked):
+		return fiber.NewError(fiber.StatusLocked, "Upload is being written by another request")
+	default:
+		s.requestLogger(c).Error("Upload failed", zap.Error(err))
+		return fiber.NewError(fiber.StatusInternalServerError, "Upload failed")
+	}
+}
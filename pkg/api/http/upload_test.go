@@ -0,0 +1,72 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+func TestFinalizeUploadKeepsRecoverable(t *testing.T) {
+	tests := []struct {
+		name    string
+		docType string
+		mode    string
+		code    string
+		kept    bool
+	}{
+		{name: "unknown docType", docType: "yok", code: ErrCodeUnknownDocType, kept: true},
+		{name: "password required", docType: "papara", code: ErrCodePDFPasswordRequired, kept: true},
+		{name: "unreadable PDF", docType: "papara", mode: "damaged", code: ErrCodePDFUnreadable, kept: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MODE", tt.mode)
+			uploads, err := newUploadStore(t.TempDir(), time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &Server{
+				logger:         zap.NewNop(),
+				config:         &Config{QpdfPath: writeFakeQpdf(t)},
+				awsService:     newTestAWSService(t),
+				uploads:        uploads,
+				stageDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "stage"}, []string{"stage"}),
+				documentSizes:  prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "size"}, []string{"docType"}),
+			}
+			if s.priorities, err = newPriorityPools(nil); err != nil {
+				t.Fatal(err)
+			}
+			app := fiber.New()
+			app.Post("/api/v1/uploads/:id/analyze", s.finalizeUploadHandler)
+
+			document := []byte("%PDF-1.7 /Encrypt")
+			info, err := uploads.create(int64(len(document)), map[string]string{"docType": tt.docType})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := uploads.appendChunk(info.ID, 0, bytes.NewReader(document)); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/uploads/"+info.ID+"/analyze", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body BaseResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code != tt.code {
+				t.Fatalf("got status %d, code %q, want %s", resp.StatusCode, body.Code, tt.code)
+			}
+			if _, err := uploads.get(info.ID); errors.Is(err, errUploadNotFound) == tt.kept {
+				t.Errorf("upload kept %v, want %v", err == nil, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	VaultCredentialTypeSTS   = "sts"
+	VaultCredentialTypeCreds = "creds"
+
+	defaultVaultMount = "aws"
+)
+
+// VaultConfig points at a Vault AWS secrets engine role issuing short-lived credentials
+type VaultConfig struct {
+	Address        string `mapstructure:"address"`
+	Token          string `mapstructure:"token"`
+	TokenFile      string `mapstructure:"token_file"`
+	Mount          string `mapstructure:"mount"`
+	Role           string `mapstructure:"role"`
+	CredentialType string `mapstructure:"credential_type"`
+}
+
+// vaultCredentials fetches AWS credentials from Vault; wrapped in an aws.CredentialsCache
+// they are renewed shortly before the lease expires
+type vaultCredentials struct {
+	cfg       VaultConfig
+	tokenFile *SecretFile
+	client    *http.Client
+}
+
+type vaultSecret struct {
+	LeaseID       string `json:"lease_id"`
+	LeaseDuration int    `json:"lease_duration"`
+	Data          struct {
+		AccessKey     string `json:"access_key"`
+		SecretKey     string `json:"secret_key"`
+		SecurityToken string `json:"security_token"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func newVaultCredentials(cfg VaultConfig, transport http.RoundTripper) (aws.CredentialsProvider, error) {
+	if cfg.Role == "" {
+		return nil, fmt.Errorf("vault role is required")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = defaultVaultMount
+	}
+	if cfg.CredentialType == "" {
+		cfg.CredentialType = VaultCredentialTypeSTS
+	}
+	if cfg.CredentialType != VaultCredentialTypeSTS && cfg.CredentialType != VaultCredentialTypeCreds {
+		return nil, fmt.Errorf("vault credential type must be %s or %s", VaultCredentialTypeSTS, VaultCredentialTypeCreds)
+	}
+
+	provider := &vaultCredentials{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second, Transport: transport},
+	}
+	if cfg.TokenFile != "" {
+		tokenFile, err := NewSecretFile(cfg.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("vault token file: %w", err)
+		}
+		provider.tokenFile = tokenFile
+	}
+
+	return aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = time.Minute
+		o.ExpiryWindowJitterFrac = 0.5
+	}), nil
+}
+
+func (v *vaultCredentials) token() string {
+	switch {
+	case v.tokenFile != nil:
+		return v.tokenFile.Value()
+	case v.cfg.Token != "":
+		return v.cfg.Token
+	default:
+		return os.Getenv("VAULT_TOKEN")
+	}
+}
+
+func (v *vaultCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", strings.TrimSuffix(v.cfg.Address, "/"), v.cfg.Mount, v.cfg.CredentialType, v.cfg.Role)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	req.Header.Set("X-Vault-Token", v.token())
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	var secret vaultSecret
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return aws.Credentials{}, fmt.Errorf("invalid vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return aws.Credentials{}, fmt.Errorf("vault returned %d: %s", resp.StatusCode, strings.Join(secret.Errors, "; "))
+	}
+	if secret.Data.AccessKey == "" || secret.Data.SecretKey == "" {
+		return aws.Credentials{}, fmt.Errorf("vault lease %s has no aws credentials", secret.LeaseID)
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     secret.Data.AccessKey,
+		SecretAccessKey: secret.Data.SecretKey,
+		SessionToken:    secret.Data.SecurityToken,
+		Source:          "Vault",
+		CanExpire:       secret.LeaseDuration > 0,
+		Expires:         time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second),
+	}, nil
+}
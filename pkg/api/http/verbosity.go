@@ -0,0 +1,76 @@
+package http
+
+import (
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	// Verbosity is the form field selecting how much detail a response carries
+	Verbosity = "verbosity"
+
+	// VerbosityMinimal returns the extracted fields only
+	VerbosityMinimal = "minimal"
+	// VerbosityStandard adds provenance, confidence, warnings and timings
+	VerbosityStandard = "standard"
+	// VerbosityDebug adds the unmatched lines and the parse trace, and for admin
+	// requests the raw Textract output when extraction fails
+	VerbosityDebug = "debug"
+)
+
+// requestVerbosity returns the verbosity asked for by the request, falling back to the
+// configured default
+func (s *Server) requestVerbosity(c fiber.Ctx) (string, error) {
+	verbosity := c.FormValue(Verbosity, s.config.Verbosity)
+	switch verbosity {
+	case "":
+		return VerbosityStandard, nil
+	case VerbosityMinimal, VerbosityStandard, VerbosityDebug:
+		return verbosity, nil
+	default:
+		return "", fiber.NewError(fiber.StatusBadRequest, "verbosity must be minimal, standard or debug")
+	}
+}
+
+// extractionData builds the response payload of a successful extraction
+func extractionData(docType, verbosity string, extractedInfo ExtractedInfo, parser *ReceiptParser, timings *pipelineTimings) fiber.Map {
+	data := fiber.Map{
+		"docType":       docType,
+		"extractedInfo": extractedInfo,
+	}
+	// the breakdown is part of the result, not a parse detail
+	if parser != nil && parser.TaxBreakdown() != nil {
+		data["taxBreakdown"] = parser.TaxBreakdown()
+	}
+	if verbosity == VerbosityMinimal {
+		return data
+	}
+
+	data["timings"] = timings.report()
+	// cached results carry no parse details
+	if parser == nil {
+		return data
+	}
+
+	data["fields"] = parser.Provenance()
+	if warnings := parser.Warnings(); len(warnings) > 0 {
+		data["warnings"] = warnings
+	}
+	if notApplicable := parser.NotApplicable(); len(notApplicable) > 0 {
+		data["notApplicable"] = notApplicable
+	}
+	if violations := parser.Violations(); len(violations) > 0 {
+		data["violations"] = violations
+	}
+	if lowConfidence := parser.LowConfidence(); len(lowConfidence) > 0 {
+		data["lowConfidence"] = lowConfidence
+	}
+
+	if verbosity == VerbosityDebug {
+		data["unmatchedLines"] = parser.UnmatchedLines()
+		data["trace"] = parser.Trace()
+		if explanation := parser.Explanation(); explanation != nil {
+			data["explain"] = explanation
+		}
+	}
+	return data
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/mehmetsafabenli/cbomdekont/pkg/version"
+	"github.com/spf13/viper"
+)
+
+// featureFlags reports which optional subsystems are enabled by the current config
+func (s *Server) featureFlags() map[string]bool {
+	return map[string]bool{
+		"adminApi":      s.config.AdminToken != "" || s.config.AdminTokenFile != "",
+		"cache":         s.config.CacheServer != "",
+		"cacheSentinel": s.config.CacheSentinelMaster != "",
+		"resultCache":   s.config.CacheServer != "" && s.config.ResultCacheTTL > 0,
+		"tracing":       viper.GetString("otel-service-name") != "",
+	}
+}
+
+// Version godoc
+// @Summary Version
+// @Description returns the build metadata and enabled features
+// @Tags HTTP API
+// @Produce json
+// @Router /api/v1/version [get]
+// @Success 200 {object} BaseResponse
+func (s *Server) versionHandler(c fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(BaseResponse{
+		Success: true,
+		Message: "Version",
+		Data: fiber.Map{
+			"version":   version.VERSION,
+			"revision":  version.REVISION,
+			"buildDate": version.BUILDDATE,
+			"goVersion": version.GoVersion(),
+			"features":  s.featureFlags(),
+		},
+	})
+}
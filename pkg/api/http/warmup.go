@@ -0,0 +1,69 @@
+package http
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+const defaultWarmUpTimeout = 10 * time.Second
+
+// WarmUpConfig opens the outbound connections before the server reports ready, so the
+// first requests after a deploy do not pay for TLS handshakes and credential lookups
+type WarmUpConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Textract sends the embedded doctor sample to DetectDocumentText, which is billed as
+	// one page; without it only the credentials are resolved
+	Textract bool `mapstructure:"textract"`
+	// Timeout bounds the whole warm-up; readiness is reported after it either way
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// warmUp establishes the AWS and redis connections. Failures are logged and do not
+// keep the server from becoming ready, the requests will retry the connections.
+func (s *Server) warmUp(ctx context.Context) {
+	if !s.config.WarmUp.Enabled {
+		return
+	}
+	timeout := s.config.WarmUp.Timeout
+	if timeout <= 0 {
+		timeout = defaultWarmUpTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+
+	if client := s.awsService.textractClient; client != nil {
+		if s.config.WarmUp.Textract {
+			if _, err := client.DetectDocumentText(ctx, &textract.DetectDocumentTextInput{
+				Document: &types.Document{Bytes: doctorSample},
+			}); err != nil {
+				s.logger.Warn("Textract warm-up failed", zap.Error(err))
+			}
+		} else if _, err := client.Options().Credentials.Retrieve(ctx); err != nil {
+			s.logger.Warn("AWS credentials warm-up failed", zap.Error(err))
+		}
+	}
+
+	// fill the idle connections of the pool, each Get past the idle ones dials
+	if s.pool != nil {
+		conns := make([]redis.Conn, 0, s.pool.MaxIdle)
+		for range s.pool.MaxIdle {
+			conn := s.pool.Get()
+			conns = append(conns, conn)
+			if _, err := conn.Do("PING"); err != nil {
+				s.logger.Warn("Redis warm-up failed", zap.Error(err))
+				break
+			}
+		}
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+
+	s.logger.Info("Warm-up done", zap.Duration("duration", time.Since(start)))
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+// Warning codes are stable, clients may switch on them
+const (
+	// WarnMalformedBlock is a Textract block a lenient parse skipped
+	WarnMalformedBlock = "MALFORMED_BLOCK"
+	// WarnLowConfidence is a value held back because of its confidence
+	WarnLowConfidence = "LOW_CONFIDENCE"
+	// WarnFuzzyKeyMatch is a value whose key was only found ignoring case and Turkish
+	// characters
+	WarnFuzzyKeyMatch = "FUZZY_KEY_MATCH"
+	// WarnDuplicateKey is a key found several times with different values; the first
+	// value is returned
+	WarnDuplicateKey = "DUPLICATE_KEY"
+	// WarnNormalizationFailed is a value returned as read because it could not be
+	// interpreted, e.g. an amount to convert that is not a number
+	WarnNormalizationFailed = "NORMALIZATION_FAILED"
+	// WarnVATTotalMismatch is a total VAT line disagreeing with the VAT per rate
+	WarnVATTotalMismatch = "VAT_TOTAL_MISMATCH"
+)
+
+// Warning is a soft issue of an extraction that did not fail it
+type Warning struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p *ReceiptParser) warn(code, field, format string, args ...any) {
+	p.warnings = append(p.warnings, Warning{Code: code, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// turkishFold maps the Turkish letters OCR often reads without their marks
+var turkishFold = strings.NewReplacer("ı", "i", "ş", "s", "ğ", "g", "ü", "u", "ö", "o", "ç", "c")
+
+// foldKey makes "GÖNDEREN :" and "Gonderen" compare equal
+func foldKey(text string) string {
+	text = strings.ToLowerSpecial(unicode.TurkishCase, normalizeKey(text))
+	return strings.Join(strings.Fields(turkishFold.Replace(text)), " ")
+}
+
+// keyIs reports whether text is key, compared as the field's flags ask; in the fuzzy pass
+// case, spacing and Turkish characters are ignored
+func (p *ReceiptParser) keyIs(text, key string) bool {
+	if p.fuzzy {
+		return foldKey(text) == foldKey(key)
+	}
+	return p.keyMatch.fold(text) == p.keyMatch.fold(key)
+}
+
+// keyIn reports whether text contains key, compared as the field's flags ask; in the fuzzy
+// pass case, spacing and Turkish characters are ignored
+func (p *ReceiptParser) keyIn(text, key string) bool {
+	if p.fuzzy {
+		return strings.Contains(foldKey(text), foldKey(key))
+	}
+	return strings.Contains(p.keyMatch.fold(text), p.keyMatch.fold(key))
+}
+
+// findFuzzy repeats the search of a key based strategy ignoring case, spacing and
+// Turkish characters, for documents whose OCR lost them
+func (p *ReceiptParser) findFuzzy(field string, strategy FieldStrategy) (string, *types.Block) {
+	if strategy.Key == "" || strategy.Strategy == StrategyCEL {
+		return "", nil
+	}
+	// the candidates of the exact pass are enough for explain
+	explaining := p.explaining
+	p.fuzzy, p.explaining = true, nil
+	value, source := p.findFieldValue(strategy)
+	p.fuzzy, p.explaining = false, explaining
+	if value != "" {
+		p.warn(WarnFuzzyKeyMatch, field, "key %q was only found ignoring case and Turkish characters", strategy.Key)
+		p.tracef("Fuzzy key match for %s", field)
+	}
+	return value, source
+}
+
+// checkDuplicateLines warns when a line after from repeats key with another value
+func (p *ReceiptParser) checkDuplicateLines(from int, key, value string) {
+	for _, block := range p.blocks[from:] {
+		if block.BlockType != types.BlockTypeLine || block.Text == nil || !p.keyIn(blockText(block), key) {
+			continue
+		}
+		parts := strings.SplitN(blockText(block), ":", 2)
+		if len(parts) == 2 {
+			if other := strings.TrimSpace(parts[1]); other != "" && other != value {
+				p.warnDuplicate(key)
+				return
+			}
+		}
+	}
+}
+
+// checkDuplicateKeys warns when a form key after from repeats key with another value
+func (p *ReceiptParser) checkDuplicateKeys(from int, key, value string) {
+	for _, block := range p.blocks[from:] {
+		if !p.isKeyValueSet(block, key) {
+			continue
+		}
+		if other, _ := p.getValueFromKeyValueSet(block); other != "" && other != value {
+			p.warnDuplicate(key)
+			return
+		}
+	}
+}
+
+func (p *ReceiptParser) warnDuplicate(key string) {
+	p.warn(WarnDuplicateKey, p.field, "key %q appears again with a different value, the first one is returned", key)
+}
@@ -14,6 +14,9 @@ type Watcher struct {
 	dir       string
 	fsWatcher *fsnotify.Watcher
 	Cache     *sync.Map
+
+	mu       sync.Mutex
+	onReload []func(error)
 }
 
 func NewWatch(dir string) (*Watcher, error) {
@@ -45,20 +48,36 @@ func NewWatch(dir string) (*Watcher, error) {
 	return w, nil
 }
 
+// OnReload registers fn to be called after every reload event with the error of the
+// reload, nil when the cache was updated
+func (w *Watcher) OnReload(fn func(error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onReload = append(w.onReload, fn)
+}
+
+func (w *Watcher) notifyReload(err error) {
+	w.mu.Lock()
+	listeners := w.onReload
+	w.mu.Unlock()
+	for _, fn := range listeners {
+		fn(err)
+	}
+}
+
 func (w *Watcher) Watch() {
 	go func() {
 		for {
 			select {
 			case event := <-w.fsWatcher.Events:
-				if event.Op&fsnotify.Create == fsnotify.Create {
-					if filepath.Base(event.Name) == "..data" {
-						err := w.updateCache()
-						if err != nil {
-							log.Printf("fscache update error %v", err)
-						} else {
-							log.Printf("fscache reload %s", w.dir)
-						}
+				if isReloadEvent(event) {
+					err := w.updateCache()
+					if err != nil {
+						log.Printf("fscache update error %v", err)
+					} else {
+						log.Printf("fscache reload %s", w.dir)
 					}
+					w.notifyReload(err)
 				}
 			case err := <-w.fsWatcher.Errors:
 				log.Printf("fswatcher %s error %v", w.dir, err)
@@ -67,6 +86,16 @@ func (w *Watcher) Watch() {
 	}()
 }
 
+// isReloadEvent matches the Kubernetes ..data symlink swap as well as
+// in-place writes to regular files, e.g. secrets mounted without a projection
+func isReloadEvent(event fsnotify.Event) bool {
+	name := filepath.Base(event.Name)
+	if event.Op&fsnotify.Create == fsnotify.Create && name == "..data" {
+		return true
+	}
+	return event.Op&(fsnotify.Create|fsnotify.Write) != 0 && !strings.HasPrefix(name, ".")
+}
+
 func (w *Watcher) updateCache() error {
 	fileMap := make(map[string]string)
 	files, err := os.ReadDir(w.dir)
@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	samplerSlots = 4096
+	samplerTick  = time.Second
+)
+
+// Config holds the logging settings that can change while the process runs
+type Config struct {
+	// Level is the default level, e.g. info
+	Level string
+	// Levels overrides the level per named logger, e.g. parser: debug; a name also
+	// covers its children such as parser.tables
+	Levels   map[string]string
+	Sampling SamplingConfig
+}
+
+// SamplingConfig logs the first Initial entries with the same level and message every
+// second, then every Thereafter-th one. Initial 0 disables sampling.
+type SamplingConfig struct {
+	Initial    int `mapstructure:"initial"`
+	Thereafter int `mapstructure:"thereafter"`
+}
+
+type settings struct {
+	level    zapcore.Level
+	levels   map[string]zapcore.Level
+	minimum  zapcore.Level
+	sampling SamplingConfig
+}
+
+type counter struct {
+	resetAt atomic.Int64
+	count   atomic.Uint64
+}
+
+// Controller gates the entries of every core it wraps by the current Config, which
+// Update swaps atomically
+type Controller struct {
+	settings atomic.Pointer[settings]
+	counters [zapcore.FatalLevel - zapcore.DebugLevel + 1][samplerSlots]counter
+}
+
+func NewController(cfg Config) (*Controller, error) {
+	c := &Controller{}
+	if err := c.Update(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Update applies cfg to all loggers; on error the previous settings stay in place
+func (c *Controller) Update(cfg Config) error {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	s := &settings{level: level, minimum: level, sampling: cfg.Sampling, levels: make(map[string]zapcore.Level, len(cfg.Levels))}
+	for name, text := range cfg.Levels {
+		l, err := parseLevel(text)
+		if err != nil {
+			return fmt.Errorf("logger %s: %w", name, err)
+		}
+		s.levels[strings.ToLower(name)] = l
+		s.minimum = min(s.minimum, l)
+	}
+	c.settings.Store(s)
+	return nil
+}
+
+func parseLevel(text string) (zapcore.Level, error) {
+	if text == "" {
+		return zapcore.InfoLevel, nil
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(text)); err != nil {
+		return level, fmt.Errorf("invalid log level %q", text)
+	}
+	return level, nil
+}
+
+// levelFor returns the level of the closest configured ancestor of the named logger
+func (s *settings) levelFor(name string) zapcore.Level {
+	name = strings.ToLower(name)
+	for name != "" {
+		if level, ok := s.levels[name]; ok {
+			return level
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return s.level
+}
+
+// sample reports whether the entry is within the sampling budget of its message
+func (c *Controller) sample(s *settings, ent zapcore.Entry) bool {
+	if s.sampling.Initial <= 0 || ent.Level < zapcore.DebugLevel || ent.Level > zapcore.FatalLevel {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(ent.Message))
+	ctr := &c.counters[ent.Level-zapcore.DebugLevel][h.Sum32()%samplerSlots]
+
+	now := ent.Time.UnixNano()
+	resetAt := ctr.resetAt.Load()
+	if now > resetAt && ctr.resetAt.CompareAndSwap(resetAt, now+int64(samplerTick)) {
+		ctr.count.Store(0)
+	}
+	n := ctr.count.Add(1)
+
+	initial := uint64(s.sampling.Initial)
+	if n <= initial {
+		return true
+	}
+	return s.sampling.Thereafter > 0 && (n-initial)%uint64(s.sampling.Thereafter) == 0
+}
+
+// Wrap returns core gated by the controller; core itself should enable every level
+func (c *Controller) Wrap(core zapcore.Core) zapcore.Core {
+	return &controlledCore{Core: core, controller: c}
+}
+
+type controlledCore struct {
+	zapcore.Core
+	controller *Controller
+}
+
+func (cc *controlledCore) Enabled(level zapcore.Level) bool {
+	return level >= cc.controller.settings.Load().minimum
+}
+
+func (cc *controlledCore) With(fields []zapcore.Field) zapcore.Core {
+	return &controlledCore{Core: cc.Core.With(fields), controller: cc.controller}
+}
+
+func (cc *controlledCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	s := cc.controller.settings.Load()
+	if ent.Level < s.levelFor(ent.LoggerName) || !cc.controller.sample(s, ent) {
+		return ce
+	}
+	return cc.Core.Check(ent, ce)
+}
@@ -0,0 +1,263 @@
+package sentry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LevelError = "error"
+	LevelFatal = "fatal"
+
+	sdkName    = "cbomdekont.sentry"
+	sdkVersion = "1.0.0"
+	queueSize  = 100
+)
+
+// Client sends events to a Sentry compatible envelope endpoint. A nil *Client is valid
+// and drops every event, so callers don't need to check whether reporting is enabled.
+type Client struct {
+	endpoint    string
+	auth        string
+	environment string
+	release     string
+	serverName  string
+	httpClient  *http.Client
+	queue       chan *Event
+	wg          sync.WaitGroup
+	mu          sync.RWMutex
+	closed      bool
+}
+
+// Event is the subset of the Sentry event payload used by this service
+type Event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Message     string            `json:"message,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Exception   *exceptions       `json:"exception,omitempty"`
+}
+
+type exceptions struct {
+	Values []exception `json:"values"`
+}
+
+type exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *stacktrace `json:"stacktrace,omitempty"`
+}
+
+type stacktrace struct {
+	Frames []frame `json:"frames"`
+}
+
+type frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// New parses the DSN (https://<key>@<host>/<project>) and starts the background sender.
+// A nil transport uses http.DefaultTransport.
+func New(dsn, environment, release string, transport http.RoundTripper) (*Client, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry dsn: %w", err)
+	}
+	project := strings.Trim(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || project == "" {
+		return nil, errors.New("invalid sentry dsn: public key and project id are required")
+	}
+	// self-hosted Sentry may be served under a path prefix
+	prefix := ""
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+
+	hostname, _ := os.Hostname()
+	c := &Client{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s/%s, sentry_key=%s", sdkName, sdkVersion, u.User.Username()),
+		environment: environment,
+		release:     release,
+		serverName:  hostname,
+		httpClient:  &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		queue:       make(chan *Event, queueSize),
+	}
+
+	c.wg.Add(1)
+	go c.run()
+
+	return c, nil
+}
+
+// CaptureException reports err with the stack of the caller
+func (c *Client) CaptureException(err error, tags map[string]string) {
+	if c == nil || err == nil {
+		return
+	}
+	c.capture(LevelError, err, tags, 3)
+}
+
+// CapturePanic reports a recovered panic value; call it from the deferred recover function
+func (c *Client) CapturePanic(value any, tags map[string]string) {
+	if c == nil {
+		return
+	}
+	err, ok := value.(error)
+	if !ok {
+		err = fmt.Errorf("%v", value)
+	}
+	c.capture(LevelFatal, err, tags, 3)
+}
+
+func (c *Client) capture(level string, err error, tags map[string]string, skip int) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	event := &Event{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC(),
+		Level:       level,
+		Platform:    "go",
+		Release:     c.release,
+		Environment: c.environment,
+		ServerName:  c.serverName,
+		Tags:        tags,
+		Exception: &exceptions{Values: []exception{{
+			Type:       reflect.TypeOf(err).String(),
+			Value:      err.Error(),
+			Stacktrace: callerStack(skip + 1),
+		}}},
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return
+	}
+
+	// never block request handling on the error tracker
+	select {
+	case c.queue <- event:
+	default:
+	}
+}
+
+// Flush stops accepting events and waits up to timeout for queued events to be sent
+func (c *Client) Flush(timeout time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func (c *Client) run() {
+	defer c.wg.Done()
+	for event := range c.queue {
+		_ = c.send(event)
+	}
+}
+
+func (c *Client) send(event *Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `{"event_id":%q,"sent_at":%q}`+"\n", event.EventID, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(payload))
+	body.Write(payload)
+	body.WriteString("\n")
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", c.auth)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sentry returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// callerStack returns the stack frames, outermost first as Sentry expects
+func callerStack(skip int) *stacktrace {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var out []frame
+	for {
+		f, more := frames.Next()
+		module, function := splitFunction(f.Function)
+		out = append(out, frame{
+			Function: function,
+			Module:   module,
+			AbsPath:  f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(module, "github.com/mehmetsafabenli/cbomdekont"),
+		})
+		if !more {
+			break
+		}
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return &stacktrace{Frames: out}
+}
+
+// splitFunction splits "github.com/x/y/pkg.(*T).Method" into its package path and function name
+func splitFunction(name string) (string, string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/gofiber/fiber/v3"
 	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/viper"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
@@ -11,53 +12,90 @@ import (
 	"time"
 )
 
+// tracerShutdownTimeout bounds flushing the spans left after the drain
+const tracerShutdownTimeout = 5 * time.Second
+
+var (
+	drainingGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "http",
+		Name:      "draining",
+		Help:      "1 while the server is draining in-flight requests before exiting.",
+	})
+	drainDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Subsystem: "http",
+		Name:      "drain_duration_seconds",
+		Help:      "The time taken to drain in-flight requests on shutdown.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	})
+)
+
+func init() {
+	prometheus.MustRegister(drainingGauge)
+	prometheus.MustRegister(drainDuration)
+}
+
 type Shutdown struct {
 	logger                *zap.Logger
 	pool                  *redis.Pool
 	tracerProvider        *sdktrace.TracerProvider
 	serverShutdownTimeout time.Duration
+	preStopDelay          time.Duration
 }
 
-func NewShutdown(serverShutdownTimeout time.Duration, logger *zap.Logger) (*Shutdown, error) {
+// NewShutdown drains the server for at most serverShutdownTimeout, after waiting
+// preStopDelay for the load balancers to stop sending traffic
+func NewShutdown(serverShutdownTimeout, preStopDelay time.Duration, logger *zap.Logger) (*Shutdown, error) {
 	srv := &Shutdown{
 		logger:                logger,
 		serverShutdownTimeout: serverShutdownTimeout,
+		preStopDelay:          preStopDelay,
 	}
 
 	return srv, nil
 }
 
 func (s *Shutdown) Graceful(stopCh <-chan struct{}, httpServer *fiber.App, healthy *int32, ready *int32) {
-	ctx := context.Background()
-
 	<-stopCh
-	ctx, cancel := context.WithTimeout(ctx, s.serverShutdownTimeout)
-	defer cancel()
 
 	atomic.StoreInt32(healthy, 0)
 	atomic.StoreInt32(ready, 0)
 
-	if s.pool != nil {
-		_ = s.pool.Close()
-	}
-
-	//we are waiting 3 second because logger may not be able to log the shutdown message
-	s.logger.Info("Shutting down HTTP/HTTPS server.go", zap.Duration("timeout", s.serverShutdownTimeout))
+	// readiness is already failing; wait for the endpoints to be removed from the load
+	// balancers, otherwise requests routed meanwhile are refused
+	s.logger.Info("Shutting down HTTP/HTTPS server.go",
+		zap.Duration("timeout", s.serverShutdownTimeout), zap.Duration("preStopDelay", s.preStopDelay))
 	if viper.GetString("level") != "debug" {
-		time.Sleep(3 * time.Second)
+		time.Sleep(s.preStopDelay)
 	}
 
-	// stop OpenTelemetry tracer provider
-	if s.tracerProvider != nil {
-		if err := s.tracerProvider.Shutdown(ctx); err != nil {
-			s.logger.Warn("stopping tracer provider", zap.Error(err))
-		}
-	}
-	
+	// the drain gets the whole timeout, counted from the end of the pre-stop delay
+	ctx, cancel := context.WithTimeout(context.Background(), s.serverShutdownTimeout)
+	defer cancel()
+
 	// determine if the http server.go was started
 	if httpServer != nil {
+		drainingGauge.Set(1)
+		drainStart := time.Now()
 		if err := httpServer.ShutdownWithContext(ctx); err != nil {
 			s.logger.Warn("HTTP server.go graceful shutdown failed", zap.Error(err))
 		}
+		drainDuration.Observe(time.Since(drainStart).Seconds())
+		drainingGauge.Set(0)
+		s.logger.Info("HTTP server drained", zap.Duration("duration", time.Since(drainStart)))
+	}
+
+	// drained requests may still have used redis
+	if s.pool != nil {
+		_ = s.pool.Close()
+	}
+
+	// stop OpenTelemetry tracer provider after the drain so the spans of the drained
+	// requests are exported; it gets its own timeout in case the drain used up ctx
+	if s.tracerProvider != nil {
+		tracerCtx, cancelTracer := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+		defer cancelTracer()
+		if err := s.tracerProvider.Shutdown(tracerCtx); err != nil {
+			s.logger.Warn("stopping tracer provider", zap.Error(err))
+		}
 	}
 }
@@ -1,4 +1,13 @@
 package version
 
+import "runtime"
+
+// VERSION, REVISION and BUILDDATE are set at build time via -ldflags "-X ..."
 var VERSION = "1.0.0"
 var REVISION = "unknown"
+var BUILDDATE = "unknown"
+
+// GoVersion returns the Go toolchain version the binary was built with
+func GoVersion() string {
+	return runtime.Version()
+}